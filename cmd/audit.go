@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"gmail-oauth-proxy-server/internal/audit"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/store"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditLimit  int
+	auditAction string
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "审计记录命令",
+	Long: color.New(color.FgCyan).Sprint("📜 审计记录") + `
+
+查看保存在状态存储（audit命名空间）中的审计记录，包括：
+• API Key的生成、创建、吊销、轮换和清除
+• 认证失败封禁的创建和解除
+• 刷新令牌保险库凭据的保存和删除
+
+审计记录保留90天，过期后自动删除。
+
+示例:
+  gmail-oauth-proxy audit list
+  gmail-oauth-proxy audit list --action key. --limit 20`,
+}
+
+// auditListCmd represents the audit list command
+var auditListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "列出审计记录",
+	Run:   listAuditRecords,
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditListCmd)
+
+	auditListCmd.Flags().IntVar(&auditLimit, "limit", 50, "最多显示的记录数（最新的记录），0表示不限制")
+	auditListCmd.Flags().StringVar(&auditAction, "action", "", "只显示以该前缀开头的事件（如 key.、ban.、grant.）")
+}
+
+func listAuditRecords(cmd *cobra.Command, args []string) {
+	cfg, err := config.LoadForDisplay()
+	if err != nil {
+		color.Red("❌ 配置加载失败: %v", err)
+		return
+	}
+	keyring, err := cfg.Encryption.Keyring()
+	if err != nil {
+		color.Red("❌ 加载主密钥失败: %v", err)
+		return
+	}
+	st, err := store.Open(cfg.Storage.Backend, cfg.Storage.Path, keyring)
+	if err != nil {
+		color.Red("❌ 打开状态存储失败: %v", err)
+		return
+	}
+	defer st.Close()
+
+	records, err := audit.New(st).List()
+	if err != nil {
+		color.Red("❌ 读取审计记录失败: %v", err)
+		return
+	}
+	filtered := records[:0]
+	for _, record := range records {
+		if strings.HasPrefix(record.Action, auditAction) {
+			filtered = append(filtered, record)
+		}
+	}
+	if auditLimit > 0 && len(filtered) > auditLimit {
+		filtered = filtered[len(filtered)-auditLimit:]
+	}
+	if len(filtered) == 0 {
+		color.Yellow("📭 没有审计记录")
+		return
+	}
+
+	color.Green("📜 审计记录 (%d):", len(filtered))
+	for _, record := range filtered {
+		actor := record.Actor
+		if actor == "" {
+			actor = "-"
+		}
+		line := color.CyanString("%-12s", record.Action) + "  " + record.Target + "  操作者: " + actor
+		if record.Detail != "" {
+			line += "  " + color.YellowString(record.Detail)
+		}
+		color.White("  • %s  %s", record.Time.Local().Format("2006-01-02 15:04:05"), line)
+	}
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/middleware"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	adminServer string
+	adminKey    string
+	banClearAll bool
+)
+
+// bansCmd represents the bans command
+var bansCmd = &cobra.Command{
+	Use:   "bans",
+	Short: "认证失败封禁管理命令",
+	Long: color.New(color.FgRed).Sprint("🚷 认证失败封禁管理") + `
+
+查看和解除因多次提供错误API Key而被临时封禁的客户端IP。
+封禁保存在服务器的状态存储中，命令通过管理端点（/admin/bans）访问服务器，
+需要在服务器上配置 admin.api_key（或 OAUTH_PROXY_ADMIN_API_KEY）。
+
+子命令:
+  list   列出当前封禁
+  clear  解除封禁
+
+示例:
+  gmail-oauth-proxy bans list
+  gmail-oauth-proxy bans clear 203.0.113.7
+  gmail-oauth-proxy bans clear --all
+  gmail-oauth-proxy bans list --server https://proxy.example.com --admin-key gop_xxx`,
+}
+
+// bansListCmd represents the bans list command
+var bansListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "列出当前封禁",
+	Run:   listBans,
+}
+
+// bansClearCmd represents the bans clear command
+var bansClearCmd = &cobra.Command{
+	Use:   "clear [ip]",
+	Short: "解除封禁",
+	Long: color.New(color.FgGreen).Sprint("🔓 解除封禁") + `
+
+解除指定IP的封禁并清空其失败记录，使用 --all 解除所有封禁。`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  clearBans,
+}
+
+func init() {
+	rootCmd.AddCommand(bansCmd)
+	bansCmd.AddCommand(bansListCmd)
+	bansCmd.AddCommand(bansClearCmd)
+
+	bansCmd.PersistentFlags().StringVar(&adminServer, "server", "", "服务器地址，默认 http://localhost:<port>")
+	bansCmd.PersistentFlags().StringVar(&adminKey, "admin-key", "", "管理API Key，默认使用 admin.api_key 配置")
+	bansClearCmd.Flags().BoolVar(&banClearAll, "all", false, "解除所有封禁")
+}
+
+func listBans(cmd *cobra.Command, args []string) {
+	var result struct {
+		Enabled bool             `json:"enabled"`
+		Bans    []middleware.Ban `json:"bans"`
+	}
+	if err := adminRequest(http.MethodGet, "/admin/bans", &result); err != nil {
+		color.Red("❌ 读取封禁列表失败: %v", err)
+		return
+	}
+	if !result.Enabled {
+		color.Yellow("⚠️  服务器未启用认证失败封禁 (brute_force.enabled)")
+		return
+	}
+	if len(result.Bans) == 0 {
+		color.Green("✅ 当前没有被封禁的IP")
+		return
+	}
+
+	color.Red("🚷 被封禁的IP (%d):", len(result.Bans))
+	now := time.Now()
+	for _, ban := range result.Bans {
+		color.White("  • %-40s 失败%d次  封禁于: %s  剩余: %s", ban.IP, ban.Failures,
+			ban.BannedAt.Local().Format("2006-01-02 15:04:05"), ban.ExpiresAt.Sub(now).Round(time.Second))
+	}
+}
+
+func clearBans(cmd *cobra.Command, args []string) {
+	if len(args) == 0 && !banClearAll {
+		color.Red("❌ 请指定要解除封禁的IP，或使用 --all 解除所有封禁")
+		return
+	}
+
+	path := "/admin/bans"
+	if len(args) > 0 {
+		path += "/" + url.PathEscape(args[0])
+	}
+	var result struct {
+		Cleared int `json:"cleared"`
+	}
+	if err := adminRequest(http.MethodDelete, path, &result); err != nil {
+		color.Red("❌ 解除封禁失败: %v", err)
+		return
+	}
+	if len(args) > 0 {
+		color.Green("✅ 已解除封禁: %s", args[0])
+	} else {
+		color.Green("✅ 已解除%d个封禁", result.Cleared)
+	}
+}
+
+// adminRequest 使用管理API Key请求服务器的管理端点并解析JSON响应
+func adminRequest(method, path string, result interface{}) error {
+	cfg, err := config.LoadForDisplay()
+	if err != nil {
+		return fmt.Errorf("配置加载失败: %w", err)
+	}
+
+	server := adminServer
+	if server == "" {
+		server = "http://localhost:" + cfg.Port
+	}
+	key := adminKey
+	if key == "" {
+		key = cfg.Admin.APIKey
+	}
+	if key == "" {
+		return fmt.Errorf("未配置管理API Key，请使用 --admin-key 或设置 admin.api_key")
+	}
+	if apikey.IsHash(key) {
+		return fmt.Errorf("admin.api_key 配置的是哈希，请使用 --admin-key 提供明文管理API Key")
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(server, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-API-Key", key)
+
+	client := &http.Client{Timeout: time.Duration(cfg.Timeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &errResp) == nil && errResp.Description != "" {
+			return fmt.Errorf("%s (HTTP %d)", errResp.Description, resp.StatusCode)
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("管理端点不存在，请确认服务器已配置 admin.api_key (HTTP 404)")
+		}
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.Unmarshal(body, result)
+}
@@ -1,11 +1,24 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"gmail-oauth-proxy-server/internal/apikey"
 	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/egress"
+	"gmail-oauth-proxy-server/internal/handler"
+	"gmail-oauth-proxy-server/internal/middleware"
+	"gmail-oauth-proxy-server/internal/oauthclient"
+	"gmail-oauth-proxy-server/internal/serviceaccount"
+	"gmail-oauth-proxy-server/internal/store"
+	"gmail-oauth-proxy-server/internal/tlsreload"
+	"gmail-oauth-proxy-server/internal/tracing"
 	"net"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -28,12 +41,14 @@ var configCmd = &cobra.Command{
   validate  验证配置文件有效性
   cache     管理配置缓存
   clear     清除配置缓存
+  rekey     轮换静态加密主密钥
 
 示例:
   gmail-oauth-proxy config show       # 显示当前配置
   gmail-oauth-proxy config validate   # 验证配置文件
   gmail-oauth-proxy config cache      # 显示缓存信息
-  gmail-oauth-proxy config clear      # 清除缓存`,
+  gmail-oauth-proxy config clear      # 清除缓存
+  gmail-oauth-proxy config rekey --generate  # 轮换主密钥`,
 }
 
 // configShowCmd represents the config show command
@@ -136,14 +151,19 @@ func showConfig(cmd *cobra.Command, args []string) {
 	color.Green("\n🔐 鉴权配置:")
 	// 脱敏显示API Key
 	if cfg.APIKey != "" {
-		apiKeyDisplay := "****"
-		if len(cfg.APIKey) > 8 {
-			apiKeyDisplay = fmt.Sprintf("%s****%s", cfg.APIKey[:4], cfg.APIKey[len(cfg.APIKey)-4:])
-		}
-		color.White("  • API密钥: %s", color.GreenString(apiKeyDisplay))
+		color.White("  • API密钥: %s", color.GreenString(apikey.Display(cfg.APIKey)))
 	} else {
 		color.White("  • API密钥: %s", color.RedString("未设置"))
 	}
+	if cfg.APIKeyPepper != "" {
+		color.White("  • API Key pepper: %s", color.GreenString("已配置"))
+	} else if cache, err := config.NewConfigCacheWithStore(cfg, store.NewMemory()); err == nil {
+		if keyring, err := cfg.Encryption.Keyring(); err == nil && keyring.Enabled() {
+			color.White("  • API Key pepper: %s %s", color.BlueString(cache.GetPepperFile()), color.GreenString("(主密钥加密)"))
+		} else {
+			color.White("  • API Key pepper: %s %s", color.BlueString(cache.GetPepperFile()), color.YellowString("(明文保存)"))
+		}
+	}
 
 	// 显示IP白名单
 	if len(cfg.IPWhitelist) > 0 {
@@ -159,6 +179,244 @@ func showConfig(cmd *cobra.Command, args []string) {
 	} else {
 		color.White("  • IP白名单: %s", color.RedString("未设置"))
 	}
+	if cfg.Auth.Mode == config.AuthModeAny {
+		color.White("  • 组合方式: %s", color.YellowString("any (API Key或IP白名单任一通过即可)"))
+	} else {
+		color.White("  • 组合方式: %s", color.GreenString("all (API Key和IP白名单都必须通过)"))
+	}
+	for _, route := range cfg.Auth.Routes {
+		color.White("    - %s: %s", color.BlueString(route.Path), route.Mode)
+	}
+	if len(cfg.TrustedProxies) > 0 {
+		color.White("  • 受信任的代理: %s", color.GreenString(strings.Join(cfg.TrustedProxies, ", ")))
+		if header, err := middleware.ParseForwardedHeader(cfg.ForwardedHeader); err != nil {
+			color.White("  • 转发头: %s", color.RedString(err.Error()))
+		} else {
+			color.White("  • 转发头: %s", color.GreenString(header+"（忽略其他转发头）"))
+		}
+	} else {
+		color.White("  • 受信任的代理: %s", color.YellowString("未设置（忽略所有转发头，使用连接来源IP）"))
+	}
+
+	color.Green("\n🚷 认证失败封禁:")
+	if !cfg.BruteForce.Enabled {
+		color.White("  • 启用状态: %s", color.YellowString("未启用"))
+	} else {
+		color.White("  • 启用状态: %s", color.GreenString("已启用"))
+		color.White("  • 封禁规则: %s", color.GreenString(fmt.Sprintf("%d秒内%d次错误API Key后封禁%d秒",
+			cfg.BruteForce.Window, cfg.BruteForce.MaxFailures, cfg.BruteForce.BanDuration)))
+	}
+	if cfg.Admin.APIKey != "" {
+		color.White("  • 管理端点: %s", color.GreenString("已启用 (管理API Key: "+apikey.Display(cfg.Admin.APIKey)+")"))
+	} else {
+		color.White("  • 管理端点: %s", color.YellowString("未启用 (需要配置 admin.api_key)"))
+	}
+
+	color.Green("\n📈 Prometheus指标:")
+	if !cfg.Metrics.Enabled {
+		color.White("  • 启用状态: %s", color.YellowString("未启用"))
+	} else {
+		color.White("  • 启用状态: %s", color.GreenString("已启用"))
+		listen := "主端口"
+		if cfg.Metrics.Listen != "" {
+			listen = cfg.Metrics.Listen
+		}
+		color.White("  • 端点: %s", color.BlueString(listen+" "+cfg.Metrics.Path))
+		if cfg.Metrics.RequireAdminKey {
+			color.White("  • 访问控制: %s", color.GreenString("需要管理API Key"))
+		} else {
+			color.White("  • 访问控制: %s", color.YellowString("无"))
+		}
+	}
+
+	color.Green("\n🔐 TLS:")
+	if !cfg.TLS.Enabled() {
+		color.White("  • 启用状态: %s", color.YellowString("未启用 (HTTP)"))
+	} else {
+		color.White("  • 启用状态: %s", color.GreenString("已启用 (HTTPS)"))
+		color.White("  • 证书文件: %s", cfg.TLS.CertFile)
+		color.White("  • 私钥文件: %s", cfg.TLS.KeyFile)
+		color.White("  • 最低版本: TLS %s", cfg.TLS.MinVersion)
+		if len(cfg.TLS.CipherSuites) > 0 {
+			color.White("  • 密码套件: %s", strings.Join(cfg.TLS.CipherSuites, ", "))
+		} else {
+			color.White("  • 密码套件: Go默认")
+		}
+		if cfg.TLS.ClientCAFile != "" {
+			color.White("  • 客户端证书CA: %s", cfg.TLS.ClientCAFile)
+			for _, clientCert := range cfg.TLS.ClientCerts {
+				match := "subject=" + clientCert.Subject
+				if clientCert.SAN != "" {
+					match = "san=" + clientCert.SAN
+				}
+				color.White("  • 客户端证书身份: %s (%s)", color.GreenString(clientCert.Name), match)
+			}
+		}
+	}
+
+	color.Green("\n🛑 优雅停机:")
+	color.White("  • 请求排空超时: %d秒", cfg.Shutdown.DrainTimeout)
+	color.White("  • 停止监听前延迟: %d秒", cfg.Shutdown.Delay)
+
+	color.Green("\n🔭 OpenTelemetry追踪:")
+	if !cfg.Tracing.Enabled {
+		color.White("  • 启用状态: %s", color.YellowString("未启用"))
+	} else {
+		color.White("  • 启用状态: %s", color.GreenString("已启用"))
+		color.White("  • OTLP端点: %s", color.BlueString(cfg.Tracing.Endpoint))
+		color.White("  • 服务名: %s", cfg.Tracing.ServiceName)
+		color.White("  • 采样比例: %g", cfg.Tracing.SampleRatio)
+		if len(cfg.Tracing.Headers) > 0 {
+			color.White("  • 导出请求头: %d个 (值已隐藏)", len(cfg.Tracing.Headers))
+		}
+	}
+
+	color.Green("\n🚦 限流配置:")
+	if !cfg.RateLimit.Enabled {
+		color.White("  • 启用状态: %s", color.YellowString("未启用"))
+	} else {
+		color.White("  • 启用状态: %s", color.GreenString("已启用"))
+		color.White("  • 每个API Key: %s", formatRateLimitRule(cfg.RateLimit.PerKey))
+		color.White("  • 每个客户端IP: %s", formatRateLimitRule(cfg.RateLimit.PerIP))
+		for _, route := range cfg.RateLimit.Routes {
+			color.White("  • %s: API Key %s, IP %s", color.BlueString(route.Path), formatRateLimitRule(route.PerKey), formatRateLimitRule(route.PerIP))
+		}
+	}
+
+	color.Green("\n🔀 上游端点配置:")
+	upstream := cfg.Upstream.WithDefaults()
+	color.White("  • 授权端点: %s", color.BlueString(upstream.AuthURL))
+	color.White("  • 令牌端点: %s", color.BlueString(upstream.TokenURL))
+	color.White("  • 用户信息端点: %s", color.BlueString(upstream.UserInfoURL))
+	color.White("  • 令牌验证端点: %s", color.BlueString(upstream.TokenInfoURL))
+	color.White("  • 令牌撤销端点: %s", color.BlueString(upstream.RevokeURL))
+	color.White("  • 设备授权端点: %s", color.BlueString(upstream.DeviceCodeURL))
+
+	color.Green("\n🌐 出站代理配置:")
+	for _, name := range config.UpstreamNames {
+		settings := egress.SettingsFor(cfg.EgressProxy, name)
+		display := color.GreenString(settings.String())
+		if settings.IsDirect() {
+			display = color.YellowString("直连")
+		}
+		color.White("  • %s: %s", name, display)
+	}
+
+	color.Green("\n🔁 出站线路池:")
+	if len(cfg.EgressPool.Routes) == 0 {
+		color.White("  • 线路池: %s", color.YellowString("未配置"))
+	} else {
+		color.White("  • 健康探测: 每%d秒，超时%d秒", cfg.EgressPool.HealthCheckInterval, cfg.EgressPool.HealthCheckTimeout)
+		for i, route := range cfg.EgressPool.Routes {
+			target := route.URL
+			switch route.Type {
+			case config.EgressRouteDirect:
+				target = egress.Direct
+			case config.EgressRouteProxy:
+				target = egress.ProxySettings{URL: route.URL, Username: route.Username, Password: route.Password}.String()
+			}
+			color.White("  • %d. %s [%s] %s", i+1, color.CyanString(route.Name), route.Type, color.BlueString(target))
+		}
+	}
+
+	color.Green("\n🔐 PKCE配置:")
+	if cfg.PKCE.ProxyGenerate {
+		color.White("  • 代理生成code_verifier: %s (有效期 %d秒)", color.GreenString("已启用"), cfg.PKCE.VerifierTTL)
+	} else {
+		color.White("  • 代理生成code_verifier: %s", color.YellowString("未启用"))
+	}
+
+	color.Green("\n🧩 额外授权参数:")
+	if len(cfg.AuthParams.Allowed) == 0 {
+		color.White("  • 允许透传: %s", color.YellowString("内置列表 (login_hint, hd, include_granted_scopes, enable_granular_consent, nonce, display)"))
+	} else {
+		color.White("  • 允许透传: %s", color.GreenString(strings.Join(cfg.AuthParams.Allowed, ", ")))
+	}
+	if len(cfg.AuthParams.Rules) > 0 {
+		color.White("  • 自定义校验规则: %s", color.GreenString(fmt.Sprintf("%d条", len(cfg.AuthParams.Rules))))
+	}
+
+	color.Green("\n🪪 登记的OAuth客户端:")
+	if len(cfg.Clients) == 0 {
+		color.White("  • 客户端: %s", color.YellowString("未配置"))
+	} else {
+		for _, client := range cfg.Clients {
+			name := client.ClientID
+			if client.Alias != "" {
+				name = fmt.Sprintf("%s (%s)", client.Alias, client.ClientID)
+			}
+			color.White("  • %s: %d个回调地址, %d条回调地址规则, %d个允许权限范围, %d个禁止权限范围", color.CyanString(name),
+				len(client.RedirectURIs), len(client.RedirectURIPatterns), len(client.Scopes), len(client.ForbiddenScopes))
+		}
+	}
+	if cfg.ClientPolicy.RequireRegistered {
+		color.White("  • 未登记的客户端: %s", color.RedString("拒绝"))
+	} else {
+		color.White("  • 未登记的客户端: %s", color.YellowString("允许"))
+	}
+	if len(cfg.ClientPolicy.ForbiddenScopes) > 0 {
+		color.White("  • 全局禁止的权限范围: %s", color.RedString(strings.Join(cfg.ClientPolicy.ForbiddenScopes, ", ")))
+	}
+
+	color.Green("\n🤖 服务账号:")
+	if len(cfg.ServiceAccounts) == 0 {
+		color.White("  • 服务账号: %s", color.YellowString("未配置"))
+	} else {
+		for _, account := range cfg.ServiceAccounts {
+			source := account.KeyFile
+			if account.KeyJSON != "" {
+				source = "内联JSON"
+			}
+			delegation := color.YellowString("禁止委派")
+			if len(account.Subjects) > 0 {
+				delegation = color.GreenString("委派: " + strings.Join(account.Subjects, ", "))
+			}
+			color.White("  • %s [%s] %d个权限范围, %s", color.CyanString(account.Name), color.BlueString(source), len(account.Scopes), delegation)
+		}
+	}
+
+	color.Green("\n💾 状态存储:")
+	color.White("  • 存储后端: %s", color.GreenString(cfg.Storage.Backend))
+	st, err := store.OpenRaw(cfg.Storage.Backend, cfg.Storage.Path)
+	if err != nil {
+		color.White("  • 存储: %s", color.RedString(err.Error()))
+	} else {
+		defer st.Close()
+		if path, ok := store.FilePath(st); ok {
+			color.White("  • 文件路径: %s", color.BlueString(path))
+		}
+		for _, bucket := range []string{store.BucketKeys, store.BucketGrants, store.BucketBans, store.BucketRateLimit, store.BucketAudit} {
+			values, _ := st.List(bucket)
+			color.White("  • %s: %s", bucket, color.GreenString(fmt.Sprintf("%d条", len(values))))
+		}
+	}
+
+	color.Green("\n🔒 静态加密:")
+	if keyring, err := cfg.Encryption.Keyring(); err != nil {
+		color.White("  • 主密钥: %s", color.RedString(err.Error()))
+	} else if !keyring.Enabled() {
+		color.White("  • 主密钥: %s", color.YellowString("未配置（状态数据以明文保存，仅依赖600文件权限）"))
+	} else {
+		source := map[string]string{"key": "主密钥", "passphrase": "口令派生"}[keyring.Kind()]
+		if cfg.Encryption.KeyFile != "" {
+			source = "密钥文件 " + cfg.Encryption.KeyFile
+		}
+		color.White("  • 主密钥: %s", color.GreenString(source))
+		color.White("  • 加密方式: %s", color.GreenString("AES-256-GCM信封加密"))
+	}
+
+	color.Green("\n🔐 刷新令牌保险库:")
+	if !cfg.Vault.Enabled {
+		color.White("  • 启用状态: %s", color.YellowString("未启用"))
+	} else {
+		color.White("  • 启用状态: %s", color.GreenString("已启用"))
+		if keyring, err := cfg.Encryption.Keyring(); err != nil || !keyring.Enabled() {
+			color.White("  • 加密: %s", color.RedString("需要启用静态加密"))
+		} else {
+			color.White("  • 加密: %s", color.GreenString("静态加密主密钥"))
+		}
+		color.White("  • 提前刷新时间: %s", color.GreenString(fmt.Sprintf("%d秒", cfg.Vault.RefreshSkew)))
+	}
 
 	color.Green("\n📊 日志配置:")
 	color.White("  • 日志级别: %s", color.GreenString(cfg.LogLevel))
@@ -167,19 +425,73 @@ func showConfig(cmd *cobra.Command, args []string) {
 	color.Green("\n🌍 环境变量:")
 	envVars := []string{
 		"OAUTH_PROXY_API_KEY",
+		"OAUTH_PROXY_API_KEY_PEPPER",
 		"OAUTH_PROXY_PORT",
 		"OAUTH_PROXY_ENVIRONMENT",
 		"OAUTH_PROXY_LOG_LEVEL",
 		"OAUTH_PROXY_TIMEOUT",
 		"OAUTH_PROXY_IP_WHITELIST",
+		"OAUTH_PROXY_TRUSTED_PROXIES",
+		"OAUTH_PROXY_FORWARDED_HEADER",
+		"OAUTH_PROXY_AUTH_MODE",
+		"OAUTH_PROXY_BRUTE_FORCE_ENABLED",
+		"OAUTH_PROXY_BRUTE_FORCE_MAX_FAILURES",
+		"OAUTH_PROXY_BRUTE_FORCE_WINDOW",
+		"OAUTH_PROXY_BRUTE_FORCE_BAN_DURATION",
+		"OAUTH_PROXY_ADMIN_API_KEY",
+		"OAUTH_PROXY_METRICS_ENABLED",
+		"OAUTH_PROXY_METRICS_PATH",
+		"OAUTH_PROXY_METRICS_LISTEN",
+		"OAUTH_PROXY_METRICS_REQUIRE_ADMIN_KEY",
+		"OAUTH_PROXY_TLS_CERT_FILE",
+		"OAUTH_PROXY_TLS_KEY_FILE",
+		"OAUTH_PROXY_TLS_MIN_VERSION",
+		"OAUTH_PROXY_TLS_CIPHER_SUITES",
+		"OAUTH_PROXY_TLS_CLIENT_CA_FILE",
+		"OAUTH_PROXY_SHUTDOWN_DRAIN_TIMEOUT",
+		"OAUTH_PROXY_SHUTDOWN_DELAY",
+		"OAUTH_PROXY_TRACING_ENABLED",
+		"OAUTH_PROXY_TRACING_ENDPOINT",
+		"OAUTH_PROXY_TRACING_SERVICE_NAME",
+		"OAUTH_PROXY_TRACING_SAMPLE_RATIO",
+		"OAUTH_PROXY_RATE_LIMIT_ENABLED",
+		"OAUTH_PROXY_RATE_LIMIT_PER_KEY_REQUESTS_PER_MINUTE",
+		"OAUTH_PROXY_RATE_LIMIT_PER_KEY_BURST",
+		"OAUTH_PROXY_RATE_LIMIT_PER_IP_REQUESTS_PER_MINUTE",
+		"OAUTH_PROXY_RATE_LIMIT_PER_IP_BURST",
+		"OAUTH_PROXY_UPSTREAM_AUTH_URL",
+		"OAUTH_PROXY_UPSTREAM_TOKEN_URL",
+		"OAUTH_PROXY_UPSTREAM_USERINFO_URL",
+		"OAUTH_PROXY_UPSTREAM_TOKENINFO_URL",
+		"OAUTH_PROXY_UPSTREAM_REVOKE_URL",
+		"OAUTH_PROXY_UPSTREAM_DEVICE_CODE_URL",
+		"OAUTH_PROXY_EGRESS_PROXY_URL",
+		"OAUTH_PROXY_EGRESS_PROXY_USERNAME",
+		"OAUTH_PROXY_EGRESS_PROXY_PASSWORD",
+		"OAUTH_PROXY_PKCE_PROXY_GENERATE",
+		"OAUTH_PROXY_CLIENT_POLICY_REQUIRE_REGISTERED",
+		"OAUTH_PROXY_CLIENT_POLICY_FORBIDDEN_SCOPES",
+		"OAUTH_PROXY_VAULT_ENABLED",
+		"OAUTH_PROXY_STORAGE_BACKEND",
+		"OAUTH_PROXY_STORAGE_PATH",
+		"OAUTH_PROXY_ENCRYPTION_MASTER_KEY",
+		"OAUTH_PROXY_ENCRYPTION_KEY_FILE",
+		"OAUTH_PROXY_ENCRYPTION_PASSPHRASE",
 	}
 
 	for _, envVar := range envVars {
 		value := os.Getenv(envVar)
 		if value != "" {
 			// 脱敏处理敏感环境变量
-			if envVar == "OAUTH_PROXY_API_KEY" && len(value) > 8 {
-				value = fmt.Sprintf("%s****%s", value[:4], value[len(value)-4:])
+			if envVar == "OAUTH_PROXY_API_KEY" || envVar == "OAUTH_PROXY_ADMIN_API_KEY" {
+				value = apikey.Display(value)
+			}
+			if envVar == "OAUTH_PROXY_API_KEY_PEPPER" || envVar == "OAUTH_PROXY_EGRESS_PROXY_PASSWORD" ||
+				envVar == "OAUTH_PROXY_ENCRYPTION_MASTER_KEY" || envVar == "OAUTH_PROXY_ENCRYPTION_PASSPHRASE" {
+				value = "****"
+			}
+			if envVar == "OAUTH_PROXY_EGRESS_PROXY_URL" {
+				value = egress.ProxySettings{URL: value}.String()
 			}
 			color.White("  • %s: %s", envVar, color.GreenString(value))
 		} else {
@@ -189,20 +501,22 @@ func showConfig(cmd *cobra.Command, args []string) {
 
 	// 显示缓存信息
 	color.Green("\n💾 配置缓存信息:")
-	cache, err := config.NewConfigCache()
+	cache, err := config.NewConfigCache(cfg)
 	if err != nil {
 		color.White("  • 缓存状态: %s", color.RedString("无法访问"))
 		color.White("  • 错误信息: %s", color.RedString(err.Error()))
-	} else if !cache.CacheExists() {
-		color.White("  • 缓存状态: %s", color.YellowString("不存在"))
-		color.White("  • 缓存位置: %s", color.BlueString(cache.GetCacheFile()))
 	} else {
-		color.White("  • 缓存状态: %s", color.GreenString("存在"))
-		color.White("  • 缓存位置: %s", color.BlueString(cache.GetCacheFile()))
-
-		if cacheInfo, err := cache.GetCacheInfo(); err == nil {
-			color.White("  • 缓存创建: %s", color.MagentaString(cacheInfo.CreatedAt.Format("2006-01-02 15:04:05")))
-			color.White("  • 最后使用: %s", color.MagentaString(cacheInfo.LastUsed.Format("2006-01-02 15:04:05")))
+		defer cache.Close()
+		if !cache.CacheExists() {
+			color.White("  • 缓存状态: %s", color.YellowString("不存在"))
+			color.White("  • 缓存位置: %s", color.BlueString(cache.GetCacheFile()))
+		} else {
+			color.White("  • 缓存状态: %s", color.GreenString("存在"))
+			color.White("  • 缓存位置: %s", color.BlueString(cache.GetCacheFile()))
+			if entry, err := cache.DefaultAPIKey(); err == nil {
+				color.White("  • 缓存API Key: %s", color.GreenString(apikey.Display(entry.Hash)))
+				color.White("  • 缓存创建: %s", color.MagentaString(entry.CreatedAt.Format("2006-01-02 15:04:05")))
+			}
 		}
 	}
 
@@ -222,6 +536,7 @@ func validateConfig(cmd *cobra.Command, args []string) {
 
 	// 验证必需的配置项
 	errors := []string{}
+	warnings := []string{}
 
 	// 验证鉴权配置
 	hasAPIKey := cfg.APIKey != ""
@@ -229,8 +544,9 @@ func validateConfig(cmd *cobra.Command, args []string) {
 
 	// 如果配置中没有API Key，检查缓存中是否有
 	if !hasAPIKey {
-		if cache, err := config.NewConfigCache(); err == nil && cache.CacheExists() {
-			hasAPIKey = true
+		if cache, err := config.NewConfigCache(cfg); err == nil {
+			hasAPIKey = cache.CacheExists()
+			cache.Close()
 		}
 	}
 
@@ -291,6 +607,158 @@ func validateConfig(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	// 验证鉴权组合策略
+	if err := cfg.Auth.Validate(); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的鉴权组合策略: %v", err))
+	}
+
+	// 验证API Key pepper：生产环境不允许明文保存的pepper文件
+	if keyring, err := cfg.Encryption.Keyring(); err == nil {
+		if err := cfg.ValidateAPIKeyPepper(keyring); err != nil {
+			errors = append(errors, fmt.Sprintf("无效的API Key pepper配置: %v", err))
+		} else if cfg.APIKeyPepper == "" && !keyring.Enabled() {
+			warnings = append(warnings, "API Key pepper以明文保存在缓存目录中，建议配置 api_key_pepper 或启用静态加密")
+		}
+	}
+
+	// 验证受信任的代理
+	if _, err := middleware.ParseTrustedProxies(cfg.TrustedProxies); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的受信任代理配置: %v", err))
+	}
+	if _, err := middleware.ParseForwardedHeader(cfg.ForwardedHeader); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的转发头配置: %v", err))
+	}
+	if warning := forwardedProtoWarning(cfg); warning != "" {
+		warnings = append(warnings, warning)
+	}
+
+	// 验证认证失败封禁配置
+	if err := middleware.ValidateBruteForceConfig(cfg.BruteForce); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的认证失败封禁配置: %v", err))
+	}
+
+	// 验证指标配置
+	if err := handler.ValidateMetricsConfig(cfg); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的指标配置: %v", err))
+	}
+
+	// 验证TLS配置
+	if err := tlsreload.ValidateConfig(cfg.TLS); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的TLS配置: %v", err))
+	} else if cfg.TLS.Enabled() {
+		if reloader, err := tlsreload.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile); err != nil {
+			errors = append(errors, fmt.Sprintf("无法加载TLS证书: %v", err))
+		} else if _, err := tlsreload.ServerConfig(cfg.TLS, reloader); err != nil {
+			errors = append(errors, fmt.Sprintf("无法加载客户端CA: %v", err))
+		}
+	}
+
+	// 验证优雅停机配置
+	if err := cfg.Shutdown.Validate(); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的优雅停机配置: %v", err))
+	}
+
+	// 验证追踪配置
+	if err := tracing.ValidateConfig(cfg.Tracing); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的追踪配置: %v", err))
+	}
+
+	// 验证限流配置
+	if err := middleware.ValidateRateLimitConfig(cfg.RateLimit); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的限流配置: %v", err))
+	}
+
+	// 验证上游端点URL
+	endpoints := cfg.Upstream.WithDefaults().Endpoints()
+	endpointNames := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		endpointNames = append(endpointNames, name)
+	}
+	sort.Strings(endpointNames)
+	for _, name := range endpointNames {
+		endpoint := endpoints[name]
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errors = append(errors, fmt.Sprintf("无效的上游端点 upstream.%s: %s", name, endpoint))
+		}
+	}
+
+	// 验证出站代理配置
+	for _, name := range config.UpstreamNames {
+		settings := egress.ProxySettings{URL: cfg.EgressProxy.ProxyURLFor(name)}
+		if err := settings.Validate(); err != nil {
+			errors = append(errors, fmt.Sprintf("无效的出站代理 (%s): %v", name, err))
+		}
+	}
+	for name := range cfg.EgressProxy.Upstreams {
+		known := false
+		for _, upstreamName := range config.UpstreamNames {
+			if name == upstreamName {
+				known = true
+				break
+			}
+		}
+		if !known {
+			errors = append(errors, fmt.Sprintf("未知的上游端点 egress_proxy.upstreams.%s (有效值: %s)", name, strings.Join(config.UpstreamNames, ", ")))
+		}
+	}
+
+	// 验证出站线路池配置
+	if err := egress.ValidateRoutes(cfg.EgressPool.Routes); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的出站线路池配置: %v", err))
+	}
+	if len(cfg.EgressPool.Routes) > 0 && cfg.EgressPool.HealthCheckInterval <= 0 {
+		errors = append(errors, fmt.Sprintf("无效的健康探测间隔: %d (必须大于0)", cfg.EgressPool.HealthCheckInterval))
+	}
+
+	// 验证PKCE配置
+	if cfg.PKCE.ProxyGenerate && cfg.PKCE.VerifierTTL <= 0 {
+		errors = append(errors, fmt.Sprintf("无效的code_verifier有效期: %d (必须大于0)", cfg.PKCE.VerifierTTL))
+	}
+
+	// 验证额外授权参数配置
+	if err := handler.ValidateAuthParamsConfig(cfg.AuthParams); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的额外授权参数配置: %v", err))
+	}
+
+	// 验证登记的OAuth客户端
+	if _, err := oauthclient.NewRegistry(cfg.Clients, cfg.ClientPolicy); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的OAuth客户端配置: %v", err))
+	}
+
+	// 验证服务账号密钥
+	if _, err := serviceaccount.NewRegistry(cfg.ServiceAccounts); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的服务账号配置: %v", err))
+	}
+
+	// 验证静态加密主密钥
+	if _, err := cfg.Encryption.Keyring(); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的静态加密配置: %v", err))
+	}
+
+	// 验证状态存储配置
+	if err := store.ValidateBackend(cfg.Storage.Backend); err != nil {
+		errors = append(errors, fmt.Sprintf("无效的状态存储配置: %v", err))
+	}
+
+	// 验证保险库配置
+	if cfg.Vault.Enabled {
+		if keyring, err := cfg.Encryption.Keyring(); err == nil && !keyring.Enabled() {
+			errors = append(errors, "无效的保险库配置: 保险库需要启用静态加密（encryption.master_key、key_file 或 passphrase）")
+		}
+		if cfg.Vault.RefreshSkew < 0 {
+			errors = append(errors, fmt.Sprintf("无效的提前刷新时间: %d (不能小于0)", cfg.Vault.RefreshSkew))
+		}
+	}
+
+	// 显示警告（不影响验证结果）
+	if len(warnings) > 0 {
+		color.Yellow("⚠️  发现 %d 个警告:", len(warnings))
+		for i, warning := range warnings {
+			color.Yellow("   %d. %s", i+1, warning)
+		}
+	}
+
 	// 显示验证结果
 	if len(errors) > 0 {
 		color.Red("❌ 配置验证失败，发现 %d 个错误:", len(errors))
@@ -313,7 +781,7 @@ func validateConfig(cmd *cobra.Command, args []string) {
 		// 显示鉴权配置摘要
 		if cfg.APIKey != "" {
 			color.White("   • API Key: 已配置")
-		} else if cache, err := config.NewConfigCache(); err == nil && cache.CacheExists() {
+		} else if hasAPIKey {
 			color.White("   • API Key: 已缓存")
 		}
 		if len(cfg.IPWhitelist) > 0 {
@@ -322,18 +790,19 @@ func validateConfig(cmd *cobra.Command, args []string) {
 
 		// 验证缓存配置
 		color.Cyan("\n💾 缓存验证:")
-		cache, err := config.NewConfigCache()
+		cache, err := config.NewConfigCache(cfg)
 		if err != nil {
 			color.White("   • 缓存访问: %s", color.RedString("失败"))
 			color.White("   • 错误信息: %s", color.RedString(err.Error()))
-		} else if !cache.CacheExists() {
-			color.White("   • 缓存状态: %s", color.YellowString("不存在"))
-			color.White("   • 说明: 首次启动时将自动创建")
 		} else {
-			if err := cache.ValidateCache(); err != nil {
+			defer cache.Close()
+			if !cache.CacheExists() {
+				color.White("   • 缓存状态: %s", color.YellowString("不存在"))
+				color.White("   • 说明: 首次启动时将自动创建")
+			} else if err := cache.ValidateCache(); err != nil {
 				color.White("   • 缓存验证: %s", color.RedString("失败"))
 				color.White("   • 错误信息: %s", color.RedString(err.Error()))
-				errors = append(errors, fmt.Sprintf("缓存文件验证失败: %v", err))
+				errors = append(errors, fmt.Sprintf("缓存验证失败: %v", err))
 			} else {
 				color.White("   • 缓存验证: %s", color.GreenString("通过"))
 			}
@@ -345,48 +814,55 @@ func showCacheInfo(cmd *cobra.Command, args []string) {
 	color.Cyan("💾 正在加载配置缓存信息...")
 
 	// 创建配置缓存管理器
-	cache, err := config.NewConfigCache()
+	cache, err := openConfigCache()
 	if err != nil {
 		color.Red("❌ 创建配置缓存管理器失败: %v", err)
 		return
 	}
+	defer cache.Close()
 
 	// 检查缓存是否存在
 	if !cache.CacheExists() {
 		color.Yellow("📭 配置缓存不存在")
 		color.White("   • 缓存目录: %s", color.BlueString(cache.GetCacheDir()))
-		color.White("   • 缓存文件: %s", color.BlueString(cache.GetCacheFile()))
+		color.White("   • 状态存储: %s", color.BlueString(cache.GetCacheFile()))
 		color.White("   • 状态: %s", color.RedString("不存在"))
 		color.Cyan("\n💡 提示: 启动服务器时将自动生成API Key并创建缓存")
 		return
 	}
 
 	// 获取缓存信息
-	cacheInfo, err := cache.GetCacheInfo()
+	entry, err := cache.DefaultAPIKey()
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		color.Red("❌ 读取缓存信息失败: %v", err)
+		return
+	}
+	keys, err := cache.ListAPIKeys()
 	if err != nil {
 		color.Red("❌ 读取缓存信息失败: %v", err)
 		return
 	}
 
 	// 显示缓存信息
-	color.Green("\n📁 缓存文件信息:")
+	color.Green("\n📁 缓存信息:")
 	color.White("  • 缓存目录: %s", color.BlueString(cache.GetCacheDir()))
-	color.White("  • 缓存文件: %s", color.BlueString(cache.GetCacheFile()))
-	color.White("  • 文件状态: %s", color.GreenString("存在"))
+	color.White("  • 状态存储: %s", color.BlueString(cache.GetCacheFile()))
+	color.White("  • 保存方式: %s", color.GreenString("加盐哈希（HMAC-SHA256），只显示前缀"))
 
 	color.Green("\n🔑 API Key信息:")
-	// 脱敏显示API Key
-	apiKeyDisplay := "****"
-	if len(cacheInfo.APIKey) > 8 {
-		apiKeyDisplay = fmt.Sprintf("%s****%s", cacheInfo.APIKey[:8], cacheInfo.APIKey[len(cacheInfo.APIKey)-4:])
+	if entry != nil {
+		color.White("  • API Key: %s", color.GreenString(apikey.Display(entry.Hash)))
+		if entry.InGracePeriod(time.Now()) {
+			color.White("  • 轮换前的API Key: %s，宽限期至 %s", apikey.Display(entry.PreviousHash),
+				color.YellowString(entry.PreviousExpiresAt.Format("2006-01-02 15:04:05")))
+		}
+		color.White("  • 创建时间: %s", color.MagentaString(entry.CreatedAt.Format("2006-01-02 15:04:05")))
+	} else {
+		color.White("  • API Key: %s", color.YellowString("未生成"))
+	}
+	if len(keys) > 0 {
+		color.White("  • 命名API Key: %s", color.GreenString(fmt.Sprintf("%d个", len(keys))))
 	}
-	color.White("  • API Key: %s", color.GreenString(apiKeyDisplay))
-	color.White("  • 版本: %s", color.CyanString(cacheInfo.Version))
-	color.White("  • 描述: %s", color.YellowString(cacheInfo.Description))
-
-	color.Green("\n⏰ 时间信息:")
-	color.White("  • 创建时间: %s", color.MagentaString(cacheInfo.CreatedAt.Format("2006-01-02 15:04:05")))
-	color.White("  • 最后使用: %s", color.MagentaString(cacheInfo.LastUsed.Format("2006-01-02 15:04:05")))
 
 	// 验证缓存完整性
 	if err := cache.ValidateCache(); err != nil {
@@ -402,31 +878,31 @@ func clearCache(cmd *cobra.Command, args []string) {
 	color.Cyan("🗑️  正在清除配置缓存...")
 
 	// 创建配置缓存管理器
-	cache, err := config.NewConfigCache()
+	cache, err := openConfigCache()
 	if err != nil {
 		color.Red("❌ 创建配置缓存管理器失败: %v", err)
 		return
 	}
+	defer cache.Close()
 
 	// 检查缓存是否存在
 	if !cache.CacheExists() {
 		color.Yellow("📭 配置缓存不存在，无需清除")
-		color.White("   • 缓存文件: %s", color.BlueString(cache.GetCacheFile()))
+		color.White("   • 状态存储: %s", color.BlueString(cache.GetCacheFile()))
 		return
 	}
 
 	// 显示将要清除的信息
 	color.Yellow("\n⚠️  即将清除以下缓存:")
-	color.White("   • 缓存文件: %s", color.BlueString(cache.GetCacheFile()))
+	color.White("   • 状态存储: %s", color.BlueString(cache.GetCacheFile()))
 
 	// 获取缓存信息用于显示
-	if cacheInfo, err := cache.GetCacheInfo(); err == nil {
-		apiKeyDisplay := "****"
-		if len(cacheInfo.APIKey) > 8 {
-			apiKeyDisplay = fmt.Sprintf("%s****%s", cacheInfo.APIKey[:8], cacheInfo.APIKey[len(cacheInfo.APIKey)-4:])
-		}
-		color.White("   • API Key: %s", color.RedString(apiKeyDisplay))
-		color.White("   • 创建时间: %s", color.RedString(cacheInfo.CreatedAt.Format("2006-01-02 15:04:05")))
+	if entry, err := cache.DefaultAPIKey(); err == nil {
+		color.White("   • API Key: %s", color.RedString(apikey.Display(entry.Hash)))
+		color.White("   • 创建时间: %s", color.RedString(entry.CreatedAt.Format("2006-01-02 15:04:05")))
+	}
+	if keys, err := cache.ListAPIKeys(); err == nil && len(keys) > 0 {
+		color.White("   • 命名API Key: %s", color.RedString(fmt.Sprintf("%d个", len(keys))))
 	}
 
 	// 执行清除操作
@@ -438,3 +914,15 @@ func clearCache(cmd *cobra.Command, args []string) {
 	color.Green("✅ 配置缓存已成功清除")
 	color.Cyan("💡 下次启动服务器时将重新生成新的API Key")
 }
+
+// formatRateLimitRule 格式化限流规则用于展示
+func formatRateLimitRule(rule config.RateLimitRule) string {
+	if rule.RequestsPerMinute <= 0 {
+		return color.YellowString("不限制")
+	}
+	burst := rule.Burst
+	if burst == 0 {
+		burst = rule.RequestsPerMinute
+	}
+	return color.GreenString(fmt.Sprintf("%d次/分钟 (突发%d次)", rule.RequestsPerMinute, burst))
+}
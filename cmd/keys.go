@@ -0,0 +1,394 @@
+package cmd
+
+import (
+	"fmt"
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/config"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	keyOwner   string
+	keyExpires string
+	keyRoutes  []string
+	keyCIDRs   []string
+	keyGrace   time.Duration
+)
+
+// keysCmd represents the keys command
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "命名API Key管理命令",
+	Long: color.New(color.FgBlue).Sprint("🔑 命名API Key管理") + `
+
+为不同的调用方分别签发API Key，每个Key可以设置：
+• 所有者（用于日志审计）
+• 过期时间
+• 允许访问的路径
+• 允许的来源地址（CIDR）
+
+命名API Key保存在状态存储中（storage，默认 ~/.gmail-oauth-proxy/state.json），只保存加盐哈希和可见前缀，
+吊销后运行中的服务器会自动重新加载，无需重启。
+
+子命令:
+  create  创建命名API Key
+  list    列出所有命名API Key
+  show    显示命名API Key详情
+  revoke  吊销命名API Key
+  rotate  轮换API Key（旧密钥在宽限期内仍然有效）
+  hash    计算API Key哈希（用于配置文件中的 api_key）
+
+示例:
+  gmail-oauth-proxy keys create ci --owner ops@example.com --expires 30d
+  gmail-oauth-proxy keys create billing --routes '/v1/accounts/*/access_token' --cidrs 10.0.0.0/8
+  gmail-oauth-proxy keys list
+  gmail-oauth-proxy keys revoke ci
+  gmail-oauth-proxy keys rotate ci --grace 72h
+  gmail-oauth-proxy keys rotate                # 轮换自动生成的默认API Key`,
+}
+
+// keysCreateCmd represents the keys create command
+var keysCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "创建命名API Key",
+	Long: color.New(color.FgGreen).Sprint("➕ 创建命名API Key") + `
+
+生成新的API Key并保存到配置缓存。密钥只在创建时显示一次，请妥善保存。
+
+--expires 支持时长（如 720h、30d）或日期（如 2025-12-31）。
+--routes 支持 path.Match 通配符（如 /v1/accounts/*/access_token）。`,
+	Args: cobra.ExactArgs(1),
+	Run:  createAPIKey,
+}
+
+// keysListCmd represents the keys list command
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "列出所有命名API Key",
+	Run:   listAPIKeys,
+}
+
+// keysShowCmd represents the keys show command
+var keysShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "显示命名API Key详情",
+	Args:  cobra.ExactArgs(1),
+	Run:   showAPIKey,
+}
+
+// keysRevokeCmd represents the keys revoke command
+var keysRevokeCmd = &cobra.Command{
+	Use:   "revoke <name>",
+	Short: "吊销命名API Key",
+	Long: color.New(color.FgRed).Sprint("🚫 吊销命名API Key") + `
+
+吊销后该Key立即失效（运行中的服务器在1秒内重新加载），记录保留用于审计。`,
+	Args: cobra.ExactArgs(1),
+	Run:  revokeAPIKey,
+}
+
+// keysRotateCmd represents the keys rotate command
+var keysRotateCmd = &cobra.Command{
+	Use:   "rotate [name]",
+	Short: "轮换API Key",
+	Long: color.New(color.FgYellow).Sprint("🔄 轮换API Key") + `
+
+为API Key生成新密钥，旧密钥在宽限期（--grace，默认24小时）内仍然有效，
+期间使用旧密钥的请求会记录弃用警告，宽限期结束后旧密钥自动失效。
+运行中的服务器会自动重新加载，无需重启。
+
+不指定名称时轮换自动生成并缓存的默认API Key（通过 --api-key、OAUTH_PROXY_API_KEY
+或配置文件设置的API Key请自行更换）。--grace 0 使旧密钥立即失效。`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  rotateAPIKey,
+}
+
+// keysHashCmd represents the keys hash command
+var keysHashCmd = &cobra.Command{
+	Use:   "hash [key]",
+	Short: "计算API Key哈希",
+	Long: color.New(color.FgCyan).Sprint("#️⃣  计算API Key哈希") + `
+
+计算API Key的加盐哈希，可以代替明文写入配置文件的 api_key 或 OAUTH_PROXY_API_KEY。
+未提供密钥时生成新的随机API Key。
+
+哈希使用服务端pepper（api_key_pepper 或缓存目录中的 pepper 文件）计算，
+请在运行服务器的环境中执行，更换pepper后需要重新计算。`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  hashAPIKey,
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysCreateCmd)
+	keysCmd.AddCommand(keysListCmd)
+	keysCmd.AddCommand(keysShowCmd)
+	keysCmd.AddCommand(keysRevokeCmd)
+	keysCmd.AddCommand(keysRotateCmd)
+	keysCmd.AddCommand(keysHashCmd)
+
+	keysCreateCmd.Flags().StringVar(&keyOwner, "owner", "", "所有者（如邮箱或服务名称）")
+	keysCreateCmd.Flags().StringVar(&keyExpires, "expires", "", "过期时间：时长（如 720h、30d）或日期（如 2025-12-31），默认永不过期")
+	keysCreateCmd.Flags().StringSliceVar(&keyRoutes, "routes", nil, "允许访问的路径，多个用逗号分隔，默认不限制")
+	keysCreateCmd.Flags().StringSliceVar(&keyCIDRs, "cidrs", nil, "允许的来源地址（CIDR或IP），多个用逗号分隔，默认不限制")
+
+	keysRotateCmd.Flags().DurationVar(&keyGrace, "grace", config.DefaultRotationGrace, "旧密钥的宽限期，0表示立即失效")
+}
+
+// openConfigCache 按当前配置打开保存API Key的状态存储，使用完毕后需要调用Close
+func openConfigCache() (*config.ConfigCache, error) {
+	cfg, err := config.LoadForDisplay()
+	if err != nil {
+		return nil, err
+	}
+	return config.NewConfigCache(cfg)
+}
+
+func createAPIKey(cmd *cobra.Command, args []string) {
+	cache, err := openConfigCache()
+	if err != nil {
+		color.Red("❌ 创建配置缓存管理器失败: %v", err)
+		return
+	}
+	defer cache.Close()
+
+	entry := config.APIKeyEntry{
+		Name:   args[0],
+		Owner:  keyOwner,
+		Routes: keyRoutes,
+		CIDRs:  keyCIDRs,
+	}
+	if keyExpires != "" {
+		if entry.ExpiresAt, err = parseExpiry(keyExpires, time.Now()); err != nil {
+			color.Red("❌ %v", err)
+			return
+		}
+	}
+
+	key, created, err := cache.CreateAPIKey(entry)
+	if err != nil {
+		color.Red("❌ 创建API Key失败: %v", err)
+		return
+	}
+
+	color.Green("✅ 已创建API Key: %s", created.Name)
+	printAPIKey(*created)
+	color.Cyan("\n🔑 API Key（仅显示一次，请妥善保存）:")
+	color.White("   %s", color.YellowString(key))
+	color.Cyan("\n💡 使用方式:")
+	color.White("   curl -H 'X-API-Key: %s' ...", key)
+}
+
+func listAPIKeys(cmd *cobra.Command, args []string) {
+	cache, err := openConfigCache()
+	if err != nil {
+		color.Red("❌ 创建配置缓存管理器失败: %v", err)
+		return
+	}
+	defer cache.Close()
+	keys, err := cache.ListAPIKeys()
+	if err != nil {
+		color.Red("❌ 读取API Key失败: %v", err)
+		return
+	}
+	if len(keys) == 0 {
+		color.Yellow("📭 没有命名API Key")
+		color.Cyan("\n💡 提示: 使用 'gmail-oauth-proxy keys create <name>' 创建")
+		return
+	}
+
+	color.Green("🔑 命名API Key (%d):", len(keys))
+	now := time.Now()
+	for _, key := range keys {
+		owner := key.Owner
+		if owner == "" {
+			owner = "-"
+		}
+		expires := "永不过期"
+		if !key.ExpiresAt.IsZero() {
+			expires = key.ExpiresAt.Format("2006-01-02 15:04")
+		}
+		color.White("  • %-20s %s  所有者: %s  过期: %s  密钥: %s",
+			key.Name, formatKeyStatus(key.Status(now)), owner, expires, apikey.Display(key.Hash))
+	}
+}
+
+func showAPIKey(cmd *cobra.Command, args []string) {
+	cache, err := openConfigCache()
+	if err != nil {
+		color.Red("❌ 创建配置缓存管理器失败: %v", err)
+		return
+	}
+	defer cache.Close()
+	key, err := cache.GetNamedAPIKey(args[0])
+	if err != nil {
+		color.Red("❌ %v", err)
+		return
+	}
+	color.Green("🔑 API Key: %s", key.Name)
+	printAPIKey(*key)
+}
+
+func revokeAPIKey(cmd *cobra.Command, args []string) {
+	cache, err := openConfigCache()
+	if err != nil {
+		color.Red("❌ 创建配置缓存管理器失败: %v", err)
+		return
+	}
+	defer cache.Close()
+	if err := cache.RevokeAPIKey(args[0]); err != nil {
+		color.Red("❌ 吊销API Key失败: %v", err)
+		return
+	}
+	color.Green("✅ 已吊销API Key: %s", args[0])
+	color.White("   • 运行中的服务器将自动重新加载，无需重启")
+}
+
+func rotateAPIKey(cmd *cobra.Command, args []string) {
+	if keyGrace < 0 {
+		color.Red("❌ 宽限期不能为负数")
+		return
+	}
+	cache, err := openConfigCache()
+	if err != nil {
+		color.Red("❌ 创建配置缓存管理器失败: %v", err)
+		return
+	}
+	defer cache.Close()
+
+	var key string
+	var rotated *config.APIKeyEntry
+	if len(args) > 0 {
+		key, rotated, err = cache.RotateAPIKey(args[0], keyGrace)
+	} else {
+		if viper.GetString("api_key") != "" {
+			color.Yellow("⚠️  当前通过配置设置了API Key，服务器不会使用缓存中的默认API Key")
+		}
+		key, rotated, err = cache.RotateDefaultAPIKey(keyGrace)
+	}
+	if err != nil {
+		color.Red("❌ 轮换API Key失败: %v", err)
+		return
+	}
+
+	color.Green("✅ 已轮换API Key: %s", rotated.Name)
+	color.White("  • 新密钥: %s", apikey.Display(rotated.Hash))
+	if rotated.PreviousHash != "" {
+		color.White("  • 旧密钥: %s，宽限期至 %s", apikey.Display(rotated.PreviousHash),
+			color.YellowString(rotated.PreviousExpiresAt.Format("2006-01-02 15:04:05")))
+	} else {
+		color.White("  • 旧密钥: %s", color.RedString("已立即失效"))
+	}
+	color.Cyan("\n🔑 新的API Key（仅显示一次，请妥善保存）:")
+	color.White("   %s", color.YellowString(key))
+	color.White("   运行中的服务器将自动重新加载，请在宽限期结束前更新所有客户端")
+}
+
+func hashAPIKey(cmd *cobra.Command, args []string) {
+	cache, err := openConfigCache()
+	if err != nil {
+		color.Red("❌ 创建配置缓存管理器失败: %v", err)
+		return
+	}
+	defer cache.Close()
+	hasher, err := cache.Hasher()
+	if err != nil {
+		color.Red("❌ 加载API Key pepper失败: %v", err)
+		return
+	}
+
+	key := ""
+	if len(args) > 0 {
+		key = args[0]
+	} else {
+		if key, err = apikey.Generate(); err != nil {
+			color.Red("❌ %v", err)
+			return
+		}
+		color.Cyan("🔑 已生成新的API Key（仅显示一次，请妥善保存）:")
+		color.White("   %s", color.YellowString(key))
+	}
+
+	hash, err := hasher.Hash(key)
+	if err != nil {
+		color.Red("❌ 计算哈希失败: %v", err)
+		return
+	}
+	color.Cyan("\n#️⃣  API Key哈希:")
+	color.White("   api_key: \"%s\"", hash)
+}
+
+// printAPIKey 显示命名API Key的元数据（密钥脱敏）
+func printAPIKey(key config.APIKeyEntry) {
+	now := time.Now()
+	color.White("  • 状态: %s", formatKeyStatus(key.Status(now)))
+	color.White("  • 密钥: %s", apikey.Display(key.Hash))
+	if key.Owner != "" {
+		color.White("  • 所有者: %s", color.CyanString(key.Owner))
+	}
+	color.White("  • 创建时间: %s", key.CreatedAt.Format("2006-01-02 15:04:05"))
+	if key.ExpiresAt.IsZero() {
+		color.White("  • 过期时间: %s", color.GreenString("永不过期"))
+	} else {
+		color.White("  • 过期时间: %s", key.ExpiresAt.Format("2006-01-02 15:04:05"))
+	}
+	if !key.RotatedAt.IsZero() {
+		color.White("  • 轮换时间: %s", key.RotatedAt.Format("2006-01-02 15:04:05"))
+	}
+	if key.InGracePeriod(now) {
+		color.White("  • 旧密钥: %s，宽限期至 %s", apikey.Display(key.PreviousHash),
+			color.YellowString(key.PreviousExpiresAt.Format("2006-01-02 15:04:05")))
+	}
+	if !key.RevokedAt.IsZero() {
+		color.White("  • 吊销时间: %s", color.RedString(key.RevokedAt.Format("2006-01-02 15:04:05")))
+	}
+	if len(key.Routes) > 0 {
+		color.White("  • 允许路径: %s", strings.Join(key.Routes, ", "))
+	} else {
+		color.White("  • 允许路径: %s", color.YellowString("不限制"))
+	}
+	if len(key.CIDRs) > 0 {
+		color.White("  • 允许来源: %s", strings.Join(key.CIDRs, ", "))
+	} else {
+		color.White("  • 允许来源: %s", color.YellowString("不限制"))
+	}
+}
+
+// formatKeyStatus 带颜色的API Key状态
+func formatKeyStatus(status string) string {
+	switch status {
+	case "active":
+		return color.GreenString("可用")
+	case "expired":
+		return color.YellowString("已过期")
+	default:
+		return color.RedString("已吊销")
+	}
+}
+
+// parseExpiry 解析过期时间：时长（支持 d 表示天）或日期
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	if strings.HasSuffix(value, "d") {
+		if days, err := strconv.Atoi(strings.TrimSuffix(value, "d")); err == nil && days > 0 {
+			return now.AddDate(0, 0, days), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return now.Add(d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			if !t.After(now) {
+				return time.Time{}, fmt.Errorf("expiry %q is in the past", value)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %q: use a duration like 720h or 30d, or a date like 2025-12-31", value)
+}
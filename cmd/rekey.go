@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/secret"
+	"gmail-oauth-proxy-server/internal/store"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rekeyNewKey        string
+	rekeyNewKeyFile    string
+	rekeyNewPassphrase string
+	rekeyGenerate      bool
+	rekeyDecrypt       bool
+)
+
+// configRekeyCmd represents the config rekey command
+var configRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "轮换静态加密主密钥",
+	Long: color.New(color.FgMagenta).Sprint("🔑 轮换静态加密主密钥") + `
+
+使用新的主密钥重新加密状态存储中的所有数据（API Key哈希和刷新令牌保险库中的凭据）
+以及自动生成的API Key pepper文件。
+
+当前主密钥从配置读取（encryption.master_key / key_file / passphrase 或对应的环境变量），
+新主密钥通过参数提供。采用信封加密，轮换时只重新包装数据密钥，数据本身不重新加密。
+未配置当前主密钥时，现有的明文数据将使用新主密钥加密。
+
+轮换前请停止服务器；轮换完成后更新配置中的主密钥再启动。中断后可使用相同参数重新执行。
+
+示例:
+  gmail-oauth-proxy config rekey --generate                       # 生成新的随机主密钥
+  gmail-oauth-proxy config rekey --new-key-file /etc/gop/master.key
+  gmail-oauth-proxy config rekey --decrypt                        # 解密为明文（停用静态加密）`,
+	Run: rekeyConfig,
+}
+
+func init() {
+	configCmd.AddCommand(configRekeyCmd)
+
+	configRekeyCmd.Flags().StringVar(&rekeyNewKey, "new-key", "", "新的主密钥（base64编码的32字节）")
+	configRekeyCmd.Flags().StringVar(&rekeyNewKeyFile, "new-key-file", "", "保存新主密钥的文件路径")
+	configRekeyCmd.Flags().StringVar(&rekeyNewPassphrase, "new-passphrase", "", "新的口令（使用scrypt派生主密钥）")
+	configRekeyCmd.Flags().BoolVar(&rekeyGenerate, "generate", false, "生成新的随机主密钥")
+	configRekeyCmd.Flags().BoolVar(&rekeyDecrypt, "decrypt", false, "解密为明文，停用静态加密")
+}
+
+func rekeyConfig(cmd *cobra.Command, args []string) {
+	color.Cyan("🔑 正在轮换静态加密主密钥...")
+
+	cfg, err := config.LoadForDisplay()
+	if err != nil {
+		color.Red("❌ 配置加载失败: %v", err)
+		return
+	}
+	from, err := cfg.Encryption.Keyring()
+	if err != nil {
+		color.Red("❌ 加载当前主密钥失败: %v", err)
+		return
+	}
+
+	// 解析新主密钥
+	options := 0
+	for _, set := range []bool{rekeyNewKey != "", rekeyNewKeyFile != "", rekeyNewPassphrase != "", rekeyGenerate, rekeyDecrypt} {
+		if set {
+			options++
+		}
+	}
+	if options != 1 {
+		color.Red("❌ 请指定且只指定一个: --new-key、--new-key-file、--new-passphrase、--generate 或 --decrypt")
+		return
+	}
+
+	src := secret.Source{Key: rekeyNewKey, KeyFile: rekeyNewKeyFile, Passphrase: rekeyNewPassphrase}
+	if rekeyGenerate {
+		if src.Key, err = secret.GenerateKey(); err != nil {
+			color.Red("❌ %v", err)
+			return
+		}
+	}
+	to, err := secret.LoadKeyring(src)
+	if err != nil {
+		color.Red("❌ 加载新主密钥失败: %v", err)
+		return
+	}
+	if !from.Enabled() && !to.Enabled() {
+		color.Yellow("📭 当前未启用静态加密，无需解密")
+		return
+	}
+	if !to.Enabled() && cfg.Vault.Enabled {
+		color.Red("❌ 刷新令牌保险库需要启用静态加密，请先停用保险库（vault.enabled）再解密")
+		return
+	}
+
+	color.White("   • 当前主密钥: %s", color.CyanString(from.Kind()))
+	color.White("   • 新主密钥: %s", color.CyanString(to.Kind()))
+
+	// 重新加密状态存储（中断后可重新执行）
+	if cfg.Storage.Backend != store.BackendMemory {
+		st, err := store.OpenRaw(cfg.Storage.Backend, cfg.Storage.Path)
+		if err != nil {
+			color.Red("❌ 打开状态存储失败: %v", err)
+			return
+		}
+		defer st.Close()
+
+		count, err := store.Rekey(st, from, to)
+		if err != nil {
+			color.Red("❌ 重新加密状态存储失败（已处理 %d 条）: %v", count, err)
+			return
+		}
+		path, _ := store.FilePath(st)
+		color.Green("✅ 状态存储已重新加密: %d条 (%s)", count, path)
+	} else {
+		color.White("   • 状态存储: %s", color.YellowString("内存存储，无需处理"))
+	}
+
+	// 重新加密自动生成的API Key pepper
+	if cfg.APIKeyPepper == "" {
+		cache, err := config.NewConfigCacheWithStore(cfg, store.NewMemory())
+		if err != nil {
+			color.Red("❌ %v", err)
+			return
+		}
+		if rekeyed, err := apikey.RekeyPepper(cache.GetPepperFile(), from, to); err != nil {
+			color.Red("❌ 重新加密API Key pepper失败: %v", err)
+			return
+		} else if rekeyed {
+			color.Green("✅ API Key pepper已重新加密 (%s)", cache.GetPepperFile())
+		}
+	}
+
+	// 提示更新配置
+	color.Cyan("\n💡 请更新配置后再启动服务器:")
+	switch {
+	case rekeyGenerate:
+		color.White("   export OAUTH_PROXY_ENCRYPTION_MASTER_KEY=%s", src.Key)
+		color.Yellow("   ⚠️  请妥善保存新主密钥，丢失后将无法解密数据")
+	case rekeyNewKey != "":
+		color.White("   export OAUTH_PROXY_ENCRYPTION_MASTER_KEY=<新主密钥>")
+	case rekeyNewKeyFile != "":
+		color.White("   export OAUTH_PROXY_ENCRYPTION_KEY_FILE=%s", rekeyNewKeyFile)
+	case rekeyNewPassphrase != "":
+		color.White("   export OAUTH_PROXY_ENCRYPTION_PASSPHRASE=<新口令>")
+	case rekeyDecrypt:
+		color.White("   移除 encryption 配置及 OAUTH_PROXY_ENCRYPTION_* 环境变量")
+	}
+	color.White("   并移除旧的主密钥配置（只能配置一种主密钥来源）")
+}
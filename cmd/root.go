@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"gmail-oauth-proxy-server/internal/logger"
 	"os"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/spf13/cobra"
@@ -44,9 +45,11 @@ var rootCmd = &cobra.Command{
 			color.NoColor = true
 		}
 
-		// 设置详细输出
+		// 设置详细输出（server 命令加载配置后按 log_level 重新初始化）
 		if verbose {
 			logger.Init("debug")
+		} else {
+			logger.Init("warn")
 		}
 	},
 }
@@ -89,6 +92,7 @@ func initConfig() {
 
 	// 设置环境变量前缀
 	viper.SetEnvPrefix("OAUTH_PROXY")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	// If a config file is found, read it in.
@@ -1,13 +1,26 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"gmail-oauth-proxy-server/internal/apikey"
 	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/egress"
 	"gmail-oauth-proxy-server/internal/handler"
 	"gmail-oauth-proxy-server/internal/logger"
 	"gmail-oauth-proxy-server/internal/middleware"
+	"gmail-oauth-proxy-server/internal/store"
+	"gmail-oauth-proxy-server/internal/tlsreload"
+	"gmail-oauth-proxy-server/internal/tracing"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/gin-gonic/gin"
@@ -21,6 +34,23 @@ var (
 	logLevel    string
 	env         string
 	ipWhitelist []string
+
+	trustedProxies []string
+	tlsCertFile    string
+	tlsKeyFile     string
+
+	upstreamAuthURL       string
+	upstreamTokenURL      string
+	upstreamUserInfoURL   string
+	upstreamTokenInfoURL  string
+	upstreamRevokeURL     string
+	upstreamDeviceCodeURL string
+
+	egressProxy         string
+	egressProxyUsername string
+	egressProxyPassword string
+
+	pkceProxyGenerate bool
 )
 
 // serverCmd represents the server command
@@ -33,6 +63,9 @@ var serverCmd = &cobra.Command{
 处理OAuth授权码交换请求，并提供以下功能：
 
 • POST /token - OAuth授权码交换端点
+• POST /revoke - OAuth令牌撤销端点
+• POST /device/code - 设备授权端点（设备码流程）
+• POST /service-account/token - 服务账号令牌端点（代理签发JWT断言）
 • GET /health - 健康检查端点
 • API Key认证保护
 • IP白名单访问控制
@@ -44,7 +77,10 @@ var serverCmd = &cobra.Command{
   gmail-oauth-proxy server                                    # 使用默认配置启动
   gmail-oauth-proxy server --port 9000                        # 指定端口启动
   gmail-oauth-proxy server --env production                   # 生产环境模式
-  gmail-oauth-proxy server --ip-whitelist 192.168.1.0/24     # 配置IP白名单`,
+  gmail-oauth-proxy server --ip-whitelist 192.168.1.0/24     # 配置IP白名单
+  gmail-oauth-proxy server --trusted-proxies 10.0.0.0/8       # 信任反向代理的转发头
+  gmail-oauth-proxy server --tls-cert cert.pem --tls-key key.pem  # 直接提供HTTPS
+  gmail-oauth-proxy server --upstream-token-url http://127.0.0.1:9000/token  # 自定义上游端点`,
 	Run: runServer,
 }
 
@@ -57,6 +93,19 @@ func init() {
 	serverCmd.Flags().StringVar(&logLevel, "log-level", "info", "日志级别 (debug|info|warn|error)")
 	serverCmd.Flags().StringVar(&env, "env", "development", "运行环境 (development|production)")
 	serverCmd.Flags().StringSliceVar(&ipWhitelist, "ip-whitelist", []string{}, "IP白名单，支持CIDR格式 (可多次指定)")
+	serverCmd.Flags().StringSliceVar(&trustedProxies, "trusted-proxies", []string{}, "受信任的反向代理，支持CIDR格式 (可多次指定)，只采信来自这些地址的转发头")
+	serverCmd.Flags().StringVar(&tlsCertFile, "tls-cert", "", "TLS证书文件 (PEM)，配置后直接提供HTTPS")
+	serverCmd.Flags().StringVar(&tlsKeyFile, "tls-key", "", "TLS私钥文件 (PEM)")
+	serverCmd.Flags().StringVar(&upstreamAuthURL, "upstream-auth-url", config.DefaultAuthURL, "上游授权端点URL")
+	serverCmd.Flags().StringVar(&upstreamTokenURL, "upstream-token-url", config.DefaultTokenURL, "上游令牌端点URL")
+	serverCmd.Flags().StringVar(&upstreamUserInfoURL, "upstream-userinfo-url", config.DefaultUserInfoURL, "上游用户信息端点URL")
+	serverCmd.Flags().StringVar(&upstreamTokenInfoURL, "upstream-tokeninfo-url", config.DefaultTokenInfoURL, "上游令牌验证端点URL")
+	serverCmd.Flags().StringVar(&upstreamRevokeURL, "upstream-revoke-url", config.DefaultRevokeURL, "上游令牌撤销端点URL")
+	serverCmd.Flags().StringVar(&upstreamDeviceCodeURL, "upstream-device-code-url", config.DefaultDeviceCodeURL, "上游设备授权端点URL")
+	serverCmd.Flags().StringVar(&egressProxy, "egress-proxy", "", "访问上游的出站代理 (http://host:port 或 socks5://host:port)")
+	serverCmd.Flags().StringVar(&egressProxyUsername, "egress-proxy-username", "", "出站代理用户名")
+	serverCmd.Flags().StringVar(&egressProxyPassword, "egress-proxy-password", "", "出站代理密码")
+	serverCmd.Flags().BoolVar(&pkceProxyGenerate, "pkce-proxy-generate", false, "客户端未提供PKCE参数时由代理生成并保存code_verifier")
 
 	// 绑定到viper
 	viper.BindPFlag("port", serverCmd.Flags().Lookup("port"))
@@ -64,6 +113,19 @@ func init() {
 	viper.BindPFlag("log_level", serverCmd.Flags().Lookup("log-level"))
 	viper.BindPFlag("environment", serverCmd.Flags().Lookup("env"))
 	viper.BindPFlag("ip_whitelist", serverCmd.Flags().Lookup("ip-whitelist"))
+	viper.BindPFlag("trusted_proxies", serverCmd.Flags().Lookup("trusted-proxies"))
+	viper.BindPFlag("tls.cert_file", serverCmd.Flags().Lookup("tls-cert"))
+	viper.BindPFlag("tls.key_file", serverCmd.Flags().Lookup("tls-key"))
+	viper.BindPFlag("upstream.auth_url", serverCmd.Flags().Lookup("upstream-auth-url"))
+	viper.BindPFlag("upstream.token_url", serverCmd.Flags().Lookup("upstream-token-url"))
+	viper.BindPFlag("upstream.userinfo_url", serverCmd.Flags().Lookup("upstream-userinfo-url"))
+	viper.BindPFlag("upstream.tokeninfo_url", serverCmd.Flags().Lookup("upstream-tokeninfo-url"))
+	viper.BindPFlag("upstream.revoke_url", serverCmd.Flags().Lookup("upstream-revoke-url"))
+	viper.BindPFlag("upstream.device_code_url", serverCmd.Flags().Lookup("upstream-device-code-url"))
+	viper.BindPFlag("egress_proxy.url", serverCmd.Flags().Lookup("egress-proxy"))
+	viper.BindPFlag("egress_proxy.username", serverCmd.Flags().Lookup("egress-proxy-username"))
+	viper.BindPFlag("egress_proxy.password", serverCmd.Flags().Lookup("egress-proxy-password"))
+	viper.BindPFlag("pkce.proxy_generate", serverCmd.Flags().Lookup("pkce-proxy-generate"))
 }
 
 func runServer(cmd *cobra.Command, args []string) {
@@ -99,10 +161,63 @@ func runServer(cmd *cobra.Command, args []string) {
 	if cmd.Flags().Changed("ip-whitelist") {
 		cfg.IPWhitelist = ipWhitelist
 	}
+	if cmd.Flags().Changed("trusted-proxies") {
+		cfg.TrustedProxies = trustedProxies
+	}
+	if cmd.Flags().Changed("tls-cert") {
+		cfg.TLS.CertFile = tlsCertFile
+	}
+	if cmd.Flags().Changed("tls-key") {
+		cfg.TLS.KeyFile = tlsKeyFile
+	}
+	if cmd.Flags().Changed("upstream-auth-url") {
+		cfg.Upstream.AuthURL = upstreamAuthURL
+	}
+	if cmd.Flags().Changed("upstream-token-url") {
+		cfg.Upstream.TokenURL = upstreamTokenURL
+	}
+	if cmd.Flags().Changed("upstream-userinfo-url") {
+		cfg.Upstream.UserInfoURL = upstreamUserInfoURL
+	}
+	if cmd.Flags().Changed("upstream-tokeninfo-url") {
+		cfg.Upstream.TokenInfoURL = upstreamTokenInfoURL
+	}
+	if cmd.Flags().Changed("upstream-revoke-url") {
+		cfg.Upstream.RevokeURL = upstreamRevokeURL
+	}
+	if cmd.Flags().Changed("upstream-device-code-url") {
+		cfg.Upstream.DeviceCodeURL = upstreamDeviceCodeURL
+	}
+	if cmd.Flags().Changed("egress-proxy") {
+		cfg.EgressProxy.URL = egressProxy
+	}
+	if cmd.Flags().Changed("egress-proxy-username") {
+		cfg.EgressProxy.Username = egressProxyUsername
+	}
+	if cmd.Flags().Changed("egress-proxy-password") {
+		cfg.EgressProxy.Password = egressProxyPassword
+	}
+	if cmd.Flags().Changed("pkce-proxy-generate") {
+		cfg.PKCE.ProxyGenerate = pkceProxyGenerate
+	}
+
+	// 命名API Key保存在状态存储中
+	activeKeys := 0
+	if cache, err := config.NewConfigCache(cfg); err == nil {
+		if keys, err := cache.ListAPIKeys(); err == nil {
+			now := time.Now()
+			for _, key := range keys {
+				if key.Active(now) {
+					activeKeys++
+				}
+			}
+		}
+		cache.Close()
+	}
 
 	// 验证鉴权配置（仅在未禁用认证时）
-	if !cfg.DisableAuth && cfg.APIKey == "" && len(cfg.IPWhitelist) == 0 {
-		color.Red("❌ 未配置任何鉴权方式，请配置API Key或IP白名单")
+	if !cfg.DisableAuth && !cfg.HasAuthMethod(activeKeys > 0) {
+		color.Red("❌ 未配置任何鉴权方式，请配置API Key、IP白名单或客户端证书")
 		color.Yellow("   • API Key: 通过 --api-key 参数或 OAUTH_PROXY_API_KEY 环境变量设置")
 		color.Yellow("   • IP白名单: 通过 --ip-whitelist 参数或 OAUTH_PROXY_IP_WHITELIST 环境变量设置")
 		color.Yellow("   • 或者重新启动服务器以自动生成API Key")
@@ -120,18 +235,107 @@ func runServer(cmd *cobra.Command, args []string) {
 	} else {
 		color.Blue("🔧 开发环境模式已启用")
 	}
+	if warning := forwardedProtoWarning(cfg); warning != "" {
+		color.Yellow("⚠️  %s", warning)
+		color.Yellow("   • 部署在终止TLS的负载均衡之后时，请通过 --trusted-proxies 或 OAUTH_PROXY_TRUSTED_PROXIES 声明代理地址")
+		logger.Warn("trusted_proxies is empty in production: X-Forwarded-Proto is ignored and plain HTTP requests are rejected")
+	}
+
+	// 之后的失败都设置exitCode后return，使下面注册的defer（刷新span、停止证书监听）在退出前执行
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	// 初始化OpenTelemetry追踪
+	shutdownTracing, err := tracing.Setup(cfg.Tracing, Version)
+	if err != nil {
+		color.Red("❌ 追踪配置无效: %v", err)
+		log.Printf("Invalid tracing config: %v", err)
+		exitCode = 1
+		return
+	}
+	defer shutdownTracing(context.Background())
+
+	// 验证优雅停机配置
+	if err := cfg.Shutdown.Validate(); err != nil {
+		color.Red("❌ 优雅停机配置无效: %v", err)
+		log.Printf("Invalid shutdown config: %v", err)
+		exitCode = 1
+		return
+	}
+
+	// 加载TLS证书，文件变化或收到SIGHUP时自动重新加载
+	var tlsConfig *tls.Config
+	var tlsReloader *tlsreload.Reloader
+	if err := tlsreload.ValidateConfig(cfg.TLS); err != nil {
+		color.Red("❌ TLS配置无效: %v", err)
+		log.Printf("Invalid TLS config: %v", err)
+		exitCode = 1
+		return
+	}
+	if cfg.TLS.Enabled() {
+		tlsReloader, err = tlsreload.NewReloader(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		if err != nil {
+			color.Red("❌ TLS证书加载失败: %v", err)
+			log.Printf("Failed to load TLS certificate: %v", err)
+			exitCode = 1
+			return
+		}
+		tlsConfig, err = tlsreload.ServerConfig(cfg.TLS, tlsReloader)
+		if err != nil {
+			color.Red("❌ TLS配置无效: %v", err)
+			log.Printf("Invalid TLS config: %v", err)
+			exitCode = 1
+			return
+		}
+		tlsReloader.Watch()
+		defer tlsReloader.Close()
+	}
+
+	// 解析受信任的代理
+	proxies, err := middleware.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		color.Red("❌ 受信任的代理配置无效: %v", err)
+		log.Printf("Invalid trusted proxies: %v", err)
+		exitCode = 1
+		return
+	}
+	forwardedHeader, err := middleware.ParseForwardedHeader(cfg.ForwardedHeader)
+	if err != nil {
+		color.Red("❌ 转发头配置无效: %v", err)
+		log.Printf("Invalid forwarded header: %v", err)
+		exitCode = 1
+		return
+	}
 
-	// 创建Gin引擎
+	// 创建Gin引擎，客户端IP由 ClientIP 中间件统一解析
 	r := gin.New()
+	r.SetTrustedProxies(nil)
 
 	// 添加全局中间件
 	r.Use(handler.ErrorHandler())
+	r.Use(middleware.ClientIP(proxies, forwardedHeader))
+	if cfg.Tracing.Enabled {
+		r.Use(middleware.Tracing())
+	}
 	r.Use(middleware.Logger())
-	r.Use(middleware.HTTPS())
+	if cfg.Metrics.Enabled {
+		r.Use(middleware.Metrics())
+	}
+	r.Use(middleware.HTTPS(proxies))
 	color.Green("✅ 中间件加载完成")
 
 	// 注册路由
-	handler.RegisterRoutes(r, cfg)
+	oauthHandler, err := handler.RegisterRoutes(r, cfg)
+	if err != nil {
+		color.Red("❌ 路由注册失败: %v", err)
+		log.Printf("Failed to register routes: %v", err)
+		exitCode = 1
+		return
+	}
 	color.Green("✅ 路由注册完成")
 
 	// 显示服务器信息
@@ -139,14 +343,27 @@ func runServer(cmd *cobra.Command, args []string) {
 	color.Cyan("\n" + separator)
 	color.Green("🚀 Gmail OAuth代理服务器启动成功!")
 	color.Cyan(separator)
-	color.White("📍 监听地址: http://localhost:%s", cfg.Port)
+	if tlsReloader != nil {
+		leaf := tlsReloader.Certificate().Leaf
+		color.White("📍 监听地址: https://localhost:%s", cfg.Port)
+		color.White("🔐 TLS: 最低版本 %s, 证书到期: %s (修改证书文件或发送 SIGHUP 自动重新加载)",
+			cfg.TLS.MinVersion, leaf.NotAfter.Format("2006-01-02"))
+	} else {
+		color.White("📍 监听地址: http://localhost:%s", cfg.Port)
+	}
 
 	// 显示鉴权配置
 	if cfg.DisableAuth {
 		color.Yellow("⚠️  认证已禁用 - 所有请求都将被允许")
 	} else {
 		if cfg.APIKey != "" {
-			color.White("🔑 API Key: %s", cfg.APIKey)
+			color.White("🔑 API Key: %s", apikey.Display(cfg.APIKey))
+		}
+		if activeKeys > 0 {
+			color.White("🔑 命名API Key: %d个可用 (使用 keys list 查看)", activeKeys)
+		}
+		if len(cfg.TLS.ClientCerts) > 0 {
+			color.White("🪪 客户端证书身份: %d个", len(cfg.TLS.ClientCerts))
 		}
 		if len(cfg.IPWhitelist) > 0 {
 			color.White("🛡️  IP白名单: %d个规则", len(cfg.IPWhitelist))
@@ -159,6 +376,89 @@ func runServer(cmd *cobra.Command, args []string) {
 				}
 			}
 		}
+		if (cfg.APIKey != "" || activeKeys > 0 || len(cfg.TLS.ClientCerts) > 0) && len(cfg.IPWhitelist) > 0 {
+			mode := "API Key和IP白名单都必须通过"
+			if cfg.Auth.Mode == config.AuthModeAny {
+				mode = "API Key或IP白名单任一通过即可"
+			}
+			color.White("🧮 鉴权组合方式: %s (%d条路由覆盖)", mode, len(cfg.Auth.Routes))
+		}
+	}
+
+	upstream := cfg.Upstream.WithDefaults()
+	if upstream != (config.UpstreamConfig{}.WithDefaults()) {
+		color.White("🔀 上游端点: 已自定义")
+		color.White("   • 授权: %s", upstream.AuthURL)
+		color.White("   • 令牌: %s", upstream.TokenURL)
+		color.White("   • 用户信息: %s", upstream.UserInfoURL)
+		color.White("   • 令牌验证: %s", upstream.TokenInfoURL)
+		color.White("   • 令牌撤销: %s", upstream.RevokeURL)
+		color.White("   • 设备授权: %s", upstream.DeviceCodeURL)
+	}
+
+	for _, name := range config.UpstreamNames {
+		settings := egress.SettingsFor(cfg.EgressProxy, name)
+		if !settings.IsDirect() {
+			color.White("🌐 出站代理 (%s): %s", name, settings)
+		}
+	}
+	if len(cfg.EgressPool.Routes) > 0 {
+		color.White("🔁 出站线路池: %d条线路 (健康探测间隔 %d秒)", len(cfg.EgressPool.Routes), cfg.EgressPool.HealthCheckInterval)
+		for _, route := range cfg.EgressPool.Routes {
+			color.White("   • %s (%s)", route.Name, route.Type)
+		}
+	}
+
+	if cfg.PKCE.ProxyGenerate {
+		color.White("🔐 PKCE: 代理生成code_verifier (有效期 %d秒)", cfg.PKCE.VerifierTTL)
+	}
+	if len(cfg.Clients) > 0 {
+		color.White("🪪 登记的OAuth客户端: %d个 (未提供client_secret时由代理注入)", len(cfg.Clients))
+	}
+	if cfg.ClientPolicy.RequireRegistered {
+		color.White("🚧 客户端策略: 仅允许登记的客户端")
+	}
+	if len(cfg.TrustedProxies) > 0 {
+		color.White("🔗 受信任的代理: %s", strings.Join(cfg.TrustedProxies, ", "))
+	}
+	if cfg.BruteForce.Enabled {
+		color.White("🚷 认证失败封禁: %d秒内%d次错误API Key后封禁%d秒", cfg.BruteForce.Window, cfg.BruteForce.MaxFailures, cfg.BruteForce.BanDuration)
+	}
+	if cfg.Admin.APIKey != "" {
+		color.White("🛠️  管理端点: /admin/bans (使用 bans 命令管理)")
+	}
+	if cfg.Tracing.Enabled {
+		color.White("🔭 追踪: OTLP %s (服务名: %s, 采样: %g)", cfg.Tracing.Endpoint, cfg.Tracing.ServiceName, cfg.Tracing.SampleRatio)
+	}
+	if cfg.Metrics.Enabled {
+		address := "http://localhost:" + cfg.Port
+		if cfg.Metrics.Listen != "" {
+			address = "http://" + cfg.Metrics.Listen
+		}
+		color.White("📈 指标: %s%s", address, cfg.Metrics.Path)
+	}
+	if cfg.RateLimit.Enabled {
+		color.White("🚦 限流: 每个API Key %d次/分钟, 每个客户端IP %d次/分钟, %d条路由规则",
+			cfg.RateLimit.PerKey.RequestsPerMinute, cfg.RateLimit.PerIP.RequestsPerMinute, len(cfg.RateLimit.Routes))
+	}
+	if len(cfg.ClientPolicy.ForbiddenScopes) > 0 {
+		color.White("🚫 禁止的权限范围: %s", strings.Join(cfg.ClientPolicy.ForbiddenScopes, ", "))
+	}
+	if len(cfg.ServiceAccounts) > 0 {
+		color.White("🤖 服务账号: %d个", len(cfg.ServiceAccounts))
+		for _, account := range cfg.ServiceAccounts {
+			color.White("   • %s", account.Name)
+		}
+	}
+
+	if cfg.Encryption.MasterKey != "" || cfg.Encryption.KeyFile != "" || cfg.Encryption.Passphrase != "" {
+		color.White("🔒 静态加密: 已启用 (AES-256-GCM信封加密)")
+	}
+	if cfg.Storage.Backend == store.BackendMemory {
+		color.White("💾 状态存储: 内存（重启后丢失）")
+	}
+	if cfg.Vault.Enabled {
+		color.White("🔐 刷新令牌保险库: 已启用 (GET /v1/accounts/{email}/access_token)")
 	}
 
 	color.White("🌍 运行环境: %s", cfg.Environment)
@@ -167,10 +467,107 @@ func runServer(cmd *cobra.Command, args []string) {
 	color.Yellow("💡 使用 Ctrl+C 停止服务器")
 	color.Cyan(separator + "\n")
 
+	// 在独立端口提供指标
+	var metricsServer *http.Server
+	if cfg.Metrics.Enabled && cfg.Metrics.Listen != "" {
+		metricsEngine, err := handler.NewMetricsEngine(cfg)
+		if err != nil {
+			color.Red("❌ 指标端点配置无效: %v", err)
+			log.Printf("Invalid metrics config: %v", err)
+			oauthHandler.Close()
+			exitCode = 1
+			return
+		}
+		metricsServer = &http.Server{Addr: cfg.Metrics.Listen, Handler: metricsEngine}
+		go func() {
+			logger.Info("Starting metrics server on %s", cfg.Metrics.Listen)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error("Metrics server stopped: %v", err)
+			}
+		}()
+	}
+
 	// 启动服务器
-	logger.Info("Starting server on port %s", cfg.Port)
-	if err := r.Run(":" + cfg.Port); err != nil {
+	server := &http.Server{Addr: ":" + cfg.Port, Handler: r, TLSConfig: tlsConfig}
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if tlsConfig != nil {
+			logger.Info("Starting HTTPS server on port %s", cfg.Port)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			logger.Info("Starting server on port %s", cfg.Port)
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	// 等待停机信号
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
 		color.Red("❌ 服务器启动失败: %v", err)
-		log.Fatalf("Failed to start server: %v", err)
+		log.Printf("Failed to start server: %v", err)
+		if metricsServer != nil {
+			metricsServer.Close()
+		}
+		oauthHandler.Close()
+		exitCode = 1
+		return
+	case sig := <-quit:
+		logger.Info("Received %s, shutting down", sig)
+	}
+
+	shutdownServers(cfg.Shutdown, oauthHandler, quit, server, metricsServer)
+	oauthHandler.Close()
+	color.Green("👋 服务器已停止")
+}
+
+// shutdownServers 优雅停机：/health 立即报告未就绪，等待 shutdown.delay 后停止接受新连接，
+// 并在 shutdown.drain_timeout 内等待进行中的请求完成，超时后强制关闭剩余连接
+// 停机期间再次收到信号时立即退出
+func shutdownServers(cfg config.ShutdownConfig, oauthHandler *handler.OAuthHandler, quit <-chan os.Signal, servers ...*http.Server) {
+	oauthHandler.StartDraining()
+	color.Yellow("⏳ 正在停止服务器，等待进行中的请求完成 (最长%d秒，再次按 Ctrl+C 立即退出)", cfg.DrainTimeout)
+	go func() {
+		sig := <-quit
+		color.Red("❌ 收到 %s，立即退出", sig)
+		os.Exit(1)
+	}()
+
+	if cfg.Delay > 0 {
+		logger.Info("Reporting not ready for %d seconds before closing listeners", cfg.Delay)
+		time.Sleep(time.Duration(cfg.Delay) * time.Second)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DrainTimeout)*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		if server == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				logger.Warn("Drain timeout exceeded on %s, closing remaining connections: %v", server.Addr, err)
+				server.Close()
+			}
+		}(server)
+	}
+	wg.Wait()
+}
+
+// forwardedProtoWarning 生产环境未启用原生TLS且未配置受信任的代理时返回警告：
+// 此时不采信 X-Forwarded-Proto，经终止TLS的负载均衡转发的请求都会因"HTTPS required"被拒绝
+func forwardedProtoWarning(cfg *config.Config) string {
+	if cfg.Environment != "production" || cfg.TLS.Enabled() || len(cfg.TrustedProxies) > 0 {
+		return ""
 	}
+	return "生产环境未配置受信任的代理（trusted_proxies），X-Forwarded-Proto 将被忽略，非TLS连接的请求会返回 400 HTTPS required"
 }
@@ -0,0 +1,198 @@
+package apikey
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/secret"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prefix 代理签发的API Key前缀
+const Prefix = "gop_"
+
+// hashScheme 哈希格式标识，完整格式为 hmac-sha256$<可见前缀>$<盐>$<MAC>
+const hashScheme = "hmac-sha256"
+
+// prefixLength 用于识别API Key的可见前缀长度（如 gop_abcd）
+const prefixLength = len(Prefix) + 4
+
+// ErrNoPepper 未配置服务端pepper
+var ErrNoPepper = errors.New("API key pepper is not configured")
+
+// Generate 生成随机API Key
+func Generate() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return Prefix + hex.EncodeToString(bytes), nil
+}
+
+// VisiblePrefix 返回API Key（或其哈希）中可以公开展示的前缀，过短的密钥不展示任何内容
+func VisiblePrefix(value string) string {
+	if IsHash(value) {
+		return strings.Split(value, "$")[1]
+	}
+	if len(value) < prefixLength*2 {
+		return ""
+	}
+	return strings.ReplaceAll(value[:prefixLength], "$", "*")
+}
+
+// Display 返回用于展示的脱敏API Key，只包含可见前缀
+func Display(value string) string {
+	return VisiblePrefix(value) + "****"
+}
+
+// IsHash 判断是否为API Key哈希
+func IsHash(value string) bool {
+	return strings.HasPrefix(value, hashScheme+"$") && strings.Count(value, "$") == 3
+}
+
+// Hasher 使用服务端pepper和随机盐计算API Key的HMAC-SHA256哈希
+// nil Hasher 只能校验明文密钥
+type Hasher struct {
+	pepper []byte
+}
+
+// NewHasher 创建Hasher
+func NewHasher(pepper []byte) *Hasher {
+	return &Hasher{pepper: pepper}
+}
+
+// LoadPepper 读取服务端pepper：优先使用配置值，否则从文件读取，文件不存在时生成并保存
+// keyring不为nil时pepper文件使用信封加密保存，启用加密前保存的明文pepper在读取时加密写回
+func LoadPepper(value, path string, keyring *secret.Keyring) ([]byte, error) {
+	if value != "" {
+		return []byte(value), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		plaintext, err := keyring.Open(bytes.TrimSpace(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt API key pepper %s: %w", path, err)
+		}
+		pepper, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(plaintext)))
+		if err != nil || len(pepper) == 0 {
+			return nil, fmt.Errorf("invalid API key pepper file %s", path)
+		}
+		if keyring.Enabled() && !secret.IsSealed(data) {
+			if err := writePepper(path, pepper, keyring); err != nil {
+				return nil, err
+			}
+		}
+		return pepper, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read API key pepper: %w", err)
+	}
+
+	pepper := make([]byte, 32)
+	if _, err := rand.Read(pepper); err != nil {
+		return nil, fmt.Errorf("failed to generate API key pepper: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create pepper directory: %w", err)
+	}
+	if err := writePepper(path, pepper, keyring); err != nil {
+		return nil, err
+	}
+	return pepper, nil
+}
+
+// RekeyPepper 使用新的主密钥重新加密pepper文件（to为nil时解密为明文），文件不存在时返回false
+func RekeyPepper(path string, from, to *secret.Keyring) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read API key pepper: %w", err)
+	}
+	if to.Owns(bytes.TrimSpace(data)) {
+		return true, nil
+	}
+	rewrapped, err := from.Rewrap(bytes.TrimSpace(data), to)
+	if err != nil {
+		return false, fmt.Errorf("failed to re-encrypt API key pepper %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(rewrapped, '\n'), 0600); err != nil {
+		return false, fmt.Errorf("failed to write API key pepper: %w", err)
+	}
+	return true, nil
+}
+
+// writePepper 保存base64编码的pepper，keyring不为nil时加密保存
+func writePepper(path string, pepper []byte, keyring *secret.Keyring) error {
+	data, err := keyring.Seal([]byte(base64.StdEncoding.EncodeToString(pepper)))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt API key pepper: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write API key pepper: %w", err)
+	}
+	return nil
+}
+
+// Hash 计算API Key的加盐哈希
+func (h *Hasher) Hash(key string) (string, error) {
+	if h == nil {
+		return "", ErrNoPepper
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	return strings.Join([]string{
+		hashScheme,
+		VisiblePrefix(key),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(h.mac(salt, key)),
+	}, "$"), nil
+}
+
+// Verify 以常量时间校验API Key是否与哈希匹配
+func (h *Hasher) Verify(key, hash string) bool {
+	if h == nil || !IsHash(hash) {
+		return false
+	}
+	parts := strings.Split(hash, "$")
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(h.mac(salt, key), expected)
+}
+
+// Match 校验API Key：stored为哈希时按哈希校验，否则按明文常量时间比较
+func (h *Hasher) Match(key, stored string) bool {
+	if stored == "" {
+		return false
+	}
+	if IsHash(stored) {
+		return h.Verify(key, stored)
+	}
+	return subtle.ConstantTimeCompare([]byte(key), []byte(stored)) == 1
+}
+
+// mac 计算 HMAC-SHA256(pepper, salt || key)
+func (h *Hasher) mac(salt []byte, key string) []byte {
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write(salt)
+	mac.Write([]byte(key))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,137 @@
+package apikey
+
+import (
+	"encoding/base64"
+	"gmail-oauth-proxy-server/internal/secret"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasher(t *testing.T) {
+	key, err := Generate()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, Prefix))
+
+	hasher := NewHasher([]byte("pepper"))
+	hash, err := hasher.Hash(key)
+	require.NoError(t, err)
+	assert.True(t, IsHash(hash))
+	assert.NotContains(t, hash, key)
+	assert.Equal(t, key[:8], VisiblePrefix(hash))
+	assert.Equal(t, key[:8]+"****", Display(hash))
+
+	assert.True(t, hasher.Verify(key, hash))
+	assert.False(t, hasher.Verify(key+"x", hash))
+	assert.False(t, NewHasher([]byte("other")).Verify(key, hash))
+
+	// 相同密钥每次使用不同的盐
+	again, err := hasher.Hash(key)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, again)
+	assert.True(t, hasher.Verify(key, again))
+
+	// 明文和哈希都可以匹配
+	assert.True(t, hasher.Match(key, hash))
+	assert.True(t, hasher.Match("plain-key", "plain-key"))
+	assert.False(t, hasher.Match("plain-key", "other-key"))
+	assert.False(t, hasher.Match("", ""))
+
+	var none *Hasher
+	assert.True(t, none.Match("plain-key", "plain-key"))
+	assert.False(t, none.Match(key, hash))
+	_, err = none.Hash(key)
+	assert.ErrorIs(t, err, ErrNoPepper)
+}
+
+func TestDisplay(t *testing.T) {
+	assert.Equal(t, "****", Display("short-key"))
+	assert.Equal(t, "a*bcdefg****", Display("a$bcdefghijklmnop"))
+	assert.False(t, IsHash("hmac-sha256$only$three"))
+}
+
+func TestLoadPepper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pepper")
+
+	pepper, err := LoadPepper("configured", path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("configured"), pepper)
+	assert.NoFileExists(t, path)
+
+	generated, err := LoadPepper("", path, nil)
+	require.NoError(t, err)
+	assert.Len(t, generated, 32)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := LoadPepper("", path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, generated, loaded)
+
+	require.NoError(t, os.WriteFile(path, []byte("not base64!"), 0600))
+	_, err = LoadPepper("", path, nil)
+	assert.Error(t, err)
+}
+
+func TestLoadPepper_Encrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pepper")
+	keyring, other := newTestKeyring(t), newTestKeyring(t)
+
+	// 启用静态加密前保存的明文pepper在读取时加密写回
+	plain, err := LoadPepper("", path, nil)
+	require.NoError(t, err)
+	pepper, err := LoadPepper("", path, keyring)
+	require.NoError(t, err)
+	assert.Equal(t, plain, pepper)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, secret.IsSealed(data))
+	assert.NotContains(t, string(data), base64.StdEncoding.EncodeToString(pepper))
+
+	_, err = LoadPepper("", path, nil)
+	assert.ErrorIs(t, err, secret.ErrNoMasterKey)
+
+	// 轮换主密钥后使用新主密钥读取
+	rekeyed, err := RekeyPepper(path, keyring, other)
+	require.NoError(t, err)
+	assert.True(t, rekeyed)
+	loaded, err := LoadPepper("", path, other)
+	require.NoError(t, err)
+	assert.Equal(t, pepper, loaded)
+	_, err = LoadPepper("", path, keyring)
+	assert.ErrorIs(t, err, secret.ErrWrongKey)
+
+	// 解密为明文
+	_, err = RekeyPepper(path, other, nil)
+	require.NoError(t, err)
+	loaded, err = LoadPepper("", path, nil)
+	require.NoError(t, err)
+	assert.Equal(t, pepper, loaded)
+
+	rekeyed, err = RekeyPepper(filepath.Join(t.TempDir(), "missing"), nil, keyring)
+	require.NoError(t, err)
+	assert.False(t, rekeyed)
+
+	// 新生成的pepper直接加密保存
+	generatedPath := filepath.Join(t.TempDir(), "pepper")
+	_, err = LoadPepper("", generatedPath, keyring)
+	require.NoError(t, err)
+	data, err = os.ReadFile(generatedPath)
+	require.NoError(t, err)
+	assert.True(t, secret.IsSealed(data))
+}
+
+// newTestKeyring 创建使用随机主密钥的Keyring
+func newTestKeyring(t *testing.T) *secret.Keyring {
+	t.Helper()
+	key, err := secret.GenerateKey()
+	require.NoError(t, err)
+	keyring, err := secret.LoadKeyring(secret.Source{Key: key})
+	require.NoError(t, err)
+	return keyring
+}
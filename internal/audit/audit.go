@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/store"
+	"os/user"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 审计事件类型
+const (
+	ActionKeyGenerate = "key.generate" // 自动生成默认API Key
+	ActionKeyCreate   = "key.create"   // 创建命名API Key
+	ActionKeyRevoke   = "key.revoke"   // 吊销命名API Key
+	ActionKeyRotate   = "key.rotate"   // 轮换API Key
+	ActionKeyClear    = "key.clear"    // 清除所有API Key（config clear-cache）
+	ActionBanCreate   = "ban.create"   // 认证失败次数达到阈值后封禁IP
+	ActionBanClear    = "ban.clear"    // 通过管理端点解除封禁
+	ActionGrantStore  = "grant.store"  // 保险库保存或更新凭据
+	ActionGrantDelete = "grant.delete" // 保险库删除凭据
+)
+
+// ActorServer 服务器自动执行的操作
+const ActorServer = "server"
+
+// ActorAdmin 通过管理端点执行的操作
+const ActorAdmin = "admin"
+
+// DefaultRetention 审计记录的默认保留时间
+const DefaultRetention = 90 * 24 * time.Hour
+
+// sweepInterval 清理过期审计记录的间隔
+const sweepInterval = time.Hour
+
+// Record 审计记录
+type Record struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor,omitempty"`  // 执行操作的身份
+	Target string    `json:"target,omitempty"` // 操作对象（API Key名称、IP、账号等）
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Log 审计日志，记录保存在状态存储的audit命名空间中，超过保留时间后自动删除
+// nil Log 不记录任何事件
+type Log struct {
+	store     store.Store
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	sweptAt time.Time
+}
+
+// New 创建使用默认保留时间的审计日志
+func New(st store.Store) *Log {
+	return &Log{store: st, retention: DefaultRetention, now: time.Now}
+}
+
+// LocalActor 返回本地命令行操作的身份（当前系统用户）
+func LocalActor() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return "local:" + u.Username
+	}
+	return "local"
+}
+
+// Record 写入一条审计记录，写入失败时只记录日志，不影响被审计的操作
+func (l *Log) Record(action, actor, target, detail string) {
+	if l == nil {
+		return
+	}
+	now := l.now()
+	l.sweep(now)
+
+	record := Record{Time: now, Action: action, Actor: actor, Target: target, Detail: detail}
+	value, err := json.Marshal(record)
+	if err == nil {
+		err = l.store.Put(store.BucketAudit, recordKey(now), value)
+	}
+	if err != nil {
+		logger.Error("Failed to write audit record %s %s: %v", action, target, err)
+	}
+}
+
+// List 返回所有未过期的审计记录（按时间排序）
+func (l *Log) List() ([]Record, error) {
+	values, err := l.store.List(store.BucketAudit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit records: %w", err)
+	}
+	cutoff := l.now().Add(-l.retention)
+	records := make([]Record, 0, len(values))
+	for key, value := range values {
+		var record Record
+		if err := json.Unmarshal(value, &record); err != nil {
+			return nil, fmt.Errorf("failed to parse audit record %s: %w", key, err)
+		}
+		if record.Time.After(cutoff) {
+			records = append(records, record)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+	return records, nil
+}
+
+// sweep 定期删除超过保留时间的审计记录
+func (l *Log) sweep(now time.Time) {
+	l.mu.Lock()
+	if now.Sub(l.sweptAt) < sweepInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.sweptAt = now
+	l.mu.Unlock()
+
+	values, err := l.store.List(store.BucketAudit)
+	if err != nil {
+		logger.Error("Failed to sweep audit records: %v", err)
+		return
+	}
+	cutoff := now.Add(-l.retention)
+	for key, value := range values {
+		var record Record
+		if json.Unmarshal(value, &record) == nil && record.Time.After(cutoff) {
+			continue
+		}
+		if err := l.store.Delete(store.BucketAudit, key); err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.Error("Failed to delete expired audit record %s: %v", key, err)
+		}
+	}
+}
+
+// recordKey 生成按时间排序的记录键，随机后缀避免同一时刻的记录互相覆盖
+func recordKey(now time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%020d-%s", now.UnixNano(), hex.EncodeToString(suffix))
+}
@@ -0,0 +1,50 @@
+package audit
+
+import (
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/store"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init("error")
+}
+
+func TestLog(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	st := store.NewMemory()
+	log := New(st)
+	log.now = func() time.Time { return now }
+
+	log.Record(ActionKeyCreate, "local:ops", "ci", "owner=ops@example.com")
+	log.Record(ActionKeyRevoke, "local:ops", "ci", "")
+	now = now.Add(time.Second)
+	log.Record(ActionBanCreate, ActorServer, "203.0.113.7", "3 failed authentication attempts")
+
+	records, err := log.List()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, ActionKeyCreate, records[0].Action)
+	assert.Equal(t, "owner=ops@example.com", records[0].Detail)
+	assert.Equal(t, ActionBanCreate, records[2].Action)
+	assert.Equal(t, ActorServer, records[2].Actor)
+
+	// 超过保留时间的记录不再返回，下次写入时从状态存储中删除
+	now = now.Add(DefaultRetention - 500*time.Millisecond)
+	records, err = log.List()
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	log.Record(ActionBanClear, ActorAdmin, "*", "1 bans")
+	values, err := st.List(store.BucketAudit)
+	require.NoError(t, err)
+	assert.Len(t, values, 2)
+
+	// nil Log 不记录任何事件
+	var disabled *Log
+	disabled.Record(ActionKeyCreate, "local:ops", "ci", "")
+}
@@ -0,0 +1,374 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/audit"
+	"gmail-oauth-proxy-server/internal/store"
+	"net"
+	"path"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// DefaultAPIKeyName 缓存中自动生成的默认API Key的名称，不能用作命名API Key的名称
+const DefaultAPIKeyName = "default"
+
+// DefaultRotationGrace 轮换API Key时旧密钥默认的宽限期
+const DefaultRotationGrace = 24 * time.Hour
+
+// keyNamePattern 命名API Key的名称格式
+var keyNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// APIKeyEntry 命名API Key及其元数据，保存在状态存储的keys命名空间中
+type APIKeyEntry struct {
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash,omitempty"` // 密钥的加盐哈希，包含可见前缀
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"` // 零值表示永不过期
+	Enabled   bool      `json:"enabled"`
+	RevokedAt time.Time `json:"revoked_at,omitempty"`
+	Routes    []string  `json:"routes,omitempty"` // 允许访问的路径（支持 path.Match 通配符，如 /v1/accounts/*/access_token），为空时不限制
+	CIDRs     []string  `json:"cidrs,omitempty"`  // 允许的来源地址（CIDR或单个IP），为空时不限制
+
+	RotatedAt         time.Time `json:"rotated_at,omitempty"`
+	PreviousHash      string    `json:"previous_hash,omitempty"`       // 轮换前的密钥哈希，宽限期内仍然有效
+	PreviousExpiresAt time.Time `json:"previous_expires_at,omitempty"` // 轮换前的密钥失效时间
+}
+
+// Prefix 返回用于识别API Key的可见前缀
+func (e APIKeyEntry) Prefix() string {
+	return apikey.VisiblePrefix(e.Hash)
+}
+
+// InGracePeriod 判断轮换前的密钥是否仍在宽限期内
+func (e APIKeyEntry) InGracePeriod(now time.Time) bool {
+	return e.PreviousHash != "" && now.Before(e.PreviousExpiresAt)
+}
+
+// retirePrevious 清除宽限期已结束的旧密钥
+func (e *APIKeyEntry) retirePrevious(now time.Time) {
+	if e.PreviousHash != "" && !e.InGracePeriod(now) {
+		e.PreviousHash = ""
+		e.PreviousExpiresAt = time.Time{}
+	}
+}
+
+// rotate 使用新密钥哈希替换当前哈希，grace大于0时旧密钥在宽限期内仍然有效
+func (e *APIKeyEntry) rotate(hash string, grace time.Duration, now time.Time) {
+	e.PreviousHash = ""
+	e.PreviousExpiresAt = time.Time{}
+	if grace > 0 {
+		e.PreviousHash = e.Hash
+		e.PreviousExpiresAt = now.Add(grace)
+	}
+	e.Hash = hash
+	e.RotatedAt = now
+}
+
+// Expired 判断API Key是否已过期
+func (e APIKeyEntry) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// Active 判断API Key当前是否可用
+func (e APIKeyEntry) Active(now time.Time) bool {
+	return e.Enabled && !e.Expired(now)
+}
+
+// Status 返回用于展示的状态
+func (e APIKeyEntry) Status(now time.Time) string {
+	switch {
+	case !e.Enabled:
+		return "revoked"
+	case e.Expired(now):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// AllowsRoute 判断API Key是否允许访问指定路径
+func (e APIKeyEntry) AllowsRoute(requestPath string) bool {
+	if len(e.Routes) == 0 {
+		return true
+	}
+	for _, route := range e.Routes {
+		if matched, _ := path.Match(route, requestPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsIP 判断API Key是否允许来自指定地址的请求
+func (e APIKeyEntry) AllowsIP(clientIP string) bool {
+	if len(e.CIDRs) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range e.CIDRs {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(cidr); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 验证API Key元数据
+func (e APIKeyEntry) Validate() error {
+	if !keyNamePattern.MatchString(e.Name) {
+		return fmt.Errorf("invalid key name %q: use 1-64 letters, digits, '.', '_' or '-'", e.Name)
+	}
+	if e.Name == DefaultAPIKeyName {
+		return fmt.Errorf("key name %q is reserved for the auto-generated API key", e.Name)
+	}
+	for _, route := range e.Routes {
+		if _, err := path.Match(route, "/"); err != nil || route == "" || route[0] != '/' {
+			return fmt.Errorf("invalid route pattern %q: must be an absolute path, wildcards follow path.Match", route)
+		}
+	}
+	for _, cidr := range e.CIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+			return fmt.Errorf("invalid CIDR or IP address %q", cidr)
+		}
+	}
+	return nil
+}
+
+// ListAPIKeys 返回所有命名API Key（按创建时间排序）
+func (cc *ConfigCache) ListAPIKeys() ([]APIKeyEntry, error) {
+	entries, err := cc.entries()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]APIKeyEntry, 0, len(entries))
+	for name, entry := range entries {
+		if name != DefaultAPIKeyName {
+			keys = append(keys, entry)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	return keys, nil
+}
+
+// GetNamedAPIKey 按名称查找命名API Key
+func (cc *ConfigCache) GetNamedAPIKey(name string) (*APIKeyEntry, error) {
+	if name == DefaultAPIKeyName {
+		return nil, fmt.Errorf("API key %q not found", name)
+	}
+	entry, err := cc.getEntry(name)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("API key %q not found", name)
+	}
+	return entry, err
+}
+
+// CreateAPIKey 生成命名API Key并保存其哈希，返回明文密钥（仅此一次可见）和保存的条目
+func (cc *ConfigCache) CreateAPIKey(entry APIKeyEntry) (string, *APIKeyEntry, error) {
+	if err := entry.Validate(); err != nil {
+		return "", nil, err
+	}
+
+	key, err := cc.GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	if entry.Hash, err = cc.hashAPIKey(key); err != nil {
+		return "", nil, fmt.Errorf("failed to hash API key: %w", err)
+	}
+	entry.CreatedAt = time.Now()
+	entry.Enabled = true
+
+	err = cc.store.Update(store.BucketKeys, entry.Name, func(value []byte, exists bool) ([]byte, error) {
+		if exists {
+			return nil, fmt.Errorf("API key %q already exists", entry.Name)
+		}
+		return json.Marshal(entry)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	cc.audit.Record(audit.ActionKeyCreate, audit.LocalActor(), entry.Name, "owner="+entry.Owner)
+	return key, &entry, nil
+}
+
+// RevokeAPIKey 吊销命名API Key，保留记录用于审计
+func (cc *ConfigCache) RevokeAPIKey(name string) error {
+	if name == DefaultAPIKeyName {
+		return fmt.Errorf("API key %q not found", name)
+	}
+	_, err := cc.updateEntry(name, func(entry *APIKeyEntry, now time.Time) error {
+		if !entry.Enabled {
+			return fmt.Errorf("API key %q is already revoked", name)
+		}
+		entry.Enabled = false
+		entry.RevokedAt = now
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	cc.audit.Record(audit.ActionKeyRevoke, audit.LocalActor(), name, "")
+	return nil
+}
+
+// RotateAPIKey 为命名API Key生成新密钥，旧密钥在宽限期内仍然有效，返回新的明文密钥和更新后的条目
+func (cc *ConfigCache) RotateAPIKey(name string, grace time.Duration) (string, *APIKeyEntry, error) {
+	if name == DefaultAPIKeyName {
+		return "", nil, fmt.Errorf("API key %q not found", name)
+	}
+	return cc.rotateEntry(name, grace)
+}
+
+// RotateDefaultAPIKey 为缓存中自动生成的默认API Key生成新密钥，旧密钥在宽限期内仍然有效，返回新的明文密钥
+func (cc *ConfigCache) RotateDefaultAPIKey(grace time.Duration) (string, *APIKeyEntry, error) {
+	key, rotated, err := cc.rotateEntry(DefaultAPIKeyName, grace)
+	if err != nil && errors.Is(err, store.ErrNotFound) {
+		return "", nil, fmt.Errorf("no cached API key to rotate")
+	}
+	return key, rotated, err
+}
+
+// rotateEntry 为API Key生成新密钥并保存，返回新的明文密钥和更新后的条目
+func (cc *ConfigCache) rotateEntry(name string, grace time.Duration) (string, *APIKeyEntry, error) {
+	key, err := cc.GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+	hash, err := cc.hashAPIKey(key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to hash API key: %w", err)
+	}
+
+	rotated, err := cc.updateEntry(name, func(entry *APIKeyEntry, now time.Time) error {
+		if !entry.Active(now) {
+			return fmt.Errorf("API key %q is %s and cannot be rotated", name, entry.Status(now))
+		}
+		entry.rotate(hash, grace, now)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	cc.audit.Record(audit.ActionKeyRotate, audit.LocalActor(), name, "grace="+grace.String())
+	return key, rotated, nil
+}
+
+// AuthKeys 返回用于鉴权的API Key：includeDefault为true时包含缓存中的默认API Key，其后为所有命名API Key
+func (cc *ConfigCache) AuthKeys(includeDefault bool) ([]APIKeyEntry, error) {
+	keys, err := cc.ListAPIKeys()
+	if err != nil || !includeDefault {
+		return keys, err
+	}
+	entry, err := cc.DefaultAPIKey()
+	if errors.Is(err, store.ErrNotFound) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append([]APIKeyEntry{*entry}, keys...), nil
+}
+
+// HasDefaultAPIKey 判断缓存中是否保存了默认API Key
+func (cc *ConfigCache) HasDefaultAPIKey() bool {
+	entry, err := cc.DefaultAPIKey()
+	return err == nil && entry.Hash != ""
+}
+
+// HasNamedAPIKeys 判断是否存在可用的命名API Key
+func (cc *ConfigCache) HasNamedAPIKeys() bool {
+	keys, err := cc.ListAPIKeys()
+	if err != nil {
+		return false
+	}
+	now := time.Now()
+	for _, key := range keys {
+		if key.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// entries 读取状态存储中的所有API Key（包括默认API Key），按名称索引
+func (cc *ConfigCache) entries() (map[string]APIKeyEntry, error) {
+	values, err := cc.store.List(store.BucketKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys: %w", err)
+	}
+	entries := make(map[string]APIKeyEntry, len(values))
+	for name, value := range values {
+		var entry APIKeyEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse API key %q: %w", name, err)
+		}
+		entries[name] = entry
+	}
+	return entries, nil
+}
+
+// getEntry 读取单个API Key，不存在时返回 store.ErrNotFound
+func (cc *ConfigCache) getEntry(name string) (*APIKeyEntry, error) {
+	value, err := cc.store.Get(store.BucketKeys, name)
+	if err != nil {
+		return nil, err
+	}
+	var entry APIKeyEntry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse API key %q: %w", name, err)
+	}
+	return &entry, nil
+}
+
+// putEntry 保存API Key，覆盖同名条目
+func (cc *ConfigCache) putEntry(entry APIKeyEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return cc.store.Put(store.BucketKeys, entry.Name, value)
+}
+
+// updateEntry 原子地读取-修改-写入单个API Key，同时清除宽限期已结束的旧密钥，返回更新后的条目
+func (cc *ConfigCache) updateEntry(name string, fn func(entry *APIKeyEntry, now time.Time) error) (*APIKeyEntry, error) {
+	var updated APIKeyEntry
+	err := cc.store.Update(store.BucketKeys, name, func(value []byte, exists bool) ([]byte, error) {
+		if !exists {
+			if name == DefaultAPIKeyName {
+				return nil, store.ErrNotFound
+			}
+			return nil, fmt.Errorf("API key %q not found", name)
+		}
+		if err := json.Unmarshal(value, &updated); err != nil {
+			return nil, fmt.Errorf("failed to parse API key %q: %w", name, err)
+		}
+		now := time.Now()
+		updated.retirePrevious(now)
+		if err := fn(&updated, now); err != nil {
+			return nil, err
+		}
+		return json.Marshal(updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
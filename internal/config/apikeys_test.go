@@ -0,0 +1,178 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyEntry(t *testing.T) {
+	now := time.Now()
+
+	entry := APIKeyEntry{Name: "ci", Enabled: true}
+	assert.Equal(t, "active", entry.Status(now))
+	assert.True(t, entry.AllowsRoute("/token"))
+	assert.True(t, entry.AllowsIP("203.0.113.7"))
+
+	entry.ExpiresAt = now.Add(-time.Minute)
+	assert.Equal(t, "expired", entry.Status(now))
+	assert.False(t, entry.Active(now))
+
+	entry.Enabled = false
+	assert.Equal(t, "revoked", entry.Status(now))
+
+	scoped := APIKeyEntry{
+		Name:   "billing",
+		Routes: []string{"/v1/accounts/*/access_token", "/token"},
+		CIDRs:  []string{"10.0.0.0/8", "192.168.1.5"},
+	}
+	require.NoError(t, scoped.Validate())
+	assert.True(t, scoped.AllowsRoute("/v1/accounts/alice@example.com/access_token"))
+	assert.True(t, scoped.AllowsRoute("/token"))
+	assert.False(t, scoped.AllowsRoute("/auth"))
+	assert.True(t, scoped.AllowsIP("10.1.2.3"))
+	assert.True(t, scoped.AllowsIP("192.168.1.5"))
+	assert.False(t, scoped.AllowsIP("192.168.1.6"))
+	assert.False(t, scoped.AllowsIP("not-an-ip"))
+
+	assert.Error(t, APIKeyEntry{Name: ""}.Validate())
+	assert.Error(t, APIKeyEntry{Name: "bad name"}.Validate())
+	assert.Error(t, APIKeyEntry{Name: "ok", Routes: []string{"token"}}.Validate())
+	assert.Error(t, APIKeyEntry{Name: "ok", CIDRs: []string{"10.0.0.0/33"}}.Validate())
+}
+
+func TestConfigCache_NamedAPIKeys(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(viper.Reset)
+
+	cache := newTestCache(t, &Config{})
+	assert.False(t, cache.HasNamedAPIKeys())
+
+	key, created, err := cache.CreateAPIKey(APIKeyEntry{Name: "ci", Owner: "ops@example.com", CIDRs: []string{"10.0.0.0/8"}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, key)
+	assert.True(t, created.Enabled)
+	assert.True(t, cache.HasNamedAPIKeys())
+
+	_, _, err = cache.CreateAPIKey(APIKeyEntry{Name: "ci"})
+	assert.Error(t, err)
+
+	// 只保存哈希
+	data, err := os.ReadFile(cache.GetCacheFile())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), key)
+
+	// 保存默认API Key时保留命名API Key
+	require.NoError(t, cache.SaveCachedConfig("default-key"))
+	keys, err := cache.ListAPIKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, created.Hash, keys[0].Hash)
+	assert.Equal(t, key[:8], keys[0].Prefix())
+	hasher, err := cache.Hasher()
+	require.NoError(t, err)
+	assert.True(t, hasher.Verify(key, keys[0].Hash))
+	assert.Equal(t, "ops@example.com", keys[0].Owner)
+	assert.Equal(t, []string{"10.0.0.0/8"}, keys[0].CIDRs)
+
+	require.NoError(t, cache.RevokeAPIKey("ci"))
+	assert.Error(t, cache.RevokeAPIKey("ci"))
+	assert.Error(t, cache.RevokeAPIKey("missing"))
+	assert.False(t, cache.HasNamedAPIKeys())
+
+	revoked, err := cache.GetNamedAPIKey("ci")
+	require.NoError(t, err)
+	assert.Equal(t, "revoked", revoked.Status(time.Now()))
+	assert.False(t, revoked.RevokedAt.IsZero())
+
+	_, err = cache.GetNamedAPIKey("missing")
+	assert.Error(t, err)
+}
+
+func TestConfigCache_RotateAPIKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(viper.Reset)
+
+	cache := newTestCache(t, &Config{})
+	hasher, err := cache.Hasher()
+	require.NoError(t, err)
+
+	_, _, err = cache.CreateAPIKey(APIKeyEntry{Name: DefaultAPIKeyName})
+	assert.Error(t, err)
+
+	key, _, err := cache.CreateAPIKey(APIKeyEntry{Name: "ci", Owner: "ops@example.com"})
+	require.NoError(t, err)
+
+	newKey, rotated, err := cache.RotateAPIKey("ci", time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, newKey)
+	assert.True(t, hasher.Verify(newKey, rotated.Hash))
+	assert.True(t, hasher.Verify(key, rotated.PreviousHash))
+	assert.True(t, rotated.InGracePeriod(time.Now()))
+	assert.False(t, rotated.InGracePeriod(time.Now().Add(2*time.Hour)))
+
+	keys, err := cache.ListAPIKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, rotated.Hash, keys[0].Hash)
+	assert.Equal(t, "ops@example.com", keys[0].Owner)
+
+	// 不保留宽限期时旧密钥立即失效
+	_, again, err := cache.RotateAPIKey("ci", 0)
+	require.NoError(t, err)
+	assert.Empty(t, again.PreviousHash)
+
+	// 宽限期结束后写入时清除旧密钥
+	_, _, err = cache.RotateAPIKey("ci", time.Nanosecond)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	require.NoError(t, cache.RevokeAPIKey("ci"))
+	revoked, err := cache.GetNamedAPIKey("ci")
+	require.NoError(t, err)
+	assert.Empty(t, revoked.PreviousHash)
+
+	_, _, err = cache.RotateAPIKey("ci", time.Hour)
+	assert.Error(t, err)
+	_, _, err = cache.RotateAPIKey("missing", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestConfigCache_RotateDefaultAPIKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(viper.Reset)
+
+	cache := newTestCache(t, &Config{})
+	hasher, err := cache.Hasher()
+	require.NoError(t, err)
+
+	_, _, err = cache.RotateDefaultAPIKey(time.Hour)
+	assert.Error(t, err)
+
+	oldKey, _, err := cache.GetOrGenerateAPIKey()
+	require.NoError(t, err)
+
+	newKey, rotated, err := cache.RotateDefaultAPIKey(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultAPIKeyName, rotated.Name)
+
+	// 重新启动时使用新密钥的哈希
+	hash, isNew, err := cache.GetOrGenerateAPIKey()
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.True(t, hasher.Verify(newKey, hash))
+
+	keys, err := cache.AuthKeys(true)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.True(t, hasher.Verify(newKey, keys[0].Hash))
+	assert.True(t, hasher.Verify(oldKey, keys[0].PreviousHash))
+	assert.True(t, keys[0].InGracePeriod(time.Now()))
+
+	keys, err = cache.AuthKeys(false)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
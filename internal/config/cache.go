@@ -1,126 +1,158 @@
 package config
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/audit"
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/secret"
+	"gmail-oauth-proxy-server/internal/store"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
-// CachedConfig 缓存的配置结构
-type CachedConfig struct {
-	APIKey      string    `json:"api_key"`
-	CreatedAt   time.Time `json:"created_at"`
-	LastUsed    time.Time `json:"last_used"`
-	Version     string    `json:"version"`
-	Description string    `json:"description"`
+// plaintextPepperWarning 每个进程只提示一次pepper以明文保存
+var plaintextPepperWarning sync.Once
+
+// legacyCachedConfig 旧版本 config.json 的格式（明文保存的自动生成API Key）
+type legacyCachedConfig struct {
+	APIKey    string    `json:"api_key"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // ConfigCache 配置缓存管理器
+// 自动生成的默认API Key和命名API Key保存在状态存储（storage）的keys命名空间中，只保存加盐哈希；
+// 未配置 api_key_pepper 时pepper保存在缓存目录中，启用静态加密时使用主密钥加密
 type ConfigCache struct {
-	cacheDir  string
-	cacheFile string
+	cacheDir   string
+	legacyFile string // 旧版本保存明文API Key的 config.json，打开时迁移到状态存储
+	pepperFile string
+	pepper     string // 配置的API Key pepper（未配置时使用pepperFile）
+	pepperErr  error  // 不允许使用pepper文件的原因（生产环境未启用静态加密）
+	keyring    *secret.Keyring
+	hasher     *apikey.Hasher
+
+	store     store.Store
+	ownsStore bool // Close时关闭状态存储
+	audit     *audit.Log
 }
 
-// NewConfigCache 创建配置缓存管理器
-func NewConfigCache() (*ConfigCache, error) {
-	homeDir, err := os.UserHomeDir()
+// NewConfigCache 按配置打开状态存储并创建配置缓存管理器，使用完毕后需要调用Close
+func NewConfigCache(cfg *Config) (*ConfigCache, error) {
+	keyring, err := cfg.Encryption.Keyring()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		return nil, fmt.Errorf("failed to load master key: %w", err)
 	}
-
-	cacheDir := filepath.Join(homeDir, ".gmail-oauth-proxy")
-	cacheFile := filepath.Join(cacheDir, "config.json")
-
-	return &ConfigCache{
-		cacheDir:  cacheDir,
-		cacheFile: cacheFile,
-	}, nil
+	st, err := store.Open(cfg.Storage.Backend, cfg.Storage.Path, keyring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	cc, err := newConfigCache(cfg, st, keyring)
+	if err != nil {
+		st.Close()
+		return nil, err
+	}
+	cc.ownsStore = true
+	return cc, nil
 }
 
-// EnsureCacheDir 确保缓存目录存在
-func (cc *ConfigCache) EnsureCacheDir() error {
-	if err := os.MkdirAll(cc.cacheDir, 0700); err != nil {
-		return fmt.Errorf("failed to create cache directory: %w", err)
+// NewConfigCacheWithStore 使用已打开的状态存储创建配置缓存管理器（服务器与保险库共用同一存储）
+func NewConfigCacheWithStore(cfg *Config, st store.Store) (*ConfigCache, error) {
+	keyring, err := cfg.Encryption.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load master key: %w", err)
 	}
-	return nil
+	return newConfigCache(cfg, st, keyring)
 }
 
-// GenerateAPIKey 生成安全的API Key
-func (cc *ConfigCache) GenerateAPIKey() (string, error) {
-	// 生成32字节的随机数据
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+// newConfigCache 创建配置缓存管理器并迁移旧版本的 config.json
+func newConfigCache(cfg *Config, st store.Store, keyring *secret.Keyring) (*ConfigCache, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
 	}
 
-	// 转换为十六进制字符串
-	apiKey := hex.EncodeToString(bytes)
-
-	// 添加前缀以便识别
-	return fmt.Sprintf("gop_%s", apiKey), nil
+	cacheDir := filepath.Join(homeDir, ".gmail-oauth-proxy")
+	cc := &ConfigCache{
+		cacheDir:   cacheDir,
+		legacyFile: filepath.Join(cacheDir, "config.json"),
+		pepperFile: filepath.Join(cacheDir, "pepper"),
+		pepper:     cfg.APIKeyPepper,
+		pepperErr:  cfg.ValidateAPIKeyPepper(keyring),
+		keyring:    keyring,
+		store:      st,
+		audit:      audit.New(st),
+	}
+	if err := cc.migrateLegacyConfig(); err != nil {
+		return nil, err
+	}
+	return cc, nil
 }
 
-// SaveCachedConfig 保存缓存配置
-func (cc *ConfigCache) SaveCachedConfig(apiKey string) error {
-	if err := cc.EnsureCacheDir(); err != nil {
-		return err
+// Close 关闭由配置缓存管理器打开的状态存储
+func (cc *ConfigCache) Close() error {
+	if !cc.ownsStore {
+		return nil
 	}
+	return cc.store.Close()
+}
 
-	cachedConfig := CachedConfig{
-		APIKey:      apiKey,
-		CreatedAt:   time.Now(),
-		LastUsed:    time.Now(),
-		Version:     "1.0.0",
-		Description: "Auto-generated API key for Gmail OAuth Proxy Server",
+// Hasher 返回计算API Key哈希使用的Hasher，首次使用时读取（或生成）服务端pepper
+func (cc *ConfigCache) Hasher() (*apikey.Hasher, error) {
+	if cc.hasher != nil {
+		return cc.hasher, nil
 	}
-
-	data, err := json.MarshalIndent(cachedConfig, "", "  ")
+	if cc.pepperErr != nil {
+		return nil, cc.pepperErr
+	}
+	pepper, err := apikey.LoadPepper(cc.pepper, cc.pepperFile, cc.keyring)
 	if err != nil {
-		return fmt.Errorf("failed to marshal cached config: %w", err)
+		return nil, err
 	}
-
-	// 写入文件，设置安全权限
-	if err := os.WriteFile(cc.cacheFile, data, 0600); err != nil {
-		return fmt.Errorf("failed to write cached config: %w", err)
+	if cc.pepper == "" && !cc.keyring.Enabled() {
+		plaintextPepperWarning.Do(func() {
+			logger.Warn("API key pepper is stored unencrypted in %s; set api_key_pepper or configure encryption at rest", cc.pepperFile)
+		})
 	}
-
-	return nil
+	cc.hasher = apikey.NewHasher(pepper)
+	return cc.hasher, nil
 }
 
-// LoadCachedConfig 加载缓存配置
-func (cc *ConfigCache) LoadCachedConfig() (*CachedConfig, error) {
-	if !cc.CacheExists() {
-		return nil, fmt.Errorf("cached config file does not exist")
-	}
-
-	data, err := os.ReadFile(cc.cacheFile)
+// hashAPIKey 计算API Key的加盐哈希
+func (cc *ConfigCache) hashAPIKey(key string) (string, error) {
+	hasher, err := cc.Hasher()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read cached config: %w", err)
+		return "", err
 	}
+	return hasher.Hash(key)
+}
 
-	var cachedConfig CachedConfig
-	if err := json.Unmarshal(data, &cachedConfig); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal cached config: %w", err)
-	}
+// GetPepperFile 获取API Key pepper文件路径
+func (cc *ConfigCache) GetPepperFile() string {
+	return cc.pepperFile
+}
 
-	// 更新最后使用时间
-	cachedConfig.LastUsed = time.Now()
-	if err := cc.SaveCachedConfig(cachedConfig.APIKey); err != nil {
-		// 记录错误但不影响加载
-		fmt.Printf("Warning: failed to update last used time: %v\n", err)
+// EnsureCacheDir 确保缓存目录存在
+func (cc *ConfigCache) EnsureCacheDir() error {
+	if err := os.MkdirAll(cc.cacheDir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
 	}
+	return nil
+}
 
-	return &cachedConfig, nil
+// GenerateAPIKey 生成安全的API Key
+func (cc *ConfigCache) GenerateAPIKey() (string, error) {
+	return apikey.Generate()
 }
 
-// CacheExists 检查缓存文件是否存在
-func (cc *ConfigCache) CacheExists() bool {
-	_, err := os.Stat(cc.cacheFile)
-	return err == nil
+// Persistent 判断API Key是否保存在持久化存储中（内存存储在进程退出后丢失）
+func (cc *ConfigCache) Persistent() bool {
+	_, ok := store.FilePath(cc.store)
+	return ok
 }
 
 // GetCacheDir 获取缓存目录路径
@@ -128,29 +160,64 @@ func (cc *ConfigCache) GetCacheDir() string {
 	return cc.cacheDir
 }
 
-// GetCacheFile 获取缓存文件路径
+// GetCacheFile 获取保存API Key的状态存储文件路径，内存存储时返回说明文字
 func (cc *ConfigCache) GetCacheFile() string {
-	return cc.cacheFile
+	if path, ok := store.FilePath(cc.store); ok {
+		return path
+	}
+	return "(memory)"
 }
 
-// ClearCache 清除缓存
-func (cc *ConfigCache) ClearCache() error {
-	if !cc.CacheExists() {
-		return nil // 缓存不存在，无需清除
+// SaveCachedConfig 保存自动生成的默认API Key，只保存加盐哈希
+func (cc *ConfigCache) SaveCachedConfig(apiKey string) error {
+	hash, err := cc.hashAPIKey(apiKey)
+	if err != nil {
+		return fmt.Errorf("failed to hash API key: %w", err)
 	}
+	return cc.putEntry(APIKeyEntry{
+		Name:      DefaultAPIKeyName,
+		Hash:      hash,
+		CreatedAt: time.Now(),
+		Enabled:   true,
+	})
+}
 
-	if err := os.Remove(cc.cacheFile); err != nil {
-		return fmt.Errorf("failed to remove cached config: %w", err)
-	}
+// DefaultAPIKey 返回缓存中自动生成的默认API Key，尚未生成时返回 store.ErrNotFound
+func (cc *ConfigCache) DefaultAPIKey() (*APIKeyEntry, error) {
+	return cc.getEntry(DefaultAPIKeyName)
+}
+
+// CacheExists 检查状态存储中是否保存了API Key
+func (cc *ConfigCache) CacheExists() bool {
+	values, err := cc.store.List(store.BucketKeys)
+	return err == nil && len(values) > 0
+}
 
+// ClearCache 清除自动生成的默认API Key和所有命名API Key
+func (cc *ConfigCache) ClearCache() error {
+	values, err := cc.store.List(store.BucketKeys)
+	if err != nil {
+		return fmt.Errorf("failed to read API keys: %w", err)
+	}
+	for name := range values {
+		if err := cc.store.Delete(store.BucketKeys, name); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("failed to remove API key %q: %w", name, err)
+		}
+	}
+	cc.audit.Record(audit.ActionKeyClear, audit.LocalActor(), "*", fmt.Sprintf("%d keys", len(values)))
 	return nil
 }
 
 // GetOrGenerateAPIKey 获取或生成API Key
+// 缓存中已有API Key时返回其哈希，新生成时返回明文（仅此一次可见）
 func (cc *ConfigCache) GetOrGenerateAPIKey() (string, bool, error) {
 	// 尝试加载缓存的API Key
-	if cachedConfig, err := cc.LoadCachedConfig(); err == nil {
-		return cachedConfig.APIKey, false, nil // 返回缓存的key，false表示不是新生成的
+	entry, err := cc.DefaultAPIKey()
+	if err == nil && entry.Hash != "" {
+		return entry.Hash, false, nil // 返回缓存的哈希，false表示不是新生成的
+	}
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return "", false, fmt.Errorf("failed to load cached API key: %w", err)
 	}
 
 	// 生成新的API Key
@@ -163,37 +230,66 @@ func (cc *ConfigCache) GetOrGenerateAPIKey() (string, bool, error) {
 	if err := cc.SaveCachedConfig(apiKey); err != nil {
 		return "", false, fmt.Errorf("failed to save API key to cache: %w", err)
 	}
+	cc.audit.Record(audit.ActionKeyGenerate, audit.LocalActor(), DefaultAPIKeyName, "")
 
 	return apiKey, true, nil // 返回新生成的key，true表示是新生成的
 }
 
-// ValidateCache 验证缓存文件的完整性
+// ValidateCache 验证缓存的API Key是否完整
 func (cc *ConfigCache) ValidateCache() error {
-	if !cc.CacheExists() {
-		return fmt.Errorf("cache file does not exist")
-	}
-
-	cachedConfig, err := cc.LoadCachedConfig()
+	entries, err := cc.entries()
 	if err != nil {
-		return fmt.Errorf("failed to load cached config: %w", err)
+		return err
 	}
-
-	if cachedConfig.APIKey == "" {
-		return fmt.Errorf("cached API key is empty")
+	if len(entries) == 0 {
+		return fmt.Errorf("no cached API key")
 	}
-
-	if cachedConfig.CreatedAt.IsZero() {
-		return fmt.Errorf("cached config has invalid creation time")
+	for name, entry := range entries {
+		if entry.Hash == "" {
+			return fmt.Errorf("cached API key %q has no hash", name)
+		}
+		if entry.CreatedAt.IsZero() {
+			return fmt.Errorf("cached API key %q has invalid creation time", name)
+		}
 	}
-
 	return nil
 }
 
-// GetCacheInfo 获取缓存信息
-func (cc *ConfigCache) GetCacheInfo() (*CachedConfig, error) {
-	if !cc.CacheExists() {
-		return nil, fmt.Errorf("cache file does not exist")
+// migrateLegacyConfig 将旧版本 config.json 中明文保存的API Key迁移为状态存储中的哈希，迁移后删除该文件
+// 内存存储无法保存迁移结果，此时保留旧文件
+func (cc *ConfigCache) migrateLegacyConfig() error {
+	data, err := os.ReadFile(cc.legacyFile)
+	if os.IsNotExist(err) || (err == nil && !cc.Persistent()) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read cached config: %w", err)
 	}
 
-	return cc.LoadCachedConfig()
+	var legacy legacyCachedConfig
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("failed to unmarshal cached config %s: %w", cc.legacyFile, err)
+	}
+	if legacy.APIKey != "" {
+		if _, err := cc.DefaultAPIKey(); errors.Is(err, store.ErrNotFound) {
+			hash, err := cc.hashAPIKey(legacy.APIKey)
+			if err != nil {
+				return fmt.Errorf("failed to hash cached API key: %w", err)
+			}
+			if legacy.CreatedAt.IsZero() {
+				legacy.CreatedAt = time.Now()
+			}
+			entry := APIKeyEntry{Name: DefaultAPIKeyName, Hash: hash, CreatedAt: legacy.CreatedAt, Enabled: true}
+			if err := cc.putEntry(entry); err != nil {
+				return fmt.Errorf("failed to migrate cached API key: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to migrate cached API key: %w", err)
+		}
+	}
+
+	if err := os.Remove(cc.legacyFile); err != nil {
+		return fmt.Errorf("failed to remove migrated cached config: %w", err)
+	}
+	return nil
 }
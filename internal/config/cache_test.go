@@ -0,0 +1,159 @@
+package config
+
+import (
+	"encoding/json"
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/secret"
+	"gmail-oauth-proxy-server/internal/store"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init("error")
+}
+
+// newTestCache 在临时HOME下打开使用默认文件存储的配置缓存
+func newTestCache(t *testing.T, cfg *Config) *ConfigCache {
+	t.Helper()
+	cache, err := NewConfigCache(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { cache.Close() })
+	return cache
+}
+
+func TestConfigCache_HashedAPIKey(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(viper.Reset)
+
+	cache := newTestCache(t, &Config{})
+	assert.True(t, cache.Persistent())
+
+	apiKey, isNew, err := cache.GetOrGenerateAPIKey()
+	require.NoError(t, err)
+	assert.True(t, isNew)
+
+	// 状态存储中只有哈希和可见前缀
+	data, err := os.ReadFile(cache.GetCacheFile())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), apiKey)
+	entry, err := cache.DefaultAPIKey()
+	require.NoError(t, err)
+	assert.Equal(t, apiKey[:8], entry.Prefix())
+
+	// 再次获取时返回哈希
+	hash, isNew, err := cache.GetOrGenerateAPIKey()
+	require.NoError(t, err)
+	assert.False(t, isNew)
+	assert.True(t, apikey.IsHash(hash))
+	assert.Equal(t, apiKey[:8]+"****", apikey.Display(hash))
+
+	hasher, err := cache.Hasher()
+	require.NoError(t, err)
+	assert.True(t, hasher.Verify(apiKey, hash))
+	assert.False(t, hasher.Verify(apiKey+"x", hash))
+
+	// 更换pepper后哈希失效
+	peppered := newTestCache(t, &Config{APIKeyPepper: "another-pepper"})
+	otherHasher, err := peppered.Hasher()
+	require.NoError(t, err)
+	assert.False(t, otherHasher.Verify(apiKey, hash))
+
+	// 清除后重新生成
+	require.NoError(t, cache.ClearCache())
+	assert.False(t, cache.CacheExists())
+	_, isNew, err = cache.GetOrGenerateAPIKey()
+	require.NoError(t, err)
+	assert.True(t, isNew)
+}
+
+func TestConfigCache_SharedStore(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(viper.Reset)
+
+	// 服务器与保险库共用同一状态存储，API Key与授权凭据分别保存在各自的命名空间中
+	st := store.NewMemory()
+	cache, err := NewConfigCacheWithStore(&Config{}, st)
+	require.NoError(t, err)
+	assert.False(t, cache.Persistent())
+	assert.Equal(t, "(memory)", cache.GetCacheFile())
+
+	_, _, err = cache.CreateAPIKey(APIKeyEntry{Name: "ci"})
+	require.NoError(t, err)
+	values, err := st.List(store.BucketKeys)
+	require.NoError(t, err)
+	assert.Contains(t, values, "ci")
+
+	// 由调用方关闭共用的存储
+	require.NoError(t, cache.Close())
+	_, err = st.List(store.BucketKeys)
+	assert.NoError(t, err)
+}
+
+func TestConfigCache_LegacyAPIKeyMigration(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Cleanup(viper.Reset)
+
+	// 旧版本在 config.json 中保存的明文API Key
+	legacyFile := filepath.Join(home, ".gmail-oauth-proxy", "config.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(legacyFile), 0700))
+	legacyKey := "gop_0123456789abcdef0123456789abcdef"
+	data, err := json.Marshal(map[string]interface{}{
+		"api_key":    legacyKey,
+		"created_at": time.Now(),
+		"version":    "1.0.0",
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(legacyFile, data, 0600))
+
+	// 打开时迁移为状态存储中的哈希并删除旧文件
+	cache := newTestCache(t, &Config{})
+	_, err = os.Stat(legacyFile)
+	assert.True(t, os.IsNotExist(err))
+	data, err = os.ReadFile(cache.GetCacheFile())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), legacyKey)
+
+	entry, err := cache.DefaultAPIKey()
+	require.NoError(t, err)
+	hasher, err := cache.Hasher()
+	require.NoError(t, err)
+	assert.True(t, hasher.Verify(legacyKey, entry.Hash))
+	assert.Equal(t, "gop_0123****", apikey.Display(entry.Hash))
+	assert.NoError(t, cache.ValidateCache())
+}
+
+func TestConfigCache_PepperInProduction(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(viper.Reset)
+
+	// 生产环境不允许明文保存的pepper文件
+	cache := newTestCache(t, &Config{Environment: "production"})
+	_, err := cache.Hasher()
+	assert.Error(t, err)
+	_, _, err = cache.GetOrGenerateAPIKey()
+	assert.Error(t, err)
+	assert.NoFileExists(t, cache.GetPepperFile())
+
+	configured := newTestCache(t, &Config{Environment: "production", APIKeyPepper: "configured-pepper"})
+	_, err = configured.Hasher()
+	assert.NoError(t, err)
+
+	// 启用静态加密时pepper文件使用主密钥加密
+	masterKey, err := secret.GenerateKey()
+	require.NoError(t, err)
+	encrypted := newTestCache(t, &Config{Environment: "production", Encryption: EncryptionConfig{MasterKey: masterKey}})
+	_, err = encrypted.Hasher()
+	require.NoError(t, err)
+	data, err := os.ReadFile(encrypted.GetPepperFile())
+	require.NoError(t, err)
+	assert.True(t, secret.IsSealed(data))
+}
@@ -1,21 +1,449 @@
 package config
 
 import (
+	"crypto/x509"
 	"fmt"
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/secret"
 	"os"
+	"path"
+	"strings"
 
 	"github.com/spf13/viper"
 )
 
+// Google OAuth 默认上游端点
+const (
+	DefaultAuthURL       = "https://accounts.google.com/o/oauth2/v2/auth"
+	DefaultTokenURL      = "https://oauth2.googleapis.com/token"
+	DefaultUserInfoURL   = "https://www.googleapis.com/oauth2/v2/userinfo"
+	DefaultTokenInfoURL  = "https://www.googleapis.com/oauth2/v1/tokeninfo"
+	DefaultRevokeURL     = "https://oauth2.googleapis.com/revoke"
+	DefaultDeviceCodeURL = "https://oauth2.googleapis.com/device/code"
+)
+
 // Config 应用配置结构
 type Config struct {
-	Port        string   `mapstructure:"port"`
-	APIKey      string   `mapstructure:"api_key"`
-	Environment string   `mapstructure:"environment"`
-	LogLevel    string   `mapstructure:"log_level"`
-	Timeout     int      `mapstructure:"timeout"`
-	IPWhitelist []string `mapstructure:"ip_whitelist"`
-	DisableAuth bool     `mapstructure:"disable_auth"`
+	Port        string            `mapstructure:"port"`
+	APIKey      string            `mapstructure:"api_key"` // 明文API Key或 keys hash 生成的哈希
+	Environment string            `mapstructure:"environment"`
+	LogLevel    string            `mapstructure:"log_level"`
+	Timeout     int               `mapstructure:"timeout"`
+	IPWhitelist []string          `mapstructure:"ip_whitelist"`
+	DisableAuth bool              `mapstructure:"disable_auth"`
+	Upstream    UpstreamConfig    `mapstructure:"upstream"`
+	EgressProxy EgressProxyConfig `mapstructure:"egress_proxy"`
+	EgressPool  EgressPoolConfig  `mapstructure:"egress_pool"`
+	PKCE        PKCEConfig        `mapstructure:"pkce"`
+	AuthParams  AuthParamsConfig  `mapstructure:"auth_params"`
+
+	APIKeyPepper string `mapstructure:"api_key_pepper"` // 计算API Key哈希使用的服务端pepper，未配置时自动生成并保存在缓存目录（启用静态加密时加密保存）
+	APIKeyCached bool   `mapstructure:"-"`              // API Key来自配置缓存（自动生成），运行时从缓存重新加载以支持轮换
+
+	ServiceAccounts []ServiceAccountConfig `mapstructure:"service_accounts"`
+	Clients         []ClientConfig         `mapstructure:"clients"`
+	ClientPolicy    ClientPolicyConfig     `mapstructure:"client_policy"`
+	Vault           VaultConfig            `mapstructure:"vault"`
+	Storage         StorageConfig          `mapstructure:"storage"`
+	Encryption      EncryptionConfig       `mapstructure:"encryption"`
+	RateLimit       RateLimitConfig        `mapstructure:"rate_limit"`
+	Auth            AuthPolicyConfig       `mapstructure:"auth"`
+	BruteForce      BruteForceConfig       `mapstructure:"brute_force"`
+	Admin           AdminConfig            `mapstructure:"admin"`
+	Metrics         MetricsConfig          `mapstructure:"metrics"`
+	Tracing         TracingConfig          `mapstructure:"tracing"`
+	Shutdown        ShutdownConfig         `mapstructure:"shutdown"`
+	TLS             TLSConfig              `mapstructure:"tls"`
+	TrustedProxies  []string               `mapstructure:"trusted_proxies"`  // 受信任的反向代理（CIDR或IP），只采信来自这些地址的转发头
+	ForwardedHeader string                 `mapstructure:"forwarded_header"` // 受信任的代理传递客户端IP使用的转发头：X-Forwarded-For（默认）、Forwarded 或 X-Real-IP
+}
+
+// HasAuthMethod 判断是否配置了任一鉴权方式：API Key、命名API Key、IP白名单或客户端证书
+func (c *Config) HasAuthMethod(hasNamedKeys bool) bool {
+	return c.APIKey != "" || hasNamedKeys || len(c.IPWhitelist) > 0 || len(c.TLS.ClientCerts) > 0
+}
+
+// ValidateAPIKeyPepper 生产环境中pepper文件只能加密保存：未启用静态加密时必须配置 api_key_pepper
+func (c *Config) ValidateAPIKeyPepper(keyring *secret.Keyring) error {
+	if c.Environment == "production" && c.APIKeyPepper == "" && !keyring.Enabled() {
+		return fmt.Errorf("api_key_pepper (OAUTH_PROXY_API_KEY_PEPPER) is required in production unless encryption at rest is configured")
+	}
+	return nil
+}
+
+// 上游端点名称，用于按端点覆盖出站代理等设置
+const (
+	UpstreamToken      = "token"
+	UpstreamUserInfo   = "userinfo"
+	UpstreamTokenInfo  = "tokeninfo"
+	UpstreamRevoke     = "revoke"
+	UpstreamDeviceCode = "device_code"
+)
+
+// UpstreamNames 需要服务端发起请求的上游端点名称
+var UpstreamNames = []string{UpstreamToken, UpstreamUserInfo, UpstreamTokenInfo, UpstreamRevoke, UpstreamDeviceCode}
+
+// UpstreamConfig 上游OAuth服务端点配置
+type UpstreamConfig struct {
+	AuthURL       string `mapstructure:"auth_url"`
+	TokenURL      string `mapstructure:"token_url"`
+	UserInfoURL   string `mapstructure:"userinfo_url"`
+	TokenInfoURL  string `mapstructure:"tokeninfo_url"`
+	RevokeURL     string `mapstructure:"revoke_url"`
+	DeviceCodeURL string `mapstructure:"device_code_url"`
+}
+
+// WithDefaults 返回未配置的端点使用Google默认地址的上游配置
+func (u UpstreamConfig) WithDefaults() UpstreamConfig {
+	if u.AuthURL == "" {
+		u.AuthURL = DefaultAuthURL
+	}
+	if u.TokenURL == "" {
+		u.TokenURL = DefaultTokenURL
+	}
+	if u.UserInfoURL == "" {
+		u.UserInfoURL = DefaultUserInfoURL
+	}
+	if u.TokenInfoURL == "" {
+		u.TokenInfoURL = DefaultTokenInfoURL
+	}
+	if u.RevokeURL == "" {
+		u.RevokeURL = DefaultRevokeURL
+	}
+	if u.DeviceCodeURL == "" {
+		u.DeviceCodeURL = DefaultDeviceCodeURL
+	}
+	return u
+}
+
+// Endpoints 返回端点名称到URL的映射，便于统一展示和校验
+func (u UpstreamConfig) Endpoints() map[string]string {
+	return map[string]string{
+		"auth_url":        u.AuthURL,
+		"token_url":       u.TokenURL,
+		"userinfo_url":    u.UserInfoURL,
+		"tokeninfo_url":   u.TokenInfoURL,
+		"revoke_url":      u.RevokeURL,
+		"device_code_url": u.DeviceCodeURL,
+	}
+}
+
+// EgressProxyConfig 出站代理配置（访问上游时使用的HTTP CONNECT或SOCKS5代理）
+type EgressProxyConfig struct {
+	URL       string            `mapstructure:"url"`
+	Username  string            `mapstructure:"username"`
+	Password  string            `mapstructure:"password"`
+	Upstreams map[string]string `mapstructure:"upstreams"` // 按上游端点覆盖代理地址，"direct" 表示直连
+}
+
+// ProxyURLFor 返回指定上游端点使用的代理地址
+func (e EgressProxyConfig) ProxyURLFor(upstream string) string {
+	if override, ok := e.Upstreams[upstream]; ok && override != "" {
+		return override
+	}
+	return e.URL
+}
+
+// 出站线路类型
+const (
+	EgressRouteDirect = "direct" // 直连上游
+	EgressRouteProxy  = "proxy"  // 经HTTP CONNECT或SOCKS5代理
+	EgressRouteRelay  = "relay"  // 经另一个gmail-oauth-proxy实例中继
+)
+
+// EgressPoolConfig 出站线路池配置，按顺序选择健康线路并在失败时自动切换
+type EgressPoolConfig struct {
+	Routes              []EgressRouteConfig `mapstructure:"routes"`
+	HealthCheckInterval int                 `mapstructure:"health_check_interval"` // 健康探测间隔（秒）
+	HealthCheckTimeout  int                 `mapstructure:"health_check_timeout"`  // 健康探测超时（秒）
+	HealthCheckURL      string              `mapstructure:"health_check_url"`      // 直连/代理线路的探测地址，默认为令牌端点所在主机
+}
+
+// EgressRouteConfig 单条出站线路配置
+type EgressRouteConfig struct {
+	Name     string `mapstructure:"name"`
+	Type     string `mapstructure:"type"`     // direct | proxy | relay
+	URL      string `mapstructure:"url"`      // proxy: 代理地址；relay: 对端代理服务器地址
+	Username string `mapstructure:"username"` // proxy: 代理用户名
+	Password string `mapstructure:"password"` // proxy: 代理密码
+	APIKey   string `mapstructure:"api_key"`  // relay: 对端代理服务器的API Key
+}
+
+// PKCEConfig PKCE配置
+type PKCEConfig struct {
+	ProxyGenerate bool `mapstructure:"proxy_generate"` // 客户端未提供code_challenge时由代理生成并保存code_verifier
+	VerifierTTL   int  `mapstructure:"verifier_ttl"`   // 代理生成的code_verifier有效期（秒）
+}
+
+// AuthParamsConfig 授权请求额外参数透传配置
+type AuthParamsConfig struct {
+	Allowed []string                 `mapstructure:"allowed"` // 允许透传的额外参数，为空时使用内置的Google文档参数列表
+	Rules   map[string]AuthParamRule `mapstructure:"rules"`   // 参数校验规则，覆盖内置规则
+}
+
+// AuthParamRule 额外授权参数校验规则
+type AuthParamRule struct {
+	Pattern   string   `mapstructure:"pattern"`    // 正则表达式，需完整匹配
+	Values    []string `mapstructure:"values"`     // 允许的取值列表
+	MaxLength int      `mapstructure:"max_length"` // 最大长度，默认1024
+}
+
+// ServiceAccountConfig 代理持有的服务账号密钥配置（JWT Bearer授权，RFC 7523）
+type ServiceAccountConfig struct {
+	Name     string   `mapstructure:"name"`
+	KeyFile  string   `mapstructure:"key_file"` // Google服务账号JSON密钥文件路径
+	KeyJSON  string   `mapstructure:"key_json"` // 直接内联的JSON密钥，优先于key_file
+	Scopes   []string `mapstructure:"scopes"`   // 允许申请的权限范围，为空时不限制
+	Subjects []string `mapstructure:"subjects"` // 允许委派的用户（支持通配符，如 *@example.com），为空时禁止域范围委派
+}
+
+// ClientConfig 服务端登记的OAuth客户端，调用方可省略client_secret由代理注入
+type ClientConfig struct {
+	Alias        string   `mapstructure:"alias"` // 可选别名，调用方可用别名代替client_id
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"`
+	RedirectURIs []string `mapstructure:"redirect_uris"` // 允许的回调地址（完全匹配）
+	Scopes       []string `mapstructure:"scopes"`        // 允许申请的权限范围，为空时不限制
+
+	RedirectURIPatterns []string `mapstructure:"redirect_uri_patterns"` // 允许的回调地址正则表达式（需完整匹配），与redirect_uris均为空时不限制
+	ForbiddenScopes     []string `mapstructure:"forbidden_scopes"`      // 禁止申请的权限范围，优先于scopes
+}
+
+// ClientPolicyConfig 全局OAuth客户端策略
+type ClientPolicyConfig struct {
+	RequireRegistered bool     `mapstructure:"require_registered"` // 只允许clients中登记的客户端
+	ForbiddenScopes   []string `mapstructure:"forbidden_scopes"`   // 对所有客户端禁止的权限范围（如 https://mail.google.com/）
+}
+
+// VaultConfig 刷新令牌保险库配置
+type VaultConfig struct {
+	Enabled     bool `mapstructure:"enabled"`      // 授权码交换成功后由代理加密保存refresh_token，需要启用静态加密（encryption）
+	RefreshSkew int  `mapstructure:"refresh_skew"` // 访问令牌到期前提前刷新的秒数
+}
+
+// StorageConfig 代理状态存储配置（刷新令牌保险库的授权凭据）
+type StorageConfig struct {
+	Backend string `mapstructure:"backend"` // file（默认）| memory
+	Path    string `mapstructure:"path"`    // file后端的文件路径，默认 ~/.gmail-oauth-proxy/state.json
+}
+
+// 鉴权组合方式，用于同时配置API Key和IP白名单的情况
+const (
+	AuthModeAll = "all" // API Key和IP白名单都必须通过
+	AuthModeAny = "any" // 任一方式通过即可
+)
+
+// AuthPolicyConfig 鉴权组合策略配置
+type AuthPolicyConfig struct {
+	Mode   string      `mapstructure:"mode"`   // all（默认）或 any
+	Routes []AuthRoute `mapstructure:"routes"` // 按路由覆盖组合方式，按顺序匹配第一条
+}
+
+// AuthRoute 路由级别的鉴权组合方式
+type AuthRoute struct {
+	Path string `mapstructure:"path"` // 请求路径，支持 path.Match 通配符
+	Mode string `mapstructure:"mode"`
+}
+
+// ModeFor 返回请求路径使用的鉴权组合方式
+func (a AuthPolicyConfig) ModeFor(requestPath string) string {
+	for _, route := range a.Routes {
+		if matched, _ := path.Match(route.Path, requestPath); matched {
+			return route.Mode
+		}
+	}
+	if a.Mode == "" {
+		return AuthModeAll
+	}
+	return a.Mode
+}
+
+// Validate 验证鉴权组合策略配置
+func (a AuthPolicyConfig) Validate() error {
+	validMode := func(mode string) bool {
+		return mode == AuthModeAll || mode == AuthModeAny
+	}
+	if a.Mode != "" && !validMode(a.Mode) {
+		return fmt.Errorf("invalid auth mode %q (valid: %s, %s)", a.Mode, AuthModeAll, AuthModeAny)
+	}
+	for _, route := range a.Routes {
+		if route.Path == "" || route.Path[0] != '/' {
+			return fmt.Errorf("invalid auth route %q: must be an absolute path", route.Path)
+		}
+		if _, err := path.Match(route.Path, "/"); err != nil {
+			return fmt.Errorf("invalid auth route pattern %q: %w", route.Path, err)
+		}
+		if !validMode(route.Mode) {
+			return fmt.Errorf("invalid auth mode %q for route %s (valid: %s, %s)", route.Mode, route.Path, AuthModeAll, AuthModeAny)
+		}
+	}
+	return nil
+}
+
+// BruteForceConfig 认证失败封禁配置，按客户端IP统计滑动窗口内提供错误API Key的次数
+type BruteForceConfig struct {
+	Enabled     bool `mapstructure:"enabled"`
+	MaxFailures int  `mapstructure:"max_failures"` // 滑动窗口内允许的失败次数，达到后封禁
+	Window      int  `mapstructure:"window"`       // 滑动窗口（秒）
+	BanDuration int  `mapstructure:"ban_duration"` // 封禁时长（秒）
+}
+
+// AdminConfig 管理端点配置
+type AdminConfig struct {
+	APIKey string `mapstructure:"api_key"` // 访问 /admin 端点的API Key（明文或 keys hash 生成的哈希），未配置时不启用管理端点
+}
+
+// MetricsConfig Prometheus指标配置
+type MetricsConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Path            string `mapstructure:"path"`              // 指标端点路径，默认 /metrics
+	Listen          string `mapstructure:"listen"`            // 独立监听地址（如 127.0.0.1:9090），为空时在主端口提供
+	RequireAdminKey bool   `mapstructure:"require_admin_key"` // 访问指标端点需要 admin.api_key
+}
+
+// TracingConfig OpenTelemetry追踪配置，span通过OTLP/HTTP导出
+type TracingConfig struct {
+	Enabled     bool              `mapstructure:"enabled"`
+	Endpoint    string            `mapstructure:"endpoint"`     // OTLP/HTTP traces端点，默认 http://localhost:4318/v1/traces
+	Headers     map[string]string `mapstructure:"headers"`      // 导出请求附加的请求头（如收集器的鉴权头）
+	ServiceName string            `mapstructure:"service_name"` // 上报的服务名，默认 gmail-oauth-proxy
+	SampleRatio float64           `mapstructure:"sample_ratio"` // 新链路的采样比例（0-1），调用方传入traceparent时跟随调用方的采样决定
+}
+
+// TLSConfig 原生HTTPS配置，配置证书后服务器直接提供HTTPS
+// 证书文件变化或收到SIGHUP时自动重新加载，无需重启
+type TLSConfig struct {
+	CertFile     string   `mapstructure:"cert_file"`     // PEM格式证书（可包含中间证书）
+	KeyFile      string   `mapstructure:"key_file"`      // PEM格式私钥
+	MinVersion   string   `mapstructure:"min_version"`   // 最低TLS版本：1.2 或 1.3，默认 1.2
+	CipherSuites []string `mapstructure:"cipher_suites"` // TLS 1.2密码套件（Go名称），为空时使用Go默认值
+
+	ClientCAFile string             `mapstructure:"client_ca_file"` // 校验客户端证书的CA（PEM），配置后启用mTLS客户端证书认证
+	ClientCerts  []ClientCertConfig `mapstructure:"client_certs"`   // 客户端证书到客户端身份的映射
+}
+
+// Enabled 判断是否启用原生HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// ClientCertConfig 客户端证书身份：CA签发的证书主题或SAN匹配时，以Name作为客户端身份通过API Key鉴权
+// 与命名API Key一样可以限制允许访问的路径和来源地址
+type ClientCertConfig struct {
+	Name    string   `mapstructure:"name"`
+	Owner   string   `mapstructure:"owner"`
+	Subject string   `mapstructure:"subject"` // 匹配证书主题的CN或完整DN（如 CN=mailer,O=Example），支持 path.Match 通配符
+	SAN     string   `mapstructure:"san"`     // 匹配证书任一DNS、URI（如SPIFFE ID）或邮箱SAN，支持 path.Match 通配符
+	Routes  []string `mapstructure:"routes"`  // 允许访问的路径，为空时不限制
+	CIDRs   []string `mapstructure:"cidrs"`   // 允许的来源地址（CIDR或单个IP），为空时不限制
+}
+
+// Matches 判断证书是否属于该客户端身份
+func (c ClientCertConfig) Matches(cert *x509.Certificate) bool {
+	if c.Subject != "" {
+		return matchPattern(c.Subject, cert.Subject.CommonName) || matchPattern(c.Subject, cert.Subject.String())
+	}
+	for _, name := range cert.DNSNames {
+		if matchPattern(c.SAN, name) {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if matchPattern(c.SAN, uri.String()) {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if matchPattern(c.SAN, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsRoute 判断客户端身份是否允许访问指定路径
+func (c ClientCertConfig) AllowsRoute(requestPath string) bool {
+	return c.permissions().AllowsRoute(requestPath)
+}
+
+// AllowsIP 判断客户端身份是否允许来自指定地址的请求
+func (c ClientCertConfig) AllowsIP(clientIP string) bool {
+	return c.permissions().AllowsIP(clientIP)
+}
+
+// Validate 验证客户端证书身份配置
+func (c ClientCertConfig) Validate() error {
+	if err := c.permissions().Validate(); err != nil {
+		return err
+	}
+	if (c.Subject == "") == (c.SAN == "") {
+		return fmt.Errorf("client cert %s: exactly one of subject and san must be set", c.Name)
+	}
+	if _, err := path.Match(c.Subject+c.SAN, ""); err != nil {
+		return fmt.Errorf("client cert %s: invalid pattern %q", c.Name, c.Subject+c.SAN)
+	}
+	return nil
+}
+
+// permissions 以命名API Key的形式表示名称、路径和来源地址限制，复用其校验逻辑
+func (c ClientCertConfig) permissions() APIKeyEntry {
+	return APIKeyEntry{Name: c.Name, Enabled: true, Routes: c.Routes, CIDRs: c.CIDRs}
+}
+
+// matchPattern 使用 path.Match 匹配，无效的模式不匹配任何值
+func matchPattern(pattern, value string) bool {
+	matched, _ := path.Match(pattern, value)
+	return matched
+}
+
+// ShutdownConfig 优雅停机配置
+type ShutdownConfig struct {
+	DrainTimeout int `mapstructure:"drain_timeout"` // 等待进行中的请求完成的最长时间（秒），超时后强制关闭连接
+	Delay        int `mapstructure:"delay"`         // 收到停机信号后继续接受新请求的时间（秒），期间 /health 报告未就绪，供负载均衡器摘除实例
+}
+
+// Validate 验证优雅停机配置
+func (s ShutdownConfig) Validate() error {
+	if s.DrainTimeout <= 0 {
+		return fmt.Errorf("drain_timeout must be greater than 0")
+	}
+	if s.Delay < 0 {
+		return fmt.Errorf("delay must not be negative")
+	}
+	return nil
+}
+
+// RateLimitConfig 令牌桶限流配置，按API Key和客户端IP分别计数
+type RateLimitConfig struct {
+	Enabled bool             `mapstructure:"enabled"`
+	PerKey  RateLimitRule    `mapstructure:"per_key"` // 每个API Key的默认限制
+	PerIP   RateLimitRule    `mapstructure:"per_ip"`  // 每个客户端IP的默认限制
+	Routes  []RouteRateLimit `mapstructure:"routes"`  // 按路由覆盖默认限制，按顺序匹配第一条，匹配后完全替代默认限制
+}
+
+// RateLimitRule 令牌桶参数，RequestsPerMinute为0表示不限制
+type RateLimitRule struct {
+	RequestsPerMinute int `mapstructure:"requests_per_minute"` // 令牌补充速率
+	Burst             int `mapstructure:"burst"`               // 桶容量（允许的突发请求数），为0时等于RequestsPerMinute
+}
+
+// RouteRateLimit 单个路由的限流配置
+type RouteRateLimit struct {
+	Path   string        `mapstructure:"path"` // 请求路径，支持 path.Match 通配符（如 /v1/accounts/*/access_token）
+	PerKey RateLimitRule `mapstructure:"per_key"`
+	PerIP  RateLimitRule `mapstructure:"per_ip"`
+}
+
+// EncryptionConfig 静态加密配置，主密钥只能通过以下一种方式提供
+type EncryptionConfig struct {
+	MasterKey  string `mapstructure:"master_key"` // base64编码的32字节主密钥，建议通过 OAUTH_PROXY_ENCRYPTION_MASTER_KEY 设置
+	KeyFile    string `mapstructure:"key_file"`   // 保存主密钥的文件路径
+	Passphrase string `mapstructure:"passphrase"` // 口令，使用scrypt派生主密钥
+}
+
+// Keyring 根据配置加载主密钥，未配置时返回nil（不加密）
+func (e EncryptionConfig) Keyring() (*secret.Keyring, error) {
+	return secret.LoadKeyring(secret.Source{Key: e.MasterKey, KeyFile: e.KeyFile, Passphrase: e.Passphrase})
 }
 
 // Load 加载配置
@@ -44,8 +472,9 @@ func loadConfig(autoGenerate bool, validate bool) (*Config, error) {
 		viper.AddConfigPath("./config")
 	}
 
-	// 设置环境变量前缀
+	// 设置环境变量前缀，嵌套配置项使用下划线分隔（如 OAUTH_PROXY_UPSTREAM_TOKEN_URL）
 	viper.SetEnvPrefix("OAUTH_PROXY")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	// 设置默认值
@@ -54,6 +483,57 @@ func loadConfig(autoGenerate bool, validate bool) (*Config, error) {
 	viper.SetDefault("log_level", "info")
 	viper.SetDefault("timeout", 10)
 	viper.SetDefault("disable_auth", false)
+	viper.SetDefault("upstream.auth_url", DefaultAuthURL)
+	viper.SetDefault("upstream.token_url", DefaultTokenURL)
+	viper.SetDefault("upstream.userinfo_url", DefaultUserInfoURL)
+	viper.SetDefault("upstream.tokeninfo_url", DefaultTokenInfoURL)
+	viper.SetDefault("upstream.revoke_url", DefaultRevokeURL)
+	viper.SetDefault("upstream.device_code_url", DefaultDeviceCodeURL)
+	viper.SetDefault("egress_proxy.url", "")
+	viper.SetDefault("egress_proxy.username", "")
+	viper.SetDefault("egress_proxy.password", "")
+	viper.SetDefault("egress_pool.health_check_interval", 30)
+	viper.SetDefault("egress_pool.health_check_timeout", 5)
+	viper.SetDefault("pkce.proxy_generate", false)
+	viper.SetDefault("pkce.verifier_ttl", 600)
+	viper.SetDefault("client_policy.require_registered", false)
+	viper.SetDefault("client_policy.forbidden_scopes", []string{})
+	viper.SetDefault("vault.enabled", false)
+	viper.SetDefault("vault.refresh_skew", 60)
+	viper.SetDefault("storage.backend", "file")
+	viper.SetDefault("storage.path", "")
+	viper.SetDefault("encryption.master_key", "")
+	viper.SetDefault("encryption.key_file", "")
+	viper.SetDefault("encryption.passphrase", "")
+	viper.SetDefault("api_key_pepper", "")
+	viper.SetDefault("trusted_proxies", []string{})
+	viper.SetDefault("forwarded_header", "X-Forwarded-For")
+	viper.SetDefault("auth.mode", AuthModeAll)
+	viper.SetDefault("brute_force.enabled", false)
+	viper.SetDefault("brute_force.max_failures", 10)
+	viper.SetDefault("brute_force.window", 300)
+	viper.SetDefault("brute_force.ban_duration", 900)
+	viper.SetDefault("admin.api_key", "")
+	viper.SetDefault("metrics.enabled", false)
+	viper.SetDefault("metrics.path", "/metrics")
+	viper.SetDefault("metrics.listen", "")
+	viper.SetDefault("metrics.require_admin_key", false)
+	viper.SetDefault("tls.cert_file", "")
+	viper.SetDefault("tls.key_file", "")
+	viper.SetDefault("tls.min_version", "1.2")
+	viper.SetDefault("tls.cipher_suites", []string{})
+	viper.SetDefault("tls.client_ca_file", "")
+	viper.SetDefault("shutdown.drain_timeout", 30)
+	viper.SetDefault("shutdown.delay", 0)
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.endpoint", "http://localhost:4318/v1/traces")
+	viper.SetDefault("tracing.service_name", "gmail-oauth-proxy")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("rate_limit.enabled", false)
+	viper.SetDefault("rate_limit.per_key.requests_per_minute", 0)
+	viper.SetDefault("rate_limit.per_key.burst", 0)
+	viper.SetDefault("rate_limit.per_ip.requests_per_minute", 0)
+	viper.SetDefault("rate_limit.per_ip.burst", 0)
 
 	// 从环境变量读取API Key
 	if apiKey := os.Getenv("OAUTH_PROXY_API_KEY"); apiKey != "" {
@@ -65,6 +545,16 @@ func loadConfig(autoGenerate bool, validate bool) (*Config, error) {
 		viper.Set("ip_whitelist", ipWhitelist)
 	}
 
+	// 从环境变量读取受信任的代理
+	if trustedProxies := os.Getenv("OAUTH_PROXY_TRUSTED_PROXIES"); trustedProxies != "" {
+		viper.Set("trusted_proxies", trustedProxies)
+	}
+
+	// 从环境变量读取TLS密码套件
+	if cipherSuites := os.Getenv("OAUTH_PROXY_TLS_CIPHER_SUITES"); cipherSuites != "" {
+		viper.Set("tls.cipher_suites", cipherSuites)
+	}
+
 	// 配置文件已经在root.go中读取，这里不需要重复读取
 
 	var config Config
@@ -73,31 +563,42 @@ func loadConfig(autoGenerate bool, validate bool) (*Config, error) {
 	}
 
 	// 如果没有API Key且启用自动生成，尝试从缓存获取或生成新的
+	// 缓存中已有默认API Key时始终保留，已创建命名API Key时只是不再生成新的
+	// 客户端证书与API Key并存，配置客户端证书身份不影响API Key
+	hasNamedKeys := false
 	if config.APIKey == "" && autoGenerate {
-		cache, err := NewConfigCache()
+		cache, err := NewConfigCache(&config)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create config cache: %w", err)
 		}
+		defer cache.Close()
 
-		apiKey, isNew, err := cache.GetOrGenerateAPIKey()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get or generate API key: %w", err)
-		}
+		hasNamedKeys = cache.HasNamedAPIKeys()
+		if hasNamedKeys && !cache.HasDefaultAPIKey() {
+			fmt.Printf("🔑 使用命名API Key: %s\n", cache.GetCacheFile())
+		} else {
+			apiKey, isNew, err := cache.GetOrGenerateAPIKey()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get or generate API key: %w", err)
+			}
 
-		config.APIKey = apiKey
+			// 内存存储中的哈希随进程退出丢失，此时明文API Key只在本进程内有效
+			config.APIKey = apiKey
+			config.APIKeyCached = cache.Persistent()
 
-		// 如果是新生成的key，给用户提示
-		if isNew {
-			fmt.Printf("🔑 已生成新的API Key: %s\n", apiKey)
-			fmt.Printf("📁 API Key已保存到: %s\n", cache.GetCacheFile())
-		} else {
-			fmt.Printf("🔑 使用缓存的API Key: %s\n", apiKey)
+			// 如果是新生成的key，给用户提示（缓存中只保存哈希，明文只显示这一次）
+			if isNew {
+				fmt.Printf("🔑 已生成新的API Key（仅显示一次，请妥善保存）: %s\n", apiKey)
+				fmt.Printf("📁 API Key哈希已保存到: %s\n", cache.GetCacheFile())
+			} else {
+				fmt.Printf("🔑 使用缓存的API Key: %s\n", apikey.Display(apiKey))
+			}
 		}
 	}
 
 	// 只有在需要验证时才进行鉴权配置验证
-	if validate && !config.DisableAuth && config.APIKey == "" && len(config.IPWhitelist) == 0 {
-		return nil, fmt.Errorf("at least one authentication method is required: API key or IP whitelist")
+	if validate && !config.DisableAuth && !config.HasAuthMethod(hasNamedKeys) {
+		return nil, fmt.Errorf("at least one authentication method is required: API key, IP whitelist or client certificate")
 	}
 
 	return &config, nil
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthPolicyConfig(t *testing.T) {
+	assert.Equal(t, AuthModeAll, AuthPolicyConfig{}.ModeFor("/token"))
+
+	policy := AuthPolicyConfig{
+		Mode:   AuthModeAny,
+		Routes: []AuthRoute{{Path: "/v1/accounts/*/access_token", Mode: AuthModeAll}},
+	}
+	assert.NoError(t, policy.Validate())
+	assert.Equal(t, AuthModeAny, policy.ModeFor("/token"))
+	assert.Equal(t, AuthModeAll, policy.ModeFor("/v1/accounts/a@example.com/access_token"))
+
+	assert.Error(t, AuthPolicyConfig{Mode: "both"}.Validate())
+	assert.Error(t, AuthPolicyConfig{Routes: []AuthRoute{{Path: "/token"}}}.Validate())
+	assert.Error(t, AuthPolicyConfig{Routes: []AuthRoute{{Path: "token", Mode: AuthModeAny}}}.Validate())
+	assert.Error(t, AuthPolicyConfig{Routes: []AuthRoute{{Path: "/[", Mode: AuthModeAny}}}.Validate())
+}
+
+func TestShutdownConfig(t *testing.T) {
+	assert.NoError(t, ShutdownConfig{DrainTimeout: 30}.Validate())
+	assert.NoError(t, ShutdownConfig{DrainTimeout: 30, Delay: 5}.Validate())
+	assert.Error(t, ShutdownConfig{}.Validate())
+	assert.Error(t, ShutdownConfig{DrainTimeout: 30, Delay: -1}.Validate())
+}
+
+func TestClientCertConfig(t *testing.T) {
+	spiffeID, err := url.Parse("spiffe://cluster.local/ns/mail/sa/sender")
+	require.NoError(t, err)
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "mailer", Organization: []string{"Example"}},
+		DNSNames:       []string{"mailer.mail.svc"},
+		URIs:           []*url.URL{spiffeID},
+		EmailAddresses: []string{"ops@example.com"},
+	}
+
+	assert.True(t, ClientCertConfig{Subject: "mailer"}.Matches(cert))
+	assert.True(t, ClientCertConfig{Subject: "CN=mailer,O=Example"}.Matches(cert))
+	assert.True(t, ClientCertConfig{Subject: "mail*"}.Matches(cert))
+	assert.False(t, ClientCertConfig{Subject: "other"}.Matches(cert))
+	assert.True(t, ClientCertConfig{SAN: "*.mail.svc"}.Matches(cert))
+	assert.True(t, ClientCertConfig{SAN: "spiffe://cluster.local/ns/mail/sa/*"}.Matches(cert))
+	assert.True(t, ClientCertConfig{SAN: "ops@example.com"}.Matches(cert))
+	assert.False(t, ClientCertConfig{SAN: "spiffe://cluster.local/ns/other/sa/*"}.Matches(cert))
+	assert.False(t, ClientCertConfig{SAN: "mailer"}.Matches(cert), "subject is not a SAN")
+
+	restricted := ClientCertConfig{Name: "mailer", SAN: "*.mail.svc", Routes: []string{"/token"}, CIDRs: []string{"10.0.0.0/8"}}
+	assert.NoError(t, restricted.Validate())
+	assert.True(t, restricted.AllowsRoute("/token"))
+	assert.False(t, restricted.AllowsRoute("/revoke"))
+	assert.True(t, restricted.AllowsIP("10.1.2.3"))
+	assert.False(t, restricted.AllowsIP("192.168.1.1"))
+
+	assert.Error(t, ClientCertConfig{Name: "mailer"}.Validate(), "subject or san is required")
+	assert.Error(t, ClientCertConfig{Name: "mailer", Subject: "mailer", SAN: "mailer.mail.svc"}.Validate())
+	assert.Error(t, ClientCertConfig{Name: "bad name", Subject: "mailer"}.Validate())
+	assert.Error(t, ClientCertConfig{Name: "mailer", Subject: "["}.Validate())
+	assert.Error(t, ClientCertConfig{Name: "mailer", Subject: "mailer", CIDRs: []string{"bogus"}}.Validate())
+}
+
+func TestConfig_HasAuthMethod(t *testing.T) {
+	assert.False(t, (&Config{}).HasAuthMethod(false))
+	assert.True(t, (&Config{}).HasAuthMethod(true))
+	assert.True(t, (&Config{APIKey: "key"}).HasAuthMethod(false))
+	assert.True(t, (&Config{IPWhitelist: []string{"10.0.0.0/8"}}).HasAuthMethod(false))
+	assert.True(t, (&Config{TLS: TLSConfig{ClientCerts: []ClientCertConfig{{Name: "mailer", Subject: "mailer"}}}}).HasAuthMethod(false))
+}
+
+func TestLoadWithAutoGenerate_ClientCerts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Cleanup(viper.Reset)
+
+	// 客户端证书与API Key并存：配置客户端证书身份时仍然自动生成API Key
+	viper.Set("tls.client_certs", []map[string]interface{}{{"name": "mailer", "subject": "mailer"}})
+	cfg, err := LoadWithAutoGenerate(true)
+	require.NoError(t, err)
+	assert.NotEmpty(t, cfg.APIKey)
+	assert.True(t, cfg.APIKeyCached)
+	require.Len(t, cfg.TLS.ClientCerts, 1)
+
+	// 未自动生成时仅配置客户端证书身份也可以通过鉴权配置验证
+	viper.Reset()
+	viper.Set("tls.client_certs", []map[string]interface{}{{"name": "mailer", "subject": "mailer"}})
+	_, err = LoadWithAutoGenerate(false)
+	require.NoError(t, err)
+
+	// 未配置任何鉴权方式时返回错误
+	viper.Reset()
+	_, err = LoadWithAutoGenerate(false)
+	assert.Error(t, err)
+}
@@ -0,0 +1,136 @@
+package egress
+
+import (
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Direct 表示不经过任何出站代理，直接连接上游
+const Direct = "direct"
+
+// ProxySettings 出站代理设置
+type ProxySettings struct {
+	URL      string // 代理地址，支持 http://、https://、socks5://、socks5h://，为空或 "direct" 表示直连
+	Username string // 代理用户名（URL中已包含凭据时以URL为准）
+	Password string // 代理密码
+}
+
+// SettingsFor 根据配置获取指定上游端点使用的代理设置
+func SettingsFor(cfg config.EgressProxyConfig, upstream string) ProxySettings {
+	return ProxySettings{
+		URL:      cfg.ProxyURLFor(upstream),
+		Username: cfg.Username,
+		Password: cfg.Password,
+	}
+}
+
+// IsDirect 判断是否为直连
+func (s ProxySettings) IsDirect() bool {
+	return s.URL == "" || strings.EqualFold(s.URL, Direct)
+}
+
+// Validate 验证代理地址格式
+func (s ProxySettings) Validate() error {
+	if s.IsDirect() {
+		return nil
+	}
+	_, err := s.parse()
+	return err
+}
+
+// String 返回脱敏后的代理描述，用于日志和配置展示
+func (s ProxySettings) String() string {
+	if s.IsDirect() {
+		return Direct
+	}
+
+	u, err := s.parse()
+	if err != nil {
+		return "invalid"
+	}
+	if u.User != nil {
+		return fmt.Sprintf("%s://%s:****@%s", u.Scheme, u.User.Username(), u.Host)
+	}
+	return u.String()
+}
+
+// parse 解析代理地址并合并凭据
+func (s ProxySettings) parse() (*url.URL, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid egress proxy url %q: %w", s.URL, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported egress proxy scheme %q (supported: http, https, socks5, socks5h)", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("egress proxy url %q has no host", s.URL)
+	}
+
+	if u.User == nil && s.Username != "" {
+		u.User = url.UserPassword(s.Username, s.Password)
+	}
+	return u, nil
+}
+
+// NewTransport 根据代理设置创建HTTP传输层
+// 直连时保留默认传输层行为（仍遵循 HTTPS_PROXY 等环境变量）
+func NewTransport(settings ProxySettings) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if settings.IsDirect() {
+		if strings.EqualFold(settings.URL, Direct) {
+			transport.Proxy = nil
+		}
+		return transport, nil
+	}
+
+	u, err := settings.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		// HTTP CONNECT 代理，凭据通过 Proxy-Authorization 头发送
+		transport.Proxy = http.ProxyURL(u)
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			password, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", u.Host, auth, proxy.Direct)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create socks5 dialer: %w", err)
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, fmt.Errorf("socks5 dialer does not support context")
+		}
+		transport.Proxy = nil
+		transport.DialContext = contextDialer.DialContext
+	}
+
+	return transport, nil
+}
+
+// NewClient 根据代理设置创建访问上游的HTTP客户端
+func NewClient(settings ProxySettings, timeout time.Duration) (*http.Client, error) {
+	transport, err := NewTransport(settings)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}, nil
+}
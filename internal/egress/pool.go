@@ -0,0 +1,395 @@
+package egress
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// relayPaths 上游端点在对端代理服务器上对应的路径
+var relayPaths = map[string]string{
+	config.UpstreamToken:      "/token",
+	config.UpstreamUserInfo:   "/userinfo",
+	config.UpstreamTokenInfo:  "/tokeninfo",
+	config.UpstreamRevoke:     "/revoke",
+	config.UpstreamDeviceCode: "/device/code",
+}
+
+// RouteStatus 出站线路健康状态
+type RouteStatus struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Target      string    `json:"target"`
+	Healthy     bool      `json:"healthy"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+	LastError   string    `json:"last_error,omitempty"` // 错误类别（如 dial_error、timeout），不包含请求地址
+}
+
+// route 单条出站线路
+type route struct {
+	name     string
+	kind     string
+	target   string
+	client   *http.Client
+	relayURL *url.URL
+	apiKey   string
+
+	mu          sync.RWMutex
+	healthy     bool
+	lastChecked time.Time
+	lastError   string
+}
+
+// Pool 出站线路池
+// 请求按配置顺序优先使用健康线路，线路无法建立连接时自动切换到下一条，
+// 后台定期探测每条线路的可用性
+type Pool struct {
+	routes        []*route
+	probeURL      string
+	probeInterval time.Duration
+	probeTimeout  time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// ValidateRoutes 验证出站线路配置
+func ValidateRoutes(routes []config.EgressRouteConfig) error {
+	names := make(map[string]bool, len(routes))
+	for i, rc := range routes {
+		if rc.Name == "" {
+			return fmt.Errorf("egress route #%d has no name", i+1)
+		}
+		if names[rc.Name] {
+			return fmt.Errorf("duplicate egress route name %q", rc.Name)
+		}
+		names[rc.Name] = true
+
+		switch rc.Type {
+		case config.EgressRouteDirect:
+		case config.EgressRouteProxy:
+			settings := ProxySettings{URL: rc.URL, Username: rc.Username, Password: rc.Password}
+			if settings.IsDirect() {
+				return fmt.Errorf("egress route %q: proxy url is required", rc.Name)
+			}
+			if err := settings.Validate(); err != nil {
+				return fmt.Errorf("egress route %q: %w", rc.Name, err)
+			}
+		case config.EgressRouteRelay:
+			u, err := url.Parse(rc.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("egress route %q: invalid relay url %q", rc.Name, rc.URL)
+			}
+		default:
+			return fmt.Errorf("egress route %q: unsupported type %q (supported: direct, proxy, relay)", rc.Name, rc.Type)
+		}
+	}
+	return nil
+}
+
+// NewPool 根据配置创建出站线路池，需要调用 Start 启动健康探测
+func NewPool(cfg config.EgressPoolConfig, upstream config.UpstreamConfig, timeout time.Duration) (*Pool, error) {
+	if err := ValidateRoutes(cfg.Routes); err != nil {
+		return nil, err
+	}
+
+	pool := &Pool{
+		probeURL:      cfg.HealthCheckURL,
+		probeInterval: time.Duration(cfg.HealthCheckInterval) * time.Second,
+		probeTimeout:  time.Duration(cfg.HealthCheckTimeout) * time.Second,
+		stop:          make(chan struct{}),
+	}
+	if pool.probeInterval <= 0 {
+		pool.probeInterval = 30 * time.Second
+	}
+	if pool.probeTimeout <= 0 {
+		pool.probeTimeout = 5 * time.Second
+	}
+	if pool.probeURL == "" {
+		// 默认探测令牌端点所在主机，能得到任意HTTP响应即视为可达
+		if u, err := url.Parse(upstream.WithDefaults().TokenURL); err == nil {
+			pool.probeURL = u.Scheme + "://" + u.Host + "/"
+		}
+	}
+
+	for _, rc := range cfg.Routes {
+		r := &route{name: rc.Name, kind: rc.Type, healthy: true}
+
+		var settings ProxySettings
+		switch rc.Type {
+		case config.EgressRouteDirect:
+			settings = ProxySettings{URL: Direct}
+			r.target = Direct
+		case config.EgressRouteProxy:
+			settings = ProxySettings{URL: rc.URL, Username: rc.Username, Password: rc.Password}
+			r.target = settings.String()
+		case config.EgressRouteRelay:
+			r.relayURL, _ = url.Parse(strings.TrimSuffix(rc.URL, "/"))
+			r.apiKey = rc.APIKey
+			r.target = r.relayURL.String()
+		}
+
+		client, err := NewClient(settings, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("egress route %q: %w", rc.Name, err)
+		}
+		r.client = client
+		pool.routes = append(pool.routes, r)
+	}
+
+	return pool, nil
+}
+
+// Start 启动后台健康探测
+func (p *Pool) Start() {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		p.CheckNow()
+		ticker := time.NewTicker(p.probeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.CheckNow()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close 停止后台健康探测
+func (p *Pool) Close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	p.wg.Wait()
+}
+
+// CheckNow 立即探测所有线路
+func (p *Pool) CheckNow() {
+	var wg sync.WaitGroup
+	for _, r := range p.routes {
+		wg.Add(1)
+		go func(r *route) {
+			defer wg.Done()
+			if err := p.probe(r); err != nil {
+				if r.isHealthy() {
+					logger.Warn("Egress route %s failed health check: %s", r.name, errorClass(err))
+				}
+				r.setHealth(false, err)
+				return
+			}
+			if !r.isHealthy() {
+				logger.Info("Egress route %s recovered", r.name)
+			}
+			r.setHealth(true, nil)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// probe 探测单条线路
+func (p *Pool) probe(r *route) error {
+	probeURL := p.probeURL
+	if r.kind == config.EgressRouteRelay {
+		probeURL = r.relayURL.String() + "/health"
+	}
+
+	client := &http.Client{Transport: r.client.Transport, Timeout: p.probeTimeout}
+	resp, err := client.Get(probeURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	// 对端代理服务器必须明确报告健康；直连/代理线路收到任意响应即说明网络可达
+	if r.kind == config.EgressRouteRelay && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("relay health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Do 通过线路池发送请求，线路无法建立连接时按顺序切换到下一条
+// 连接建立后请求可能已经到达上游（如只能使用一次的授权码），此时出错不再切换线路，直接返回错误
+func (p *Pool) Do(upstream string, req *http.Request) (*http.Response, error) {
+	var lastErr error
+	for _, r := range p.candidates() {
+		attempt, err := r.prepare(upstream, req)
+		if err != nil {
+			return nil, err
+		}
+
+		var connected atomic.Bool
+		trace := &httptrace.ClientTrace{GotConn: func(httptrace.GotConnInfo) { connected.Store(true) }}
+		attempt = attempt.WithContext(httptrace.WithClientTrace(attempt.Context(), trace))
+
+		resp, err := r.client.Do(attempt)
+		if err != nil {
+			if req.Context().Err() != nil {
+				// 调用方已取消请求，不属于线路故障
+				return nil, err
+			}
+			r.setHealth(false, err)
+			if connected.Load() {
+				logger.Warn("Egress route %s failed for %s upstream after connecting, not retrying: %s", r.name, upstream, errorClass(err))
+				return nil, err
+			}
+			logger.Warn("Egress route %s failed for %s upstream, trying next route: %s", r.name, upstream, errorClass(err))
+			lastErr = err
+			continue
+		}
+
+		if r.kind == config.EgressRouteRelay && resp.StatusCode == http.StatusBadGateway {
+			// 对端代理服务器无法访问上游；请求可能已经被转发，不切换线路，后续请求优先使用其他线路
+			logger.Warn("Egress route %s relay returned status %d for %s upstream", r.name, resp.StatusCode, upstream)
+			r.setHealth(false, errRelayBadGateway)
+			return resp, nil
+		}
+
+		r.setHealth(true, nil)
+		return resp, nil
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no egress routes configured")
+	}
+	return nil, fmt.Errorf("all egress routes failed: %w", lastErr)
+}
+
+// Status 返回所有线路的健康状态
+func (p *Pool) Status() []RouteStatus {
+	statuses := make([]RouteStatus, 0, len(p.routes))
+	for _, r := range p.routes {
+		r.mu.RLock()
+		statuses = append(statuses, RouteStatus{
+			Name:        r.name,
+			Type:        r.kind,
+			Target:      r.target,
+			Healthy:     r.healthy,
+			LastChecked: r.lastChecked,
+			LastError:   r.lastError,
+		})
+		r.mu.RUnlock()
+	}
+	return statuses
+}
+
+// Healthy 判断是否至少有一条健康线路
+func (p *Pool) Healthy() bool {
+	for _, r := range p.routes {
+		if r.isHealthy() {
+			return true
+		}
+	}
+	return false
+}
+
+// candidates 返回本次请求的线路尝试顺序：健康线路在前，不健康线路兜底
+func (p *Pool) candidates() []*route {
+	healthy := make([]*route, 0, len(p.routes))
+	var unhealthy []*route
+	for _, r := range p.routes {
+		if r.isHealthy() {
+			healthy = append(healthy, r)
+		} else {
+			unhealthy = append(unhealthy, r)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// prepare 为指定线路构造请求副本，中继线路会改写为对端代理服务器的地址
+func (r *route) prepare(upstream string, req *http.Request) (*http.Request, error) {
+	attempt := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay request body: %w", err)
+		}
+		attempt.Body = body
+	}
+
+	if r.kind != config.EgressRouteRelay {
+		return attempt, nil
+	}
+
+	path, ok := relayPaths[upstream]
+	if !ok {
+		return nil, fmt.Errorf("egress route %s cannot relay %s upstream", r.name, upstream)
+	}
+	target := *r.relayURL
+	target.Path = r.relayURL.Path + path
+	target.RawQuery = req.URL.RawQuery
+	attempt.URL = &target
+	attempt.Host = target.Host
+	if r.apiKey != "" {
+		attempt.Header.Set("X-API-Key", r.apiKey)
+	}
+	return attempt, nil
+}
+
+func (r *route) isHealthy() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.healthy
+}
+
+func (r *route) setHealth(healthy bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.healthy = healthy
+	r.lastChecked = time.Now()
+	r.lastError = ""
+	if err != nil {
+		r.lastError = errorClass(err)
+	}
+}
+
+// errRelayBadGateway 对端代理服务器返回502
+var errRelayBadGateway = errors.New("relay_bad_gateway")
+
+// errorClass 将线路错误归类为简短的错误类别
+// 原始错误（*url.Error）包含完整的请求地址，tokeninfo 等请求的查询参数中带有访问令牌，不能保存或记录
+func errorClass(err error) string {
+	var (
+		netErr  net.Error
+		opErr   *net.OpError
+		dnsErr  *net.DNSError
+		certErr *tls.CertificateVerificationError
+		unknown x509.UnknownAuthorityError
+		header  tls.RecordHeaderError
+	)
+	switch {
+	case errors.Is(err, errRelayBadGateway):
+		return errRelayBadGateway.Error()
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns_error"
+	case errors.As(err, &certErr), errors.As(err, &unknown), errors.As(err, &header):
+		return "tls_error"
+	case errors.As(err, &opErr):
+		return opErr.Op + "_error" // dial_error、proxyconnect_error、read_error 等
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "connection_closed"
+	}
+	return "transport_error"
+}
@@ -0,0 +1,223 @@
+package egress
+
+import (
+	"bufio"
+	"bytes"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init("error")
+}
+
+// deadProxy 不可达的代理地址
+const deadProxy = "http://127.0.0.1:1"
+
+func newTokenUpstream(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("path=" + r.URL.Path + " body=" + string(body) + " key=" + r.Header.Get("X-API-Key")))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestPool(t *testing.T, routes []config.EgressRouteConfig, upstream config.UpstreamConfig) *Pool {
+	t.Helper()
+	pool, err := NewPool(config.EgressPoolConfig{
+		Routes:              routes,
+		HealthCheckInterval: 60,
+		HealthCheckTimeout:  1,
+	}, upstream, 2*time.Second)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func postToken(t *testing.T, pool *Pool, tokenURL string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequest("POST", tokenURL, bytes.NewBufferString("grant_type=refresh_token"))
+	require.NoError(t, err)
+	return pool.Do(config.UpstreamToken, req)
+}
+
+func TestValidateRoutes(t *testing.T) {
+	assert.NoError(t, ValidateRoutes(nil))
+	assert.NoError(t, ValidateRoutes([]config.EgressRouteConfig{
+		{Name: "direct", Type: config.EgressRouteDirect},
+		{Name: "squid", Type: config.EgressRouteProxy, URL: "http://proxy:3128"},
+		{Name: "peer", Type: config.EgressRouteRelay, URL: "https://peer.example.com"},
+	}))
+
+	assert.Error(t, ValidateRoutes([]config.EgressRouteConfig{{Type: config.EgressRouteDirect}}))
+	assert.Error(t, ValidateRoutes([]config.EgressRouteConfig{
+		{Name: "a", Type: config.EgressRouteDirect},
+		{Name: "a", Type: config.EgressRouteDirect},
+	}))
+	assert.Error(t, ValidateRoutes([]config.EgressRouteConfig{{Name: "squid", Type: config.EgressRouteProxy}}))
+	assert.Error(t, ValidateRoutes([]config.EgressRouteConfig{{Name: "peer", Type: config.EgressRouteRelay, URL: "peer:8080"}}))
+	assert.Error(t, ValidateRoutes([]config.EgressRouteConfig{{Name: "vpn", Type: "vpn"}}))
+}
+
+func TestPool_FailoverToNextRoute(t *testing.T) {
+	upstream := newTokenUpstream(t)
+	pool := newTestPool(t, []config.EgressRouteConfig{
+		{Name: "broken", Type: config.EgressRouteProxy, URL: deadProxy},
+		{Name: "direct", Type: config.EgressRouteDirect},
+	}, config.UpstreamConfig{TokenURL: upstream.URL + "/token"})
+
+	resp, err := postToken(t, pool, upstream.URL+"/token")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	// 请求体在切换线路后被完整重放
+	assert.Equal(t, "path=/token body=grant_type=refresh_token key=", string(body))
+
+	statuses := pool.Status()
+	require.Len(t, statuses, 2)
+	assert.False(t, statuses[0].Healthy)
+	assert.Equal(t, "proxyconnect_error", statuses[0].LastError)
+	assert.True(t, statuses[1].Healthy)
+	assert.True(t, pool.Healthy())
+
+	// 不健康线路被排到后面
+	assert.Equal(t, "direct", pool.candidates()[0].name)
+}
+
+func TestPool_AllRoutesFail(t *testing.T) {
+	pool := newTestPool(t, []config.EgressRouteConfig{
+		{Name: "broken-1", Type: config.EgressRouteProxy, URL: deadProxy},
+		{Name: "broken-2", Type: config.EgressRouteProxy, URL: "socks5://127.0.0.1:1"},
+	}, config.UpstreamConfig{})
+
+	_, err := postToken(t, pool, "http://oauth.invalid/token")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "all egress routes failed")
+	assert.False(t, pool.Healthy())
+}
+
+func TestPool_Relay(t *testing.T) {
+	peer := newTokenUpstream(t)
+	pool := newTestPool(t, []config.EgressRouteConfig{
+		{Name: "peer", Type: config.EgressRouteRelay, URL: peer.URL + "/", APIKey: "gop_peer"},
+	}, config.UpstreamConfig{})
+
+	resp, err := postToken(t, pool, config.DefaultTokenURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	assert.Equal(t, "path=/token body=grant_type=refresh_token key=gop_peer", string(body))
+
+	t.Run("unsupported upstream", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "http://oauth.invalid/other", nil)
+		_, err := pool.Do("other", req)
+		assert.Error(t, err)
+	})
+}
+
+func TestPool_RelayBadGatewayMarksUnhealthy(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(`{"error":"temporarily_unavailable"}`))
+	}))
+	defer peer.Close()
+	upstream := newTokenUpstream(t)
+
+	pool := newTestPool(t, []config.EgressRouteConfig{
+		{Name: "peer", Type: config.EgressRouteRelay, URL: peer.URL},
+		{Name: "direct", Type: config.EgressRouteDirect},
+	}, config.UpstreamConfig{})
+
+	// 对端可能已经转发了请求，不在本次请求中重试
+	resp, err := postToken(t, pool, upstream.URL+"/token")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.False(t, pool.Status()[0].Healthy)
+	assert.Equal(t, "relay_bad_gateway", pool.Status()[0].LastError)
+
+	// 后续请求优先使用健康线路
+	resp, err = postToken(t, pool, upstream.URL+"/token")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestPool_NoFailoverAfterConnect(t *testing.T) {
+	// 读取请求后直接断开连接，模拟请求已经到达上游但未得到响应
+	var requests atomic.Int32
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			requests.Add(1)
+			http.ReadRequest(bufio.NewReader(conn))
+			conn.Close()
+		}
+	}()
+	upstream := newTokenUpstream(t)
+
+	// 第一条线路是指向断开连接的服务器的HTTP代理：连接成功，请求已发出
+	pool := newTestPool(t, []config.EgressRouteConfig{
+		{Name: "flaky", Type: config.EgressRouteProxy, URL: "http://" + listener.Addr().String()},
+		{Name: "direct", Type: config.EgressRouteDirect},
+	}, config.UpstreamConfig{})
+
+	_, err = postToken(t, pool, upstream.URL+"/token?access_token=ya29.secret")
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	status := pool.Status()[0]
+	assert.False(t, status.Healthy)
+	assert.Equal(t, "connection_closed", status.LastError)
+	assert.NotContains(t, status.LastError, "ya29")
+}
+
+func TestPool_HealthCheck(t *testing.T) {
+	upstream := newTokenUpstream(t)
+	unhealthyPeer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthyPeer.Close()
+	healthyPeer := newTokenUpstream(t)
+
+	pool := newTestPool(t, []config.EgressRouteConfig{
+		{Name: "direct", Type: config.EgressRouteDirect},
+		{Name: "broken", Type: config.EgressRouteProxy, URL: deadProxy},
+		{Name: "unhealthy-peer", Type: config.EgressRouteRelay, URL: unhealthyPeer.URL},
+		{Name: "healthy-peer", Type: config.EgressRouteRelay, URL: healthyPeer.URL},
+	}, config.UpstreamConfig{TokenURL: upstream.URL + "/token"})
+
+	pool.CheckNow()
+
+	healthy := map[string]bool{}
+	for _, status := range pool.Status() {
+		healthy[status.Name] = status.Healthy
+		assert.False(t, status.LastChecked.IsZero())
+	}
+	assert.Equal(t, map[string]bool{
+		"direct":         true,
+		"broken":         false,
+		"unhealthy-peer": false,
+		"healthy-peer":   true,
+	}, healthy)
+}
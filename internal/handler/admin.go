@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"fmt"
+	"gmail-oauth-proxy-server/internal/audit"
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/middleware"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminHandler 管理端点处理器
+type AdminHandler struct {
+	bans  *middleware.BanList
+	audit *audit.Log
+}
+
+// NewAdminHandler 创建管理端点处理器，bans为nil表示未启用认证失败封禁，解除封禁时写入审计日志
+func NewAdminHandler(bans *middleware.BanList, auditLog *audit.Log) *AdminHandler {
+	return &AdminHandler{bans: bans, audit: auditLog}
+}
+
+// ListBans 列出当前生效的封禁
+func (h *AdminHandler) ListBans(c *gin.Context) {
+	bans := h.bans.List()
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": h.bans != nil,
+		"count":   len(bans),
+		"bans":    bans,
+	})
+}
+
+// ClearBans 解除所有封禁
+func (h *AdminHandler) ClearBans(c *gin.Context) {
+	cleared := h.bans.ClearAll()
+	logger.Info("Cleared %d bans", cleared)
+	h.audit.Record(audit.ActionBanClear, audit.ActorAdmin, "*", fmt.Sprintf("%d bans", cleared))
+	c.JSON(http.StatusOK, gin.H{"cleared": cleared})
+}
+
+// ClearBan 解除单个IP的封禁，地址按规范形式匹配（如 2001:DB8:0::1 与 2001:db8::1 相同）
+func (h *AdminHandler) ClearBan(c *gin.Context) {
+	addr := net.ParseIP(c.Param("ip"))
+	if addr == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":             "invalid_request",
+			"error_description": "Invalid IP address",
+		})
+		return
+	}
+	ip := addr.String()
+	if !h.bans.Clear(ip) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":             "not_found",
+			"error_description": "IP address is not banned",
+		})
+		return
+	}
+	logger.Info("Cleared ban for %s", ip)
+	h.audit.Record(audit.ActionBanClear, audit.ActorAdmin, ip, "")
+	c.JSON(http.StatusOK, gin.H{"cleared": 1})
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"net/url"
+	"regexp"
+	"sort"
+)
+
+// defaultAuthParamMaxLength 未配置长度限制时额外参数的最大长度
+const defaultAuthParamMaxLength = 1024
+
+// coreAuthParams 由 AuthRequest 直接处理的授权参数
+var coreAuthParams = map[string]bool{
+	"client_id":             true,
+	"redirect_uri":          true,
+	"scope":                 true,
+	"state":                 true,
+	"response_type":         true,
+	"access_type":           true,
+	"prompt":                true,
+	"code_challenge":        true,
+	"code_challenge_method": true,
+}
+
+// builtinAuthParamRules Google授权端点文档中的可选参数及其校验规则
+var builtinAuthParamRules = map[string]config.AuthParamRule{
+	"login_hint":              {MaxLength: 256},
+	"hd":                      {Pattern: `\*|[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?`, MaxLength: 253},
+	"include_granted_scopes":  {Values: []string{"true", "false"}},
+	"enable_granular_consent": {Values: []string{"true", "false"}},
+	"nonce":                   {Pattern: `[\x21-\x7E]+`, MaxLength: 256},
+	"display":                 {Values: []string{"page", "popup", "touch", "wap"}},
+}
+
+// authParamRule 编译后的参数校验规则
+type authParamRule struct {
+	pattern   *regexp.Regexp
+	values    []string
+	maxLength int
+}
+
+// authParamPolicy 授权请求额外参数透传策略
+type authParamPolicy struct {
+	rules map[string]authParamRule
+}
+
+// ValidateAuthParamsConfig 验证额外授权参数配置
+func ValidateAuthParamsConfig(cfg config.AuthParamsConfig) error {
+	_, err := newAuthParamPolicy(cfg)
+	return err
+}
+
+// newAuthParamPolicy 根据配置构建透传策略，未配置允许列表时使用内置参数列表
+func newAuthParamPolicy(cfg config.AuthParamsConfig) (*authParamPolicy, error) {
+	allowed := cfg.Allowed
+	if len(allowed) == 0 {
+		for name := range builtinAuthParamRules {
+			allowed = append(allowed, name)
+		}
+	}
+
+	policy := &authParamPolicy{rules: make(map[string]authParamRule, len(allowed))}
+	for _, name := range allowed {
+		if coreAuthParams[name] {
+			return nil, fmt.Errorf("auth_params.allowed: %s is a core parameter and is always forwarded", name)
+		}
+
+		rule, ok := cfg.Rules[name]
+		if !ok {
+			rule = builtinAuthParamRules[name]
+		}
+
+		compiled := authParamRule{values: rule.Values, maxLength: rule.MaxLength}
+		if compiled.maxLength <= 0 {
+			compiled.maxLength = defaultAuthParamMaxLength
+		}
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(`^(?:` + rule.Pattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("auth_params.rules.%s: invalid pattern: %w", name, err)
+			}
+			compiled.pattern = pattern
+		}
+		policy.rules[name] = compiled
+	}
+
+	for name := range cfg.Rules {
+		if _, ok := policy.rules[name]; !ok {
+			return nil, fmt.Errorf("auth_params.rules.%s: parameter is not in auth_params.allowed", name)
+		}
+	}
+
+	return policy, nil
+}
+
+// extract 校验并提取需要透传的额外参数，存在未知参数时返回错误
+func (p *authParamPolicy) extract(query url.Values) (url.Values, error) {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	extra := url.Values{}
+	for _, name := range names {
+		if coreAuthParams[name] {
+			continue
+		}
+
+		rule, ok := p.rules[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported parameter: %s", name)
+		}
+
+		values := query[name]
+		if len(values) != 1 {
+			return nil, fmt.Errorf("parameter %s must be specified exactly once", name)
+		}
+		if err := rule.validate(name, values[0]); err != nil {
+			return nil, err
+		}
+		extra.Set(name, values[0])
+	}
+
+	return extra, nil
+}
+
+// validate 按规则校验参数值
+func (r authParamRule) validate(name, value string) error {
+	if value == "" {
+		return fmt.Errorf("parameter %s must not be empty", name)
+	}
+	if len(value) > r.maxLength {
+		return fmt.Errorf("parameter %s exceeds maximum length of %d", name, r.maxLength)
+	}
+	if len(r.values) > 0 {
+		for _, allowed := range r.values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid value for parameter %s", name)
+	}
+	if r.pattern != nil && !r.pattern.MatchString(value) {
+		return fmt.Errorf("invalid format for parameter %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceCodeRequest 设备授权请求结构（RFC 8628 第3.1节）
+type DeviceCodeRequest struct {
+	ClientID string `json:"client_id" form:"client_id" binding:"required"`
+	Scope    string `json:"scope" form:"scope" binding:"required"`
+}
+
+// DeviceCodeHandler 处理设备授权请求 - 代理 upstream.device_code_url（默认 https://oauth2.googleapis.com/device/code）
+// 返回的device_code通过 /token 以 urn:ietf:params:oauth:grant-type:device_code 轮询换取令牌
+func (h *OAuthHandler) DeviceCodeHandler(c *gin.Context) {
+	var req DeviceCodeRequest
+
+	// 与token端点一致，同时支持form-urlencoded和JSON格式
+	if err := bindFormOrJSON(c, &req); err != nil {
+		HandleValidationError(c, err)
+		return
+	}
+	traceOAuthRequest(c, req.ClientID, "")
+
+	// 按客户端策略校验权限范围，已登记的客户端解析别名
+	client, policy, err := h.registry.Lookup(req.ClientID)
+	if err != nil {
+		HandleClientError(c, err)
+		return
+	}
+	if err := policy.CheckScopes(strings.Fields(req.Scope)); err != nil {
+		HandleScopeError(c, err)
+		return
+	}
+	if client != nil {
+		req.ClientID = client.ID
+	}
+
+	formData := url.Values{}
+	formData.Set("client_id", req.ClientID)
+	formData.Set("scope", req.Scope)
+
+	// 创建请求到Google Device Authorization API
+	googleURL := h.upstream.DeviceCodeURL
+	googleReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", googleURL, bytes.NewBufferString(formData.Encode()))
+	if err != nil {
+		HandleInternalError(c, err)
+		return
+	}
+
+	// 设置请求头
+	googleReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	googleReq.Header.Set("User-Agent", "Gmail-OAuth-Proxy-Server/1.0")
+
+	// 记录请求日志
+	logger.Info("Forwarding request to Google Device Authorization API: url=%s, client_id=%s, scope=%s", googleURL, req.ClientID, req.Scope)
+
+	// 发送请求
+	resp, err := h.doUpstream(config.UpstreamDeviceCode, googleReq)
+	if err != nil {
+		HandleProxyError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// 读取响应
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		HandleProxyError(c, err)
+		return
+	}
+
+	// 解析响应用于日志记录（脱敏，device_code和user_code均不完整输出）
+	var responseData map[string]interface{}
+	if err := json.Unmarshal(body, &responseData); err == nil {
+		sanitizedResp := logger.SanitizeForLog(responseData)
+		logger.Info("Received response from Google Device Authorization API: status=%d, data=%+v", resp.StatusCode, sanitizedResp)
+	}
+	recordUpstreamError(config.UpstreamDeviceCode, resp.StatusCode, oauthErrorCode(responseData))
+
+	// 设置响应头
+	c.Header("Content-Type", resp.Header.Get("Content-Type"))
+
+	// 返回Google的原始响应
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"gmail-oauth-proxy-server/internal/logger"
 	"net/http"
+	"net/url"
 
 	"github.com/gin-gonic/gin"
 )
@@ -78,3 +79,65 @@ func HandleAuthorizationError(c *gin.Context, err error) {
 		ErrorURI:         "https://tools.ietf.org/html/rfc6750#section-3.1",
 	})
 }
+
+// HandleScopeError 处理权限范围错误
+func HandleScopeError(c *gin.Context, err error) {
+	logger.Warn("Scope error: %v", err)
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Error:            "invalid_scope",
+		ErrorDescription: err.Error(),
+		ErrorURI:         "https://tools.ietf.org/html/rfc6749#section-5.2",
+	})
+}
+
+// HandleAccessDeniedError 处理访问被拒绝错误
+func HandleAccessDeniedError(c *gin.Context, err error) {
+	logger.Warn("Access denied: %v", err)
+	c.JSON(http.StatusForbidden, ErrorResponse{
+		Error:            "access_denied",
+		ErrorDescription: err.Error(),
+		ErrorURI:         "https://tools.ietf.org/html/rfc6749#section-4.1.2.1",
+	})
+}
+
+// HandleNotFoundError 处理资源不存在错误
+func HandleNotFoundError(c *gin.Context, err error) {
+	logger.Warn("Not found: %v", err)
+	c.JSON(http.StatusNotFound, ErrorResponse{
+		Error:            "not_found",
+		ErrorDescription: err.Error(),
+	})
+}
+
+// HandleClientError 处理客户端认证错误
+func HandleClientError(c *gin.Context, err error) {
+	logger.Warn("Client error: %v", err)
+	c.JSON(http.StatusUnauthorized, ErrorResponse{
+		Error:            "invalid_client",
+		ErrorDescription: err.Error(),
+		ErrorURI:         "https://tools.ietf.org/html/rfc6749#section-5.2",
+	})
+}
+
+// HandleGrantError 处理授权许可错误
+func HandleGrantError(c *gin.Context, err error) {
+	logger.Warn("Grant error: %v", err)
+	c.JSON(http.StatusBadRequest, ErrorResponse{
+		Error:            "invalid_grant",
+		ErrorDescription: err.Error(),
+		ErrorURI:         "https://tools.ietf.org/html/rfc6749#section-5.2",
+	})
+}
+
+// RedirectAuthError 将授权错误通过回调地址返回给客户端（RFC 6749 第4.1.2.1节）
+// 仅在回调地址已校验通过时使用，否则应直接返回错误而不重定向
+func RedirectAuthError(c *gin.Context, redirectURI, state, errorCode string, err error) {
+	logger.Warn("Authorization request rejected (%s): %v", errorCode, err)
+	params := url.Values{}
+	params.Set("error", errorCode)
+	params.Set("error_description", err.Error())
+	if state != "" {
+		params.Set("state", state)
+	}
+	c.Redirect(http.StatusFound, appendQuery(redirectURI, params))
+}
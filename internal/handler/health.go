@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// egressHealth 健康检查中报告的出站线路状态
+// 健康检查不需要鉴权，不报告线路地址（可能包含代理凭据和内网地址）和错误详情
+type egressHealth struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Healthy     bool      `json:"healthy"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+}
+
+// HealthHandler 健康检查处理器
+type HealthHandler struct {
+	oauth *OAuthHandler
+}
+
+// NewHealthHandler 创建健康检查处理器
+func NewHealthHandler(oauth *OAuthHandler) *HealthHandler {
+	return &HealthHandler{oauth: oauth}
+}
+
+// Health 处理健康检查请求
+// 配置了出站线路池时报告各线路状态，所有线路均不可用时返回503；开始停机后同样返回503，负载均衡器据此摘除实例
+func (h *HealthHandler) Health(c *gin.Context) {
+	statusCode := http.StatusOK
+	response := gin.H{
+		"status":  "ok",
+		"service": "gmail-oauth-proxy-server",
+	}
+
+	if h.oauth.Draining() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "draining",
+			"service": "gmail-oauth-proxy-server",
+		})
+		return
+	}
+
+	if routes := h.oauth.EgressStatus(); routes != nil {
+		egress := make([]egressHealth, 0, len(routes))
+		for _, route := range routes {
+			egress = append(egress, egressHealth{
+				Name:        route.Name,
+				Type:        route.Type,
+				Healthy:     route.Healthy,
+				LastChecked: route.LastChecked,
+			})
+		}
+		response["egress"] = egress
+		if !h.oauth.EgressHealthy() {
+			statusCode = http.StatusServiceUnavailable
+			response["status"] = "unavailable"
+		}
+	}
+
+	c.JSON(statusCode, response)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/metrics"
+	"gmail-oauth-proxy-server/internal/middleware"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpstreamErrorTransport 上游请求未得到响应（连接失败、超时等）时记录的错误码
+const UpstreamErrorTransport = "transport_error"
+
+// DefaultMetricsPath 默认的指标端点路径
+const DefaultMetricsPath = "/metrics"
+
+// ValidateMetricsConfig 验证指标配置
+func ValidateMetricsConfig(cfg *config.Config) error {
+	if !cfg.Metrics.Enabled {
+		return nil
+	}
+	if cfg.Metrics.Path != "" && cfg.Metrics.Path[0] != '/' {
+		return fmt.Errorf("invalid metrics path %q: must be an absolute path", cfg.Metrics.Path)
+	}
+	if cfg.Metrics.RequireAdminKey && cfg.Admin.APIKey == "" {
+		return fmt.Errorf("metrics.require_admin_key requires admin.api_key")
+	}
+	return nil
+}
+
+// NewMetricsEngine 创建在独立端口（metrics.listen）上提供指标的引擎
+func NewMetricsEngine(cfg *config.Config) (*gin.Engine, error) {
+	r := gin.New()
+	r.SetTrustedProxies(nil)
+	if err := registerMetrics(r, cfg, nil); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// registerMetrics 注册Prometheus指标端点，需要时使用管理API Key鉴权
+func registerMetrics(r gin.IRoutes, cfg *config.Config, bans *middleware.BanList) error {
+	if err := ValidateMetricsConfig(cfg); err != nil {
+		return err
+	}
+	path := cfg.Metrics.Path
+	if path == "" {
+		path = DefaultMetricsPath
+	}
+
+	handlers := []gin.HandlerFunc{gin.WrapH(metrics.Handler())}
+	if cfg.Metrics.RequireAdminKey {
+		hasher, err := adminHasher(cfg)
+		if err != nil {
+			return err
+		}
+		handlers = append([]gin.HandlerFunc{middleware.AdminAuth(cfg.Admin.APIKey, hasher, bans)}, handlers...)
+	}
+	r.GET(path, handlers...)
+	return nil
+}
+
+// oauthErrorCode 从已解析的上游响应中提取OAuth错误码（error字段）
+// Google API风格的错误对象（{"error": {"status": "UNAUTHENTICATED"}}）使用其status字段
+func oauthErrorCode(responseData map[string]interface{}) string {
+	switch e := responseData["error"].(type) {
+	case string:
+		return e
+	case map[string]interface{}:
+		if status, ok := e["status"].(string); ok {
+			return status
+		}
+	}
+	return ""
+}
+
+// recordUpstreamError 记录上游错误响应的指标，响应中没有错误码时按HTTP状态码记录（如 http_502）
+func recordUpstreamError(upstream string, statusCode int, code string) {
+	if statusCode < http.StatusBadRequest {
+		return
+	}
+	if code == "" {
+		code = "http_" + strconv.Itoa(statusCode)
+	}
+	metrics.UpstreamErrors.WithLabelValues(upstream, code).Inc()
+}
@@ -5,23 +5,52 @@ import (
 	"encoding/json"
 	"fmt"
 	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/egress"
 	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/metrics"
+	"gmail-oauth-proxy-server/internal/oauthclient"
+	"gmail-oauth-proxy-server/internal/pkce"
+	"gmail-oauth-proxy-server/internal/serviceaccount"
+	"gmail-oauth-proxy-server/internal/store"
+	"gmail-oauth-proxy-server/internal/tracing"
+	"gmail-oauth-proxy-server/internal/vault"
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OAuth grant_type
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code" // RFC 8628
+	GrantTypeJWTBearer         = serviceaccount.GrantType                       // RFC 7523
 )
 
 // TokenRequest OAuth token请求结构
 type TokenRequest struct {
 	Code         string `json:"code,omitempty" form:"code"`
-	ClientID     string `json:"client_id" form:"client_id" binding:"required"`
-	ClientSecret string `json:"client_secret" form:"client_secret" binding:"required"`
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
 	RedirectURI  string `json:"redirect_uri,omitempty" form:"redirect_uri"`
 	GrantType    string `json:"grant_type" form:"grant_type" binding:"required"`
 	RefreshToken string `json:"refresh_token,omitempty" form:"refresh_token"`
+	DeviceCode   string `json:"device_code,omitempty" form:"device_code"`
+	CodeVerifier string `json:"code_verifier,omitempty" form:"code_verifier"`
+	State        string `json:"state,omitempty" form:"state"` // 仅用于查找代理生成的code_verifier，不转发给上游
+
+	// JWT Bearer授权：由代理使用配置的服务账号密钥签发断言
+	ServiceAccount string `json:"service_account,omitempty" form:"service_account"`
+	Scope          string `json:"scope,omitempty" form:"scope"`
+	Subject        string `json:"subject,omitempty" form:"subject"` // 域范围委派的目标用户
 }
 
 // AuthRequest OAuth授权请求结构
@@ -33,25 +62,205 @@ type AuthRequest struct {
 	ResponseType string `form:"response_type" binding:"required"`
 	AccessType   string `form:"access_type"`
 	Prompt       string `form:"prompt"`
+
+	CodeChallenge       string `form:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method"`
 }
 
 // OAuthHandler OAuth处理器
 type OAuthHandler struct {
-	config *config.Config
-	client *http.Client
+	config   *config.Config
+	upstream config.UpstreamConfig
+	clients  map[string]*http.Client  // 按上游端点区分的出站客户端
+	pool     *egress.Pool             // 出站线路池（未配置时为nil）
+	pkce     *pkce.VerifierStore      // 代理生成的code_verifier（未启用时为nil）
+	params   *authParamPolicy         // 授权请求额外参数透传策略
+	accounts *serviceaccount.Registry // 代理持有的服务账号密钥
+	registry *oauthclient.Registry    // 服务端登记的OAuth客户端
+	store    store.Store              // 代理状态存储
+	vault    *vault.Vault             // 刷新令牌保险库（未启用时为nil）
+	draining atomic.Bool              // 已开始优雅停机
 }
 
 // NewOAuthHandler 创建OAuth处理器
-func NewOAuthHandler(cfg *config.Config) *OAuthHandler {
-	return &OAuthHandler{
-		config: cfg,
-		client: &http.Client{
-			Timeout: time.Duration(cfg.Timeout) * time.Second,
-		},
+func NewOAuthHandler(cfg *config.Config) (*OAuthHandler, error) {
+	timeout := time.Duration(cfg.Timeout) * time.Second
+
+	clients := make(map[string]*http.Client, len(config.UpstreamNames))
+	for _, name := range config.UpstreamNames {
+		settings := egress.SettingsFor(cfg.EgressProxy, name)
+		client, err := egress.NewClient(settings, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create egress client for %s upstream: %w", name, err)
+		}
+		if !settings.IsDirect() {
+			logger.Info("Using egress proxy for %s upstream: %s", name, settings)
+		}
+		clients[name] = client
+	}
+
+	params, err := newAuthParamPolicy(cfg.AuthParams)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := serviceaccount.NewRegistry(cfg.ServiceAccounts)
+	if err != nil {
+		return nil, err
+	}
+	if names := accounts.Names(); len(names) > 0 {
+		logger.Info("Loaded %d service accounts: %s", len(names), strings.Join(names, ", "))
+	}
+
+	registry, err := oauthclient.NewRegistry(cfg.Clients, cfg.ClientPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if registry.Len() > 0 {
+		logger.Info("Loaded %d registered OAuth clients: %s", registry.Len(), strings.Join(registry.Names(), ", "))
+	}
+
+	keyring, err := cfg.Encryption.Keyring()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load master key: %w", err)
+	}
+	st, err := store.Open(cfg.Storage.Backend, cfg.Storage.Path, keyring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage: %w", err)
+	}
+	if path, ok := store.FilePath(st); ok {
+		logger.Info("Using file storage: %s (encryption at rest: %s)", path, keyring.Kind())
+	}
+
+	h := &OAuthHandler{
+		config:   cfg,
+		upstream: cfg.Upstream.WithDefaults(),
+		clients:  clients,
+		params:   params,
+		accounts: accounts,
+		registry: registry,
+		store:    st,
+	}
+
+	if cfg.PKCE.ProxyGenerate {
+		ttl := time.Duration(cfg.PKCE.VerifierTTL) * time.Second
+		if ttl <= 0 {
+			ttl = 10 * time.Minute
+		}
+		h.pkce = pkce.NewVerifierStore(ttl)
+		logger.Info("Proxy-generated PKCE enabled (verifier ttl: %s)", ttl)
+	}
+
+	if cfg.Vault.Enabled {
+		v, err := vault.New(cfg.Vault, st)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open vault: %w", err)
+		}
+		h.vault = v
+		logger.Info("Refresh token vault enabled (%d stored credentials)", len(v.Entries()))
 	}
+
+	if len(cfg.EgressPool.Routes) > 0 {
+		pool, err := egress.NewPool(cfg.EgressPool, h.upstream, timeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create egress pool: %w", err)
+		}
+		pool.Start()
+		h.pool = pool
+		logger.Info("Egress pool enabled with %d routes", len(cfg.EgressPool.Routes))
+	}
+
+	return h, nil
 }
 
-// AuthHandler 处理用户授权请求 - 代理 https://accounts.google.com/o/oauth2/v2/auth
+// doUpstream 发送上游请求并记录耗时指标，上游请求作为当前请求span的子span记录
+// 优先级：按端点覆盖的出站代理 > 出站线路池 > 全局出站代理/直连
+func (h *OAuthHandler) doUpstream(upstream string, req *http.Request) (*http.Response, error) {
+	ctx, span := tracing.Tracer().Start(req.Context(), "upstream "+upstream,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrUpstream.String(upstream),
+			tracing.AttrMethod.String(req.Method),
+			tracing.AttrServerHost.String(req.URL.Hostname()),
+			tracing.AttrURL.String(req.URL.Scheme+"://"+req.URL.Host+req.URL.Path),
+		),
+	)
+	defer span.End()
+	req = req.WithContext(ctx)
+
+	start := time.Now()
+	var resp *http.Response
+	var err error
+	if h.pool != nil && h.config.EgressProxy.Upstreams[upstream] == "" {
+		resp, err = h.pool.Do(upstream, req)
+	} else {
+		resp, err = h.clients[upstream].Do(req)
+	}
+	metrics.UpstreamDuration.WithLabelValues(upstream).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.UpstreamErrors.WithLabelValues(upstream, UpstreamErrorTransport).Inc()
+		// 错误信息中可能包含带令牌的请求地址，只记录错误类型
+		span.SetAttributes(tracing.AttrErrorType.String(UpstreamErrorTransport))
+		span.SetStatus(codes.Error, UpstreamErrorTransport)
+		return resp, err
+	}
+	span.SetAttributes(tracing.AttrStatusCode.Int(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, "")
+	}
+	return resp, err
+}
+
+// traceOAuthRequest 在当前请求的span上记录client_id和grant_type（不记录密钥、授权码和令牌）
+func traceOAuthRequest(c *gin.Context, clientID, grantType string) {
+	span := trace.SpanFromContext(c.Request.Context())
+	if clientID != "" {
+		span.SetAttributes(tracing.AttrClientID.String(clientID))
+	}
+	if grantType != "" {
+		span.SetAttributes(tracing.AttrGrantType.String(grantType))
+	}
+}
+
+// EgressStatus 返回出站线路池状态，未配置线路池时返回nil
+func (h *OAuthHandler) EgressStatus() []egress.RouteStatus {
+	if h.pool == nil {
+		return nil
+	}
+	return h.pool.Status()
+}
+
+// EgressHealthy 判断是否存在可用的出站线路
+func (h *OAuthHandler) EgressHealthy() bool {
+	return h.pool == nil || h.pool.Healthy()
+}
+
+// Store 返回代理状态存储
+func (h *OAuthHandler) Store() store.Store {
+	return h.store
+}
+
+// StartDraining 标记服务开始停机，/health 随即报告未就绪，进行中的请求不受影响
+func (h *OAuthHandler) StartDraining() {
+	h.draining.Store(true)
+}
+
+// Draining 判断服务是否已开始停机
+func (h *OAuthHandler) Draining() bool {
+	return h.draining.Load()
+}
+
+// Close 释放处理器持有的后台资源
+func (h *OAuthHandler) Close() {
+	if h.pool != nil {
+		h.pool.Close()
+	}
+	if err := h.store.Close(); err != nil {
+		logger.Error("Failed to close storage: %v", err)
+	}
+}
+
+// AuthHandler 处理用户授权请求 - 代理 upstream.auth_url（默认 https://accounts.google.com/o/oauth2/v2/auth）
 func (h *OAuthHandler) AuthHandler(c *gin.Context) {
 	var req AuthRequest
 
@@ -60,6 +269,7 @@ func (h *OAuthHandler) AuthHandler(c *gin.Context) {
 		HandleValidationError(c, err)
 		return
 	}
+	traceOAuthRequest(c, req.ClientID, "")
 
 	// 验证response_type
 	if req.ResponseType != "code" {
@@ -67,15 +277,48 @@ func (h *OAuthHandler) AuthHandler(c *gin.Context) {
 		return
 	}
 
+	// 验证PKCE参数（RFC 7636）
+	if req.CodeChallenge != "" || req.CodeChallengeMethod != "" {
+		if err := pkce.ValidateChallenge(req.CodeChallenge, req.CodeChallengeMethod); err != nil {
+			HandleValidationError(c, err)
+			return
+		}
+	}
+
+	// 按客户端策略校验：回调地址不合法时不能重定向，直接返回错误；权限范围不合法时通过回调地址返回invalid_scope
+	client, policy, err := h.registry.Lookup(req.ClientID)
+	if err != nil {
+		HandleClientError(c, err)
+		return
+	}
+	if err := policy.CheckRedirectURI(req.RedirectURI); err != nil {
+		HandleValidationError(c, err)
+		return
+	}
+	if err := policy.CheckScopes(strings.Fields(req.Scope)); err != nil {
+		RedirectAuthError(c, req.RedirectURI, req.State, "invalid_scope", err)
+		return
+	}
+	if client != nil {
+		req.ClientID = client.ID
+	}
+
+	// 校验需要透传的额外参数，未在允许列表中的参数直接拒绝
+	extraParams, err := h.params.extract(c.Request.URL.Query())
+	if err != nil {
+		HandleValidationError(c, err)
+		return
+	}
+
 	// 构建Google授权URL
-	googleURL := "https://accounts.google.com/o/oauth2/v2/auth"
+	googleURL := h.upstream.AuthURL
 	params := url.Values{}
 	params.Set("client_id", req.ClientID)
 	params.Set("redirect_uri", req.RedirectURI)
 	params.Set("scope", req.Scope)
 	params.Set("state", req.State)
 	params.Set("response_type", req.ResponseType)
-	
+
 	// 可选参数
 	if req.AccessType != "" {
 		params.Set("access_type", req.AccessType)
@@ -84,7 +327,37 @@ func (h *OAuthHandler) AuthHandler(c *gin.Context) {
 		params.Set("prompt", req.Prompt)
 	}
 
-	fullURL := googleURL + "?" + params.Encode()
+	extraNames := make([]string, 0, len(extraParams))
+	for name := range extraParams {
+		params.Set(name, extraParams.Get(name))
+		extraNames = append(extraNames, name)
+	}
+	sort.Strings(extraNames)
+
+	// PKCE：优先使用客户端提供的code_challenge，否则按配置由代理生成
+	pkceMode := "none"
+	if req.CodeChallenge != "" {
+		pkceMode = "client"
+		params.Set("code_challenge", req.CodeChallenge)
+		if req.CodeChallengeMethod != "" {
+			params.Set("code_challenge_method", req.CodeChallengeMethod)
+		}
+	} else if h.pkce != nil {
+		verifier, err := pkce.GenerateVerifier()
+		if err != nil {
+			HandleInternalError(c, err)
+			return
+		}
+		if err := h.pkce.Save(req.ClientID, req.State, verifier); err != nil {
+			HandleValidationError(c, err)
+			return
+		}
+		pkceMode = "proxy"
+		params.Set("code_challenge", pkce.ChallengeS256(verifier))
+		params.Set("code_challenge_method", pkce.MethodS256)
+	}
+
+	fullURL := appendQuery(googleURL, params)
 
 	// 记录请求日志（脱敏）
 	logData := map[string]interface{}{
@@ -96,6 +369,8 @@ func (h *OAuthHandler) AuthHandler(c *gin.Context) {
 		"response_type": req.ResponseType,
 		"access_type":   req.AccessType,
 		"prompt":        req.Prompt,
+		"pkce":          pkceMode,
+		"extra_params":  extraNames, // 仅记录参数名，login_hint等参数值可能包含个人信息
 	}
 	logger.Info("Redirecting to Google OAuth authorization: %+v", logData)
 
@@ -103,44 +378,91 @@ func (h *OAuthHandler) AuthHandler(c *gin.Context) {
 	c.Redirect(http.StatusFound, fullURL)
 }
 
-// TokenHandler 处理token请求 - 代理 https://oauth2.googleapis.com/token（支持授权码和刷新令牌）
+// TokenHandler 处理token请求 - 代理 upstream.token_url（默认 https://oauth2.googleapis.com/token，支持授权码、刷新令牌、设备码和服务账号JWT Bearer）
 func (h *OAuthHandler) TokenHandler(c *gin.Context) {
 	var req TokenRequest
 
 	// 检查Content-Type并相应地解析请求
-	contentType := c.GetHeader("Content-Type")
-	
-	var err error
-	if contentType == "application/x-www-form-urlencoded" || contentType == "application/x-www-form-urlencoded; charset=utf-8" {
-		// 解析form-urlencoded格式（Google OAuth标准格式）
-		err = c.ShouldBind(&req)
-	} else {
-		// 向后兼容：仍支持JSON格式
-		err = c.ShouldBindJSON(&req)
-	}
-	
-	if err != nil {
+	if err := bindFormOrJSON(c, &req); err != nil {
 		HandleValidationError(c, err)
 		return
 	}
+	traceOAuthRequest(c, req.ClientID, req.GrantType)
 
-	// 验证grant_type（支持authorization_code和refresh_token）
-	if req.GrantType != "authorization_code" && req.GrantType != "refresh_token" {
-		HandleValidationError(c, fmt.Errorf("invalid grant_type: %s", req.GrantType))
+	// 服务账号授权不需要OAuth客户端凭据，断言由代理签发
+	if req.GrantType == GrantTypeJWTBearer {
+		h.exchangeServiceAccount(c, req.ServiceAccount, req.Scope, req.Subject)
 		return
 	}
 
-	// 根据grant_type验证必需参数
-	if req.GrantType == "authorization_code" {
+	if req.ClientID == "" {
+		HandleValidationError(c, fmt.Errorf("client_id is required for %s grant", req.GrantType))
+		return
+	}
+
+	// 已登记的客户端：解析别名，调用方未提供client_secret时由代理注入
+	secretSource := "request"
+	client, policy, err := h.registry.Lookup(req.ClientID)
+	if err != nil {
+		HandleClientError(c, err)
+		return
+	}
+	registered := client != nil
+	if registered {
+		req.ClientID = client.ID
+		if req.ClientSecret == "" {
+			req.ClientSecret = client.Secret
+			secretSource = "registry"
+		}
+	} else if req.ClientSecret == "" {
+		HandleValidationError(c, fmt.Errorf("client_secret is required for unregistered client_id"))
+		return
+	}
+
+	// 根据grant_type验证必需参数（支持authorization_code、refresh_token和device_code）
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
 		if req.Code == "" || req.RedirectURI == "" {
 			HandleValidationError(c, fmt.Errorf("code and redirect_uri are required for authorization_code grant"))
 			return
 		}
-	} else if req.GrantType == "refresh_token" {
+		if err := policy.CheckRedirectURI(req.RedirectURI); err != nil {
+			HandleGrantError(c, err)
+			return
+		}
+	case GrantTypeRefreshToken:
 		if req.RefreshToken == "" {
 			HandleValidationError(c, fmt.Errorf("refresh_token is required for refresh_token grant"))
 			return
 		}
+	case GrantTypeDeviceCode:
+		if req.DeviceCode == "" {
+			HandleValidationError(c, fmt.Errorf("device_code is required for device_code grant"))
+			return
+		}
+	default:
+		HandleValidationError(c, fmt.Errorf("invalid grant_type: %s", req.GrantType))
+		return
+	}
+
+	// 验证PKCE code_verifier（RFC 7636）
+	if req.CodeVerifier != "" {
+		if req.GrantType != GrantTypeAuthorizationCode {
+			HandleValidationError(c, fmt.Errorf("code_verifier is only valid for authorization_code grant"))
+			return
+		}
+		if err := pkce.ValidateVerifier(req.CodeVerifier); err != nil {
+			HandleValidationError(c, err)
+			return
+		}
+	} else if req.GrantType == GrantTypeAuthorizationCode && h.pkce != nil && req.State != "" {
+		// 使用代理在授权阶段生成的code_verifier
+		verifier, ok := h.pkce.Take(req.ClientID, req.State)
+		if !ok {
+			HandleValidationError(c, fmt.Errorf("no proxy-generated code_verifier found for state (unknown or expired)"))
+			return
+		}
+		req.CodeVerifier = verifier
 	}
 
 	// 转换为form-urlencoded格式
@@ -150,19 +472,55 @@ func (h *OAuthHandler) TokenHandler(c *gin.Context) {
 	formData.Set("grant_type", req.GrantType)
 
 	// 根据grant_type设置不同参数
-	if req.GrantType == "authorization_code" {
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
 		formData.Set("code", req.Code)
 		formData.Set("redirect_uri", req.RedirectURI)
-	} else if req.GrantType == "refresh_token" {
+		if req.CodeVerifier != "" {
+			formData.Set("code_verifier", req.CodeVerifier)
+		}
+	case GrantTypeRefreshToken:
 		formData.Set("refresh_token", req.RefreshToken)
+	case GrantTypeDeviceCode:
+		formData.Set("device_code", req.DeviceCode)
+	}
+
+	// 记录请求日志（脱敏）
+	logData := map[string]interface{}{
+		"client_id":     req.ClientID,
+		"grant_type":    req.GrantType,
+		"secret_source": secretSource,
+	}
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		logData["redirect_uri"] = req.RedirectURI
+		logData["code"] = req.Code
+		logData["client_secret"] = req.ClientSecret
+		logData["pkce"] = req.CodeVerifier != ""
+	case GrantTypeRefreshToken:
+		logData["refresh_token"] = req.RefreshToken
+		logData["client_secret"] = req.ClientSecret
+	case GrantTypeDeviceCode:
+		logData["device_code"] = req.DeviceCode
+		logData["client_secret"] = req.ClientSecret
+	}
+
+	tokens := h.forwardToken(c, formData, logData, policy)
+	if tokens != nil && h.vault != nil && req.GrantType == GrantTypeAuthorizationCode {
+		h.storeRefreshToken(c.Request.Context(), vaultOwner(c), req.ClientID, req.ClientSecret, tokens)
 	}
+}
 
+// forwardToken 将form参数转发到上游令牌端点，并原样返回上游响应
+// policy非空时校验上游实际授予的权限范围，防止绕过 /auth 获取的授权码换取被禁止的令牌
+// 上游成功返回令牌时返回解析后的响应，其余情况返回nil
+func (h *OAuthHandler) forwardToken(c *gin.Context, formData url.Values, logData map[string]interface{}, policy *oauthclient.Policy) map[string]interface{} {
 	// 创建请求到Google OAuth API
-	googleURL := "https://oauth2.googleapis.com/token"
-	googleReq, err := http.NewRequest("POST", googleURL, bytes.NewBufferString(formData.Encode()))
+	googleURL := h.upstream.TokenURL
+	googleReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", googleURL, bytes.NewBufferString(formData.Encode()))
 	if err != nil {
 		HandleInternalError(c, err)
-		return
+		return nil
 	}
 
 	// 设置请求头
@@ -170,27 +528,15 @@ func (h *OAuthHandler) TokenHandler(c *gin.Context) {
 	googleReq.Header.Set("User-Agent", "Gmail-OAuth-Proxy-Server/1.0")
 
 	// 记录请求日志（脱敏）
-	logData := map[string]interface{}{
-		"url":         googleURL,
-		"client_id":   req.ClientID,
-		"grant_type":  req.GrantType,
-	}
-	if req.GrantType == "authorization_code" {
-		logData["redirect_uri"] = req.RedirectURI
-		logData["code"] = req.Code
-		logData["client_secret"] = req.ClientSecret
-	} else {
-		logData["refresh_token"] = req.RefreshToken
-		logData["client_secret"] = req.ClientSecret
-	}
+	logData["url"] = googleURL
 	sanitized := logger.SanitizeForLog(logData)
 	logger.Info("Forwarding request to Google OAuth API: %+v", sanitized)
 
 	// 发送请求
-	resp, err := h.client.Do(googleReq)
+	resp, err := h.doUpstream(config.UpstreamToken, googleReq)
 	if err != nil {
 		HandleProxyError(c, err)
-		return
+		return nil
 	}
 	defer resp.Body.Close()
 
@@ -198,7 +544,7 @@ func (h *OAuthHandler) TokenHandler(c *gin.Context) {
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		HandleProxyError(c, err)
-		return
+		return nil
 	}
 
 	// 解析响应用于日志记录（脱敏）
@@ -207,15 +553,31 @@ func (h *OAuthHandler) TokenHandler(c *gin.Context) {
 		sanitizedResp := logger.SanitizeForLog(responseData)
 		logger.Info("Received response from Google OAuth API: status=%d, data=%+v", resp.StatusCode, sanitizedResp)
 	}
+	recordUpstreamError(config.UpstreamToken, resp.StatusCode, oauthErrorCode(responseData))
+
+	if policy != nil && resp.StatusCode == http.StatusOK {
+		if granted, ok := responseData["scope"].(string); ok {
+			if err := policy.CheckScopes(strings.Fields(granted)); err != nil {
+				HandleScopeError(c, err)
+				return nil
+			}
+		}
+	}
 
-	// 设置响应头
+	// 设备码轮询中的authorization_pending(428)和slow_down(403)同样按原状态码和响应体返回，
+	// 客户端据此继续轮询或按RFC 8628第3.5节增加轮询间隔
 	c.Header("Content-Type", resp.Header.Get("Content-Type"))
 
 	// 返回Google的原始响应
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return responseData
 }
 
-// UserInfoHandler 处理用户信息请求 - 代理 https://www.googleapis.com/oauth2/v2/userinfo
+// UserInfoHandler 处理用户信息请求 - 代理 upstream.userinfo_url（默认 https://www.googleapis.com/oauth2/v2/userinfo）
 func (h *OAuthHandler) UserInfoHandler(c *gin.Context) {
 	// 获取Authorization头
 	authHeader := c.GetHeader("Authorization")
@@ -225,8 +587,8 @@ func (h *OAuthHandler) UserInfoHandler(c *gin.Context) {
 	}
 
 	// 创建请求到Google UserInfo API
-	googleURL := "https://www.googleapis.com/oauth2/v2/userinfo"
-	googleReq, err := http.NewRequest("GET", googleURL, nil)
+	googleURL := h.upstream.UserInfoURL
+	googleReq, err := http.NewRequestWithContext(c.Request.Context(), "GET", googleURL, nil)
 	if err != nil {
 		HandleInternalError(c, err)
 		return
@@ -241,7 +603,7 @@ func (h *OAuthHandler) UserInfoHandler(c *gin.Context) {
 	logger.Info("Forwarding request to Google UserInfo API: url=%s", googleURL)
 
 	// 发送请求
-	resp, err := h.client.Do(googleReq)
+	resp, err := h.doUpstream(config.UpstreamUserInfo, googleReq)
 	if err != nil {
 		HandleProxyError(c, err)
 		return
@@ -261,6 +623,7 @@ func (h *OAuthHandler) UserInfoHandler(c *gin.Context) {
 		sanitizedResp := logger.SanitizeForLog(responseData)
 		logger.Info("Received response from Google UserInfo API: status=%d, data=%+v", resp.StatusCode, sanitizedResp)
 	}
+	recordUpstreamError(config.UpstreamUserInfo, resp.StatusCode, oauthErrorCode(responseData))
 
 	// 设置响应头
 	c.Header("Content-Type", resp.Header.Get("Content-Type"))
@@ -269,7 +632,7 @@ func (h *OAuthHandler) UserInfoHandler(c *gin.Context) {
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
 }
 
-// TokenInfoHandler 处理令牌验证请求 - 代理 https://www.googleapis.com/oauth2/v1/tokeninfo
+// TokenInfoHandler 处理令牌验证请求 - 代理 upstream.tokeninfo_url（默认 https://www.googleapis.com/oauth2/v1/tokeninfo）
 func (h *OAuthHandler) TokenInfoHandler(c *gin.Context) {
 	// 获取access_token参数
 	accessToken := c.Query("access_token")
@@ -279,13 +642,13 @@ func (h *OAuthHandler) TokenInfoHandler(c *gin.Context) {
 	}
 
 	// 构建Google TokenInfo API URL
-	googleURL := "https://www.googleapis.com/oauth2/v1/tokeninfo"
+	googleURL := h.upstream.TokenInfoURL
 	params := url.Values{}
 	params.Set("access_token", accessToken)
-	fullURL := googleURL + "?" + params.Encode()
+	fullURL := appendQuery(googleURL, params)
 
 	// 创建请求到Google TokenInfo API
-	googleReq, err := http.NewRequest("GET", fullURL, nil)
+	googleReq, err := http.NewRequestWithContext(c.Request.Context(), "GET", fullURL, nil)
 	if err != nil {
 		HandleInternalError(c, err)
 		return
@@ -299,7 +662,7 @@ func (h *OAuthHandler) TokenInfoHandler(c *gin.Context) {
 	logger.Info("Forwarding request to Google TokenInfo API: url=%s", googleURL)
 
 	// 发送请求
-	resp, err := h.client.Do(googleReq)
+	resp, err := h.doUpstream(config.UpstreamTokenInfo, googleReq)
 	if err != nil {
 		HandleProxyError(c, err)
 		return
@@ -319,6 +682,7 @@ func (h *OAuthHandler) TokenInfoHandler(c *gin.Context) {
 		sanitizedResp := logger.SanitizeForLog(responseData)
 		logger.Info("Received response from Google TokenInfo API: status=%d, data=%+v", resp.StatusCode, sanitizedResp)
 	}
+	recordUpstreamError(config.UpstreamTokenInfo, resp.StatusCode, oauthErrorCode(responseData))
 
 	// 设置响应头
 	c.Header("Content-Type", resp.Header.Get("Content-Type"))
@@ -327,6 +691,24 @@ func (h *OAuthHandler) TokenInfoHandler(c *gin.Context) {
 	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
 }
 
+// bindFormOrJSON 按Content-Type解析请求体
+// form-urlencoded为Google OAuth标准格式，其余情况向后兼容按JSON解析
+func bindFormOrJSON(c *gin.Context, obj interface{}) error {
+	contentType := strings.ToLower(c.GetHeader("Content-Type"))
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return c.ShouldBind(obj)
+	}
+	return c.ShouldBindJSON(obj)
+}
+
+// appendQuery 将查询参数追加到上游URL（兼容已带查询参数的自定义端点）
+func appendQuery(baseURL string, params url.Values) string {
+	if strings.Contains(baseURL, "?") {
+		return baseURL + "&" + params.Encode()
+	}
+	return baseURL + "?" + params.Encode()
+}
+
 // helper function to get minimum of two integers
 func min(a, b int) int {
 	if a < b {
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RevokeRequest 令牌撤销请求结构（RFC 7009）
+type RevokeRequest struct {
+	Token         string `json:"token" form:"token" binding:"required"`
+	TokenTypeHint string `json:"token_type_hint,omitempty" form:"token_type_hint"`
+}
+
+// RevokeHandler 处理令牌撤销请求 - 代理 upstream.revoke_url（默认 https://oauth2.googleapis.com/revoke）
+func (h *OAuthHandler) RevokeHandler(c *gin.Context) {
+	var req RevokeRequest
+
+	// 与token端点一致，同时支持form-urlencoded和JSON格式
+	if err := bindFormOrJSON(c, &req); err != nil {
+		HandleValidationError(c, err)
+		return
+	}
+
+	formData := url.Values{}
+	formData.Set("token", req.Token)
+	if req.TokenTypeHint != "" {
+		formData.Set("token_type_hint", req.TokenTypeHint)
+	}
+
+	// 创建请求到Google Revoke API
+	googleURL := h.upstream.RevokeURL
+	googleReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", googleURL, bytes.NewBufferString(formData.Encode()))
+	if err != nil {
+		HandleInternalError(c, err)
+		return
+	}
+
+	// 设置请求头
+	googleReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	googleReq.Header.Set("User-Agent", "Gmail-OAuth-Proxy-Server/1.0")
+
+	// 记录请求日志（脱敏）
+	logData := map[string]interface{}{
+		"url":             googleURL,
+		"token":           req.Token,
+		"token_type_hint": req.TokenTypeHint,
+	}
+	sanitized := logger.SanitizeForLog(logData)
+	logger.Info("Forwarding request to Google Revoke API: %+v", sanitized)
+
+	// 发送请求
+	resp, err := h.doUpstream(config.UpstreamRevoke, googleReq)
+	if err != nil {
+		HandleProxyError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// 读取响应
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		HandleProxyError(c, err)
+		return
+	}
+
+	logger.Info("Received response from Google Revoke API: status=%d", resp.StatusCode)
+
+	if resp.StatusCode == http.StatusOK {
+		// 撤销成功，Google返回空响应体
+		c.Status(http.StatusOK)
+		return
+	}
+
+	// 将Google的错误响应映射为标准错误结构
+	errResp := revokeErrorResponse(resp.StatusCode, body)
+	recordUpstreamError(config.UpstreamRevoke, resp.StatusCode, errResp.Error)
+	c.JSON(resp.StatusCode, errResp)
+}
+
+// revokeErrorResponse 解析Google撤销端点的错误响应
+func revokeErrorResponse(statusCode int, body []byte) ErrorResponse {
+	var googleErr ErrorResponse
+	if err := json.Unmarshal(body, &googleErr); err != nil || googleErr.Error == "" {
+		googleErr = ErrorResponse{Error: "invalid_request", ErrorDescription: "Token revocation failed"}
+		if statusCode >= http.StatusInternalServerError {
+			googleErr = ErrorResponse{Error: "server_error", ErrorDescription: "OAuth provider failed to revoke token"}
+		}
+	}
+	if googleErr.ErrorURI == "" {
+		googleErr.ErrorURI = "https://tools.ietf.org/html/rfc7009#section-2.2.1"
+	}
+	return googleErr
+}
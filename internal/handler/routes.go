@@ -1,18 +1,25 @@
 package handler
 
 import (
+	"fmt"
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/audit"
 	"gmail-oauth-proxy-server/internal/config"
 	"gmail-oauth-proxy-server/internal/logger"
 	"gmail-oauth-proxy-server/internal/middleware"
+	"gmail-oauth-proxy-server/internal/store"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
-// RegisterRoutes 注册路由
-func RegisterRoutes(r *gin.Engine, cfg *config.Config) {
+// RegisterRoutes 注册路由，返回的OAuth处理器用于停机时报告未就绪并释放资源
+func RegisterRoutes(r *gin.Engine, cfg *config.Config) (*OAuthHandler, error) {
 	// 创建OAuth处理器
-	oauthHandler := NewOAuthHandler(cfg)
+	oauthHandler, err := NewOAuthHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
 
 	// 首页路由（不需要认证）- 重定向到GitHub Pages API文档
 	r.GET("/", func(c *gin.Context) {
@@ -20,12 +27,17 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config) {
 	})
 
 	// 健康检查端点（不需要认证）
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "ok",
-			"service": "gmail-oauth-proxy-server",
-		})
-	})
+	r.GET("/health", NewHealthHandler(oauthHandler).Health)
+
+	// 认证失败封禁列表，鉴权和管理端点共用
+	var bans *middleware.BanList
+	if cfg.BruteForce.Enabled {
+		if err := middleware.ValidateBruteForceConfig(cfg.BruteForce); err != nil {
+			return nil, fmt.Errorf("invalid brute force config: %w", err)
+		}
+		logger.Info("🚷 启用认证失败封禁")
+		bans = middleware.NewBanList(cfg.BruteForce, oauthHandler.store)
+	}
 
 	// API路由组
 	api := r.Group("/")
@@ -33,9 +45,30 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config) {
 		// 添加统一鉴权中间件（仅在未禁用认证时）
 		if !cfg.DisableAuth {
 			logger.Info("🔒 启用认证中间件")
+			if err := cfg.Auth.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid auth config: %w", err)
+			}
 			authConfig := middleware.AuthConfig{
 				APIKey:      cfg.APIKey,
 				IPWhitelist: cfg.IPWhitelist,
+				ClientCerts: cfg.TLS.ClientCerts,
+				Policy:      cfg.Auth,
+				Bans:        bans,
+			}
+			// 命名API Key保存在状态存储中，吊销和轮换后自动生效；状态存储中只保存哈希
+			// 自动生成的API Key同样从状态存储加载，轮换后旧密钥在宽限期内仍然有效
+			cache, err := config.NewConfigCacheWithStore(cfg, oauthHandler.store)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load API key cache: %w", err)
+			}
+			hasher, err := cache.Hasher()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load API key pepper: %w", err)
+			}
+			authConfig.Hasher = hasher
+			authConfig.Keys = middleware.NewCachedKeyProvider(cache, cfg.APIKeyCached)
+			if cfg.APIKeyCached {
+				authConfig.APIKey = ""
 			}
 			api.Use(middleware.UnifiedAuth(authConfig))
 		} else {
@@ -43,11 +76,71 @@ func RegisterRoutes(r *gin.Engine, cfg *config.Config) {
 		}
 		// 添加请求日志中间件
 		api.Use(middleware.RequestLogger())
+		// 添加限流中间件（在鉴权之后，按API Key和客户端IP计数）
+		if cfg.RateLimit.Enabled {
+			if err := middleware.ValidateRateLimitConfig(cfg.RateLimit); err != nil {
+				return nil, fmt.Errorf("invalid rate limit config: %w", err)
+			}
+			logger.Info("🚦 启用限流中间件")
+			api.Use(middleware.RateLimit(cfg.RateLimit, oauthHandler.store))
+		}
 
 		// OAuth API代理端点
-		api.GET("/auth", oauthHandler.AuthHandler)           // 用户授权端点代理
-		api.POST("/token", oauthHandler.TokenHandler)        // 令牌获取端点代理（支持刷新令牌）
-		api.GET("/userinfo", oauthHandler.UserInfoHandler)   // 用户信息获取端点代理
-		api.GET("/tokeninfo", oauthHandler.TokenInfoHandler) // 令牌验证端点代理
+		api.GET("/auth", oauthHandler.AuthHandler)                                  // 用户授权端点代理
+		api.POST("/token", oauthHandler.TokenHandler)                               // 令牌获取端点代理（支持刷新令牌）
+		api.GET("/userinfo", oauthHandler.UserInfoHandler)                          // 用户信息获取端点代理
+		api.GET("/tokeninfo", oauthHandler.TokenInfoHandler)                        // 令牌验证端点代理
+		api.POST("/revoke", oauthHandler.RevokeHandler)                             // 令牌撤销端点代理
+		api.POST("/device/code", oauthHandler.DeviceCodeHandler)                    // 设备授权端点代理（RFC 8628）
+		api.POST("/service-account/token", oauthHandler.ServiceAccountTokenHandler) // 服务账号令牌端点（代理签发JWT断言）
+
+		// 刷新令牌保险库：按账号签发访问令牌
+		if oauthHandler.VaultEnabled() {
+			api.GET("/v1/accounts/:email/access_token", oauthHandler.AccessTokenHandler)
+		}
+	}
+
+	// 管理端点，使用独立的管理API Key鉴权
+	if cfg.Admin.APIKey != "" {
+		hasher, err := adminHasher(cfg)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("🛠️  启用管理端点")
+		adminHandler := NewAdminHandler(bans, audit.New(oauthHandler.store))
+		admin := r.Group("/admin")
+		admin.Use(middleware.AdminAuth(cfg.Admin.APIKey, hasher, bans))
+		{
+			admin.GET("/bans", adminHandler.ListBans)        // 列出当前封禁
+			admin.DELETE("/bans", adminHandler.ClearBans)    // 解除所有封禁
+			admin.DELETE("/bans/:ip", adminHandler.ClearBan) // 解除单个IP的封禁
+		}
+	}
+
+	// Prometheus指标，配置了 metrics.listen 时在独立端口提供
+	if cfg.Metrics.Enabled && cfg.Metrics.Listen == "" {
+		logger.Info("📈 启用指标端点")
+		if err := registerMetrics(r, cfg, bans); err != nil {
+			return nil, fmt.Errorf("invalid metrics config: %w", err)
+		}
+	}
+
+	return oauthHandler, nil
+}
+
+// adminHasher 管理API Key为哈希时加载校验使用的Hasher
+func adminHasher(cfg *config.Config) (*apikey.Hasher, error) {
+	if !apikey.IsHash(cfg.Admin.APIKey) {
+		return nil, nil
+	}
+	// 只需要pepper，不读取状态存储中的API Key
+	cache, err := config.NewConfigCacheWithStore(cfg, store.NewMemory())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key pepper for admin key: %w", err)
+	}
+	hasher, err := cache.Hasher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key pepper for admin key: %w", err)
 	}
+	return hasher, nil
 }
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/serviceaccount"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServiceAccountTokenRequest 服务账号令牌请求结构
+type ServiceAccountTokenRequest struct {
+	Account string `json:"account" form:"account" binding:"required"`
+	Scope   string `json:"scope" form:"scope" binding:"required"`
+	Subject string `json:"subject,omitempty" form:"subject"` // 域范围委派的目标用户
+}
+
+// ServiceAccountTokenHandler 处理服务账号令牌请求 - 代理签发JWT断言并在 upstream.token_url 换取访问令牌
+// 等价于以 urn:ietf:params:oauth:grant-type:jwt-bearer 调用 /token，调用方无需接触私钥
+func (h *OAuthHandler) ServiceAccountTokenHandler(c *gin.Context) {
+	var req ServiceAccountTokenRequest
+
+	if err := bindFormOrJSON(c, &req); err != nil {
+		HandleValidationError(c, err)
+		return
+	}
+
+	h.exchangeServiceAccount(c, req.Account, req.Scope, req.Subject)
+}
+
+// exchangeServiceAccount 使用服务账号密钥签发断言并换取访问令牌
+func (h *OAuthHandler) exchangeServiceAccount(c *gin.Context, name, scope, subject string) {
+	if name == "" {
+		HandleValidationError(c, fmt.Errorf("service_account is required for %s grant", GrantTypeJWTBearer))
+		return
+	}
+	account, ok := h.accounts.Get(name)
+	if !ok {
+		HandleValidationError(c, fmt.Errorf("unknown service account: %s", name))
+		return
+	}
+
+	scopes := strings.Fields(scope)
+	if err := account.Authorize(scopes, subject); err != nil {
+		if errors.Is(err, serviceaccount.ErrSubjectNotAllowed) {
+			HandleAccessDeniedError(c, err)
+			return
+		}
+		HandleScopeError(c, err)
+		return
+	}
+
+	assertion, err := account.Key.SignAssertion(scopes, subject, time.Now())
+	if err != nil {
+		HandleInternalError(c, err)
+		return
+	}
+
+	formData := url.Values{}
+	formData.Set("grant_type", GrantTypeJWTBearer)
+	formData.Set("assertion", assertion)
+
+	// 记录请求日志（不记录断言内容）
+	logData := map[string]interface{}{
+		"grant_type":      GrantTypeJWTBearer,
+		"service_account": account.Name,
+		"client_email":    account.Key.ClientEmail,
+		"scope":           scope,
+		"subject":         subject,
+	}
+
+	h.forwardToken(c, formData, logData, nil)
+}
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/middleware"
+	"gmail-oauth-proxy-server/internal/vault"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessTokenResponse 保险库签发的访问令牌响应
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+	Email       string `json:"email"`
+	ClientID    string `json:"client_id"`
+}
+
+// VaultEnabled 判断是否启用了刷新令牌保险库
+func (h *OAuthHandler) VaultEnabled() bool {
+	return h.vault != nil
+}
+
+// vaultOwner 返回当前请求的客户端身份，保险库条目只对保存它的身份可见
+// 未启用鉴权或只通过IP白名单认证时返回空字符串，这些请求共享同一组条目
+func vaultOwner(c *gin.Context) string {
+	identity, ok := middleware.KeyIdentityFrom(c)
+	if !ok {
+		return ""
+	}
+	return identity.String()
+}
+
+// storeRefreshToken 授权码交换成功后将refresh_token加密保存到保险库，条目归属于owner
+// 保存失败只记录日志，不影响已返回给调用方的令牌响应
+func (h *OAuthHandler) storeRefreshToken(ctx context.Context, owner, clientID, clientSecret string, tokens map[string]interface{}) {
+	refreshToken, _ := tokens["refresh_token"].(string)
+	if refreshToken == "" {
+		logger.Debug("Token response has no refresh_token, skipping vault for client %s", clientID)
+		return
+	}
+	accessToken, _ := tokens["access_token"].(string)
+	scope, _ := tokens["scope"].(string)
+
+	// 账号邮箱由上游用户信息端点根据访问令牌返回，不采信未校验签名的id_token
+	email, err := h.lookupEmail(ctx, accessToken)
+	if err != nil {
+		logger.Warn("Failed to resolve Google account for vault, refresh_token not stored: %v", err)
+		return
+	}
+
+	if err := h.vault.Put(owner, email, clientID, scope, vault.Credential{RefreshToken: refreshToken, ClientSecret: clientSecret}); err != nil {
+		logger.Error("Failed to store refresh_token in vault: %v", err)
+		return
+	}
+	if expiresIn, ok := tokens["expires_in"].(float64); ok && accessToken != "" {
+		h.vault.CacheToken(owner, email, clientID, vault.AccessToken{
+			Token:     accessToken,
+			Scope:     scope,
+			ExpiresAt: time.Now().Add(time.Duration(expiresIn) * time.Second),
+		})
+	}
+	logger.Info("Stored refresh_token in vault: owner=%s, email=%s, client_id=%s", owner, email, clientID)
+}
+
+// lookupEmail 通过用户信息端点查询访问令牌对应的账号邮箱，邮箱未经Google验证时返回错误
+func (h *OAuthHandler) lookupEmail(ctx context.Context, accessToken string) (string, error) {
+	if accessToken == "" {
+		return "", fmt.Errorf("token response has no access_token")
+	}
+
+	googleReq, err := http.NewRequestWithContext(ctx, "GET", h.upstream.UserInfoURL, nil)
+	if err != nil {
+		return "", err
+	}
+	googleReq.Header.Set("Authorization", "Bearer "+accessToken)
+	googleReq.Header.Set("Accept", "application/json")
+	googleReq.Header.Set("User-Agent", "Gmail-OAuth-Proxy-Server/1.0")
+
+	resp, err := h.doUpstream(config.UpstreamUserInfo, googleReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		recordUpstreamError(config.UpstreamUserInfo, resp.StatusCode, "")
+		return "", fmt.Errorf("userinfo returned status %d (is the email scope granted?)", resp.StatusCode)
+	}
+	var info struct {
+		Email         string `json:"email"`
+		VerifiedEmail *bool  `json:"verified_email"` // oauth2/v2/userinfo
+		EmailVerified *bool  `json:"email_verified"` // OpenID Connect userinfo
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("invalid userinfo response: %w", err)
+	}
+	if info.Email == "" {
+		return "", fmt.Errorf("userinfo response has no email (is the email scope granted?)")
+	}
+	if (info.VerifiedEmail != nil && !*info.VerifiedEmail) || (info.EmailVerified != nil && !*info.EmailVerified) {
+		return "", fmt.Errorf("email %s is not verified by Google", info.Email)
+	}
+	return info.Email, nil
+}
+
+// AccessTokenHandler 返回保险库中账号的有效访问令牌，必要时使用保存的refresh_token透明刷新
+// 只能读取当前客户端身份保存的条目，其他身份保存的账号视为不存在
+// GET /v1/accounts/:email/access_token?client_id=...（账号只对应一个客户端时可省略client_id）
+func (h *OAuthHandler) AccessTokenHandler(c *gin.Context) {
+	owner := vaultOwner(c)
+	email := strings.ToLower(c.Param("email"))
+	if !strings.Contains(email, "@") {
+		HandleValidationError(c, fmt.Errorf("invalid account email: %s", email))
+		return
+	}
+
+	clientID := c.Query("client_id")
+	if clientID == "" {
+		clientIDs := h.vault.ClientsFor(owner, email)
+		switch len(clientIDs) {
+		case 0:
+			HandleNotFoundError(c, fmt.Errorf("no refresh token stored for %s", email))
+			return
+		case 1:
+			clientID = clientIDs[0]
+		default:
+			HandleValidationError(c, fmt.Errorf("client_id is required: %s has refresh tokens for %d clients", email, len(clientIDs)))
+			return
+		}
+	} else if client, ok := h.registry.Resolve(clientID); ok {
+		clientID = client.ID
+	}
+	traceOAuthRequest(c, clientID, "")
+
+	// 同一账号的并发请求只刷新一次
+	unlock := h.vault.Lock(owner, email, clientID)
+	defer unlock()
+
+	if token, ok := h.vault.CachedToken(owner, email, clientID); ok {
+		c.JSON(http.StatusOK, newAccessTokenResponse(email, clientID, token))
+		return
+	}
+
+	entry, cred, err := h.vault.Get(owner, email, clientID)
+	if errors.Is(err, vault.ErrNotFound) {
+		HandleNotFoundError(c, fmt.Errorf("no refresh token stored for %s and client %s", email, clientID))
+		return
+	}
+	if err != nil {
+		HandleInternalError(c, err)
+		return
+	}
+
+	// 已登记的客户端使用当前配置的密钥，兼容密钥轮换
+	clientSecret := cred.ClientSecret
+	if client, ok := h.registry.Resolve(clientID); ok {
+		clientSecret = client.Secret
+	}
+
+	formData := url.Values{}
+	formData.Set("client_id", clientID)
+	formData.Set("client_secret", clientSecret)
+	formData.Set("grant_type", GrantTypeRefreshToken)
+	formData.Set("refresh_token", cred.RefreshToken)
+
+	googleReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", h.upstream.TokenURL, bytes.NewBufferString(formData.Encode()))
+	if err != nil {
+		HandleInternalError(c, err)
+		return
+	}
+	googleReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	googleReq.Header.Set("User-Agent", "Gmail-OAuth-Proxy-Server/1.0")
+
+	logger.Info("Refreshing vault access token: email=%s, client_id=%s", email, clientID)
+
+	resp, err := h.doUpstream(config.UpstreamToken, googleReq)
+	if err != nil {
+		HandleProxyError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		HandleProxyError(c, err)
+		return
+	}
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+		RefreshToken string `json:"refresh_token"`
+		Error        string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		recordUpstreamError(config.UpstreamToken, resp.StatusCode, "")
+		HandleProxyError(c, fmt.Errorf("invalid token response from upstream (status %d): %w", resp.StatusCode, err))
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		recordUpstreamError(config.UpstreamToken, resp.StatusCode, tokens.Error)
+		// refresh_token已被撤销或过期，从保险库中移除，需要用户重新授权
+		if tokens.Error == "invalid_grant" {
+			logger.Warn("Vault refresh_token for %s (client %s) is no longer valid, removing it", email, clientID)
+			if err := h.vault.Delete(owner, email, clientID); err != nil {
+				logger.Error("Failed to remove invalid refresh_token from vault: %v", err)
+			}
+		}
+		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), body)
+		return
+	}
+
+	scope := tokens.Scope
+	if scope == "" {
+		scope = entry.Scope
+	}
+	token := vault.AccessToken{
+		Token:     tokens.AccessToken,
+		Scope:     scope,
+		ExpiresAt: time.Now().Add(time.Duration(tokens.ExpiresIn) * time.Second),
+	}
+
+	// 上游轮换了refresh_token时更新保险库
+	if tokens.RefreshToken != "" && tokens.RefreshToken != cred.RefreshToken {
+		cred.RefreshToken = tokens.RefreshToken
+		if err := h.vault.Put(owner, email, clientID, scope, cred); err != nil {
+			logger.Error("Failed to store rotated refresh_token in vault: %v", err)
+		}
+	}
+	h.vault.CacheToken(owner, email, clientID, token)
+
+	c.JSON(http.StatusOK, newAccessTokenResponse(email, clientID, token))
+}
+
+// newAccessTokenResponse 构建访问令牌响应
+func newAccessTokenResponse(email, clientID string, token vault.AccessToken) AccessTokenResponse {
+	return AccessTokenResponse{
+		AccessToken: token.Token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(time.Until(token.ExpiresAt).Seconds()),
+		Scope:       token.Scope,
+		Email:       email,
+		ClientID:    clientID,
+	}
+}
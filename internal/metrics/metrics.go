@@ -0,0 +1,48 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry 代理的指标注册表，包含进程和Go运行时的标准指标
+var Registry = prometheus.NewRegistry()
+
+// 代理暴露的指标
+var (
+	// HTTPRequests 按路由、方法、状态码和鉴权结果统计的请求数
+	HTTPRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "gmail_oauth_proxy_http_requests_total",
+		Help: "Total HTTP requests handled by the proxy.",
+	}, []string{"route", "method", "status", "auth"})
+	// UpstreamDuration 上游Google端点的请求耗时
+	UpstreamDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gmail_oauth_proxy_upstream_request_duration_seconds",
+		Help:    "Latency of requests to upstream Google OAuth endpoints.",
+		Buckets: DefaultBuckets,
+	}, []string{"endpoint"})
+	// UpstreamErrors 按上游端点和OAuth错误码统计的上游错误数
+	UpstreamErrors = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "gmail_oauth_proxy_upstream_errors_total",
+		Help: "Upstream errors by endpoint and OAuth error code.",
+	}, []string{"endpoint", "error"})
+)
+
+// DefaultBuckets 上游耗时直方图的默认分桶（秒）
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+	)
+}
+
+// Handler 返回以Prometheus文本格式输出所有指标的HTTP处理器
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/logger"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth 管理端点鉴权中间件，只接受 admin.api_key 配置的API Key（明文或哈希）
+// 提供错误密钥的请求同样计入认证失败次数
+func AdminAuth(adminKey string, hasher *apikey.Hasher, bans *BanList) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientIP := getClientIP(c)
+		if rejectBanned(c, bans, clientIP) {
+			return
+		}
+
+		requestAPIKey := c.GetHeader("X-API-Key")
+		if requestAPIKey == "" {
+			logger.Warn("Missing admin API key from %s", clientIP)
+			c.Set(ContextKeyAuthOutcome, AuthOutcomeFailure)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":             "unauthorized_client",
+				"error_description": "Missing X-API-Key header",
+			})
+			c.Abort()
+			return
+		}
+
+		if !hasher.Match(requestAPIKey, adminKey) {
+			logger.Warn("Invalid admin API key from %s", clientIP)
+			c.Set(ContextKeyAuthOutcome, AuthOutcomeFailure)
+			recordAuthFailure(bans, clientIP)
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":             "unauthorized_client",
+				"error_description": "Invalid admin API key",
+			})
+			c.Abort()
+			return
+		}
+
+		logger.Info("Admin request %s %s from %s", c.Request.Method, c.Request.URL.Path, clientIP)
+		c.Set(ContextKeyAuthOutcome, AuthOutcomeSuccess)
+		c.Next()
+	}
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKeyIdentity gin上下文中保存API Key身份的键
+const ContextKeyIdentity = "api_key_identity"
+
+// DefaultKeyName 通过 api_key 配置（或自动生成）的单个API Key的身份名称
+const DefaultKeyName = config.DefaultAPIKeyName
+
+// KeyIdentity 通过鉴权的API Key身份
+type KeyIdentity struct {
+	Name       string
+	Owner      string
+	Deprecated bool // 使用的是轮换前、仍在宽限期内的旧密钥
+	ClientCert bool // 通过客户端证书而不是API Key认证
+}
+
+// String 返回用于日志的身份描述
+func (i *KeyIdentity) String() string {
+	if i.ClientCert {
+		return "client_cert=" + i.Name
+	}
+	return "key=" + i.Name
+}
+
+// KeyIdentityFrom 从gin上下文中读取API Key身份
+func KeyIdentityFrom(c *gin.Context) (*KeyIdentity, bool) {
+	value, ok := c.Get(ContextKeyIdentity)
+	if !ok {
+		return nil, false
+	}
+	identity, ok := value.(*KeyIdentity)
+	return identity, ok
+}
+
+// KeyProvider 命名API Key来源
+type KeyProvider interface {
+	APIKeys() []config.APIKeyEntry
+}
+
+// StaticKeys 固定的命名API Key列表
+type StaticKeys []config.APIKeyEntry
+
+// APIKeys 返回命名API Key列表
+func (k StaticKeys) APIKeys() []config.APIKeyEntry {
+	return k
+}
+
+// CachedKeyProvider 从状态存储读取命名API Key，每秒重新加载一次，吊销和轮换无需重启服务器
+type CachedKeyProvider struct {
+	cache          *config.ConfigCache
+	includeDefault bool // 同时提供缓存中自动生成的默认API Key
+	interval       time.Duration
+
+	mu        sync.Mutex
+	keys      []config.APIKeyEntry
+	loaded    bool
+	checkedAt time.Time
+}
+
+// NewCachedKeyProvider 创建基于配置缓存的命名API Key来源，includeDefault为true时同时提供缓存中的默认API Key
+func NewCachedKeyProvider(cache *config.ConfigCache, includeDefault bool) *CachedKeyProvider {
+	p := &CachedKeyProvider{cache: cache, includeDefault: includeDefault, interval: time.Second}
+	p.APIKeys()
+	return p
+}
+
+// APIKeys 返回命名API Key列表，最多每秒从状态存储重新加载一次
+func (p *CachedKeyProvider) APIKeys() []config.APIKeyEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if !p.checkedAt.IsZero() && now.Sub(p.checkedAt) < p.interval {
+		return p.keys
+	}
+	p.checkedAt = now
+
+	keys, err := p.cache.AuthKeys(p.includeDefault)
+	if err != nil {
+		// 读取失败时继续使用上次加载的结果
+		logger.Error("Failed to reload API keys from %s: %v", p.cache.GetCacheFile(), err)
+		return p.keys
+	}
+	if p.loaded && !reflect.DeepEqual(keys, p.keys) {
+		logger.Info("Reloaded %d API keys from %s", len(keys), p.cache.GetCacheFile())
+	}
+	p.keys = keys
+	p.loaded = true
+	return p.keys
+}
+
+// keyCheck API Key校验结果
+type keyCheck struct {
+	identity  *KeyIdentity
+	errorCode string
+	errorMsg  string
+}
+
+// forbidden 判断凭据有效但不允许访问（来源地址或路径限制）
+func (k keyCheck) forbidden() bool {
+	return k.errorCode == "AUTH_API_KEY_FORBIDDEN" || k.errorCode == "AUTH_CLIENT_CERT_FORBIDDEN"
+}
+
+// checkAPIKey 校验请求中的API Key：先匹配 api_key 配置，再匹配命名API Key及其来源地址和路径限制
+// 密钥均以常量时间比较，命名API Key只保存哈希
+func checkAPIKey(c *gin.Context, authConfig AuthConfig, clientIP string) keyCheck {
+	requestAPIKey := c.GetHeader("X-API-Key")
+	if requestAPIKey == "" {
+		return keyCheck{errorCode: "AUTH_API_KEY_MISSING", errorMsg: "Missing X-API-Key header"}
+	}
+
+	if authConfig.Hasher.Match(requestAPIKey, authConfig.APIKey) {
+		return keyCheck{identity: &KeyIdentity{Name: DefaultKeyName}}
+	}
+
+	if authConfig.Keys != nil {
+		now := time.Now()
+		for _, entry := range authConfig.Keys.APIKeys() {
+			deprecated := false
+			if !authConfig.Hasher.Verify(requestAPIKey, entry.Hash) {
+				// 轮换前的旧密钥在宽限期内仍然有效
+				if !entry.InGracePeriod(now) || !authConfig.Hasher.Verify(requestAPIKey, entry.PreviousHash) {
+					continue
+				}
+				deprecated = true
+			}
+			switch {
+			case !entry.Enabled:
+				logger.Warn("Revoked API key %s used from %s", entry.Name, clientIP)
+				return keyCheck{errorCode: "AUTH_API_KEY_INVALID", errorMsg: "API key has been revoked"}
+			case entry.Expired(now):
+				logger.Warn("Expired API key %s used from %s", entry.Name, clientIP)
+				return keyCheck{errorCode: "AUTH_API_KEY_INVALID", errorMsg: "API key has expired"}
+			case !entry.AllowsIP(clientIP):
+				logger.Warn("API key %s is not allowed from %s", entry.Name, clientIP)
+				return keyCheck{errorCode: "AUTH_API_KEY_FORBIDDEN", errorMsg: "API key is not allowed from this address"}
+			case !entry.AllowsRoute(c.Request.URL.Path):
+				logger.Warn("API key %s is not allowed for %s", entry.Name, c.Request.URL.Path)
+				return keyCheck{errorCode: "AUTH_API_KEY_FORBIDDEN", errorMsg: "API key is not allowed for this route"}
+			}
+			if deprecated {
+				logger.Warn("Deprecated API key %s used from %s: key was rotated and retires at %s",
+					entry.Name, clientIP, entry.PreviousExpiresAt.Format(time.RFC3339))
+			}
+			return keyCheck{identity: &KeyIdentity{Name: entry.Name, Owner: entry.Owner, Deprecated: deprecated}}
+		}
+	}
+
+	logger.Warn("Invalid API key from %s", clientIP)
+	return keyCheck{errorCode: "AUTH_API_KEY_INVALID", errorMsg: "Invalid API key"}
+}
+
+// hasAPIKeys 判断是否配置了API Key（包括已吊销的命名API Key，吊销后仍需提供有效的API Key）
+func (a AuthConfig) hasAPIKeys() bool {
+	return a.APIKey != "" || (a.Keys != nil && len(a.Keys.APIKeys()) > 0)
+}
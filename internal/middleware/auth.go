@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/subtle"
 	"gmail-oauth-proxy-server/internal/logger"
 	"net/http"
 
@@ -14,7 +15,7 @@ func APIKeyAuth(apiKey string) gin.HandlerFunc {
 		requestAPIKey := c.GetHeader("X-API-Key")
 
 		if requestAPIKey == "" {
-			logger.Warn("Missing X-API-Key header from %s", c.ClientIP())
+			logger.Warn("Missing X-API-Key header from %s", getClientIP(c))
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Missing X-API-Key header",
 				"code":  "AUTH_ERROR",
@@ -23,8 +24,8 @@ func APIKeyAuth(apiKey string) gin.HandlerFunc {
 			return
 		}
 
-		if requestAPIKey != apiKey {
-			logger.Warn("Invalid API key from %s", c.ClientIP())
+		if subtle.ConstantTimeCompare([]byte(requestAPIKey), []byte(apiKey)) != 1 {
+			logger.Warn("Invalid API key from %s", getClientIP(c))
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid API key",
 				"code":  "AUTH_ERROR",
@@ -33,7 +34,7 @@ func APIKeyAuth(apiKey string) gin.HandlerFunc {
 			return
 		}
 
-		logger.Debug("API key validation successful for %s", c.ClientIP())
+		logger.Debug("API key validation successful for %s", getClientIP(c))
 		c.Next()
 	}
 }
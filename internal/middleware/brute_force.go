@@ -0,0 +1,286 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/audit"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/store"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ban 被封禁的客户端IP
+type Ban struct {
+	IP        string    `json:"ip"`
+	Failures  int       `json:"failures"` // 触发封禁时滑动窗口内的失败次数
+	BannedAt  time.Time `json:"banned_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// banRecord 状态存储中保存的单个IP的失败记录和封禁
+type banRecord struct {
+	Failures []time.Time `json:"failures,omitempty"`
+	Ban      *Ban        `json:"ban,omitempty"`
+}
+
+// BanList 按客户端IP统计滑动窗口内的认证失败次数，超过阈值后临时封禁
+// 失败记录和封禁写入状态存储的bans命名空间，服务器重启后仍然有效
+// nil BanList 不记录失败也不封禁任何地址
+type BanList struct {
+	maxFailures int
+	window      time.Duration
+	banDuration time.Duration
+	now         func() time.Time
+	store       store.Store
+	audit       *audit.Log
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+	bans     map[string]Ban
+	sweptAt  time.Time
+}
+
+// NewBanList 创建封禁列表，从状态存储加载重启前的失败记录和封禁
+func NewBanList(cfg config.BruteForceConfig, st store.Store) *BanList {
+	b := &BanList{
+		maxFailures: cfg.MaxFailures,
+		window:      time.Duration(cfg.Window) * time.Second,
+		banDuration: time.Duration(cfg.BanDuration) * time.Second,
+		now:         time.Now,
+		store:       st,
+		audit:       audit.New(st),
+		failures:    make(map[string][]time.Time),
+		bans:        make(map[string]Ban),
+	}
+	b.load()
+	return b
+}
+
+// ValidateBruteForceConfig 验证认证失败封禁配置
+func ValidateBruteForceConfig(cfg config.BruteForceConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	if cfg.MaxFailures <= 0 {
+		return fmt.Errorf("max_failures must be greater than 0")
+	}
+	if cfg.Window <= 0 {
+		return fmt.Errorf("window must be greater than 0")
+	}
+	if cfg.BanDuration <= 0 {
+		return fmt.Errorf("ban_duration must be greater than 0")
+	}
+	return nil
+}
+
+// Banned 返回IP当前的封禁记录
+func (b *BanList) Banned(ip string) (Ban, bool) {
+	if b == nil {
+		return Ban{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ban, ok := b.bans[ip]
+	if !ok || !b.now().Before(ban.ExpiresAt) {
+		return Ban{}, false
+	}
+	return ban, true
+}
+
+// RecordFailure 记录一次认证失败，达到阈值时封禁该IP并返回true
+func (b *BanList) RecordFailure(ip string) (Ban, bool) {
+	if b == nil {
+		return Ban{}, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweep(now)
+
+	recent := append(b.recentFailures(ip, now), now)
+	if len(recent) < b.maxFailures {
+		b.failures[ip] = recent
+		b.persist(ip)
+		return Ban{}, false
+	}
+
+	delete(b.failures, ip)
+	ban := Ban{IP: ip, Failures: len(recent), BannedAt: now, ExpiresAt: now.Add(b.banDuration)}
+	b.bans[ip] = ban
+	b.persist(ip)
+	b.audit.Record(audit.ActionBanCreate, audit.ActorServer, ip, fmt.Sprintf("%d failed authentication attempts", ban.Failures))
+	return ban, true
+}
+
+// List 返回所有生效中的封禁记录（按IP排序）
+func (b *BanList) List() []Ban {
+	bans := []Ban{}
+	if b == nil {
+		return bans
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(b.now())
+	for _, ban := range b.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+	return bans
+}
+
+// Clear 解除IP的封禁并清空失败记录，IP未被封禁时返回false
+func (b *BanList) Clear(ip string) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(b.now())
+	_, banned := b.bans[ip]
+	delete(b.failures, ip)
+	delete(b.bans, ip)
+	b.persist(ip)
+	return banned
+}
+
+// ClearAll 解除所有封禁并清空失败记录，返回解除的封禁数量
+func (b *BanList) ClearAll() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.sweep(b.now())
+	cleared := len(b.bans)
+	for ip := range b.failures {
+		delete(b.failures, ip)
+		b.persist(ip)
+	}
+	for ip := range b.bans {
+		delete(b.bans, ip)
+		b.persist(ip)
+	}
+	return cleared
+}
+
+// recentFailures 返回滑动窗口内的失败时间（调用方需持有b.mu）
+func (b *BanList) recentFailures(ip string, now time.Time) []time.Time {
+	var recent []time.Time
+	for _, failedAt := range b.failures[ip] {
+		if now.Sub(failedAt) < b.window {
+			recent = append(recent, failedAt)
+		}
+	}
+	return recent
+}
+
+// sweep 定期删除过期的封禁和失败记录（调用方需持有b.mu）
+func (b *BanList) sweep(now time.Time) {
+	if now.Sub(b.sweptAt) < sweepInterval {
+		return
+	}
+	b.sweptAt = now
+	for ip, ban := range b.bans {
+		if !now.Before(ban.ExpiresAt) {
+			delete(b.bans, ip)
+			b.persist(ip)
+		}
+	}
+	for ip, failures := range b.failures {
+		recent := b.recentFailures(ip, now)
+		if len(recent) == len(failures) {
+			continue
+		}
+		if len(recent) > 0 {
+			b.failures[ip] = recent
+		} else {
+			delete(b.failures, ip)
+		}
+		b.persist(ip)
+	}
+}
+
+// load 从状态存储加载失败记录和封禁，过期的记录在下次清理时删除
+func (b *BanList) load() {
+	values, err := b.store.List(store.BucketBans)
+	if err != nil {
+		logger.Error("Failed to load bans from storage: %v", err)
+		return
+	}
+	for ip, value := range values {
+		var record banRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			logger.Error("Failed to parse stored ban for %s: %v", ip, err)
+			continue
+		}
+		if len(record.Failures) > 0 {
+			b.failures[ip] = record.Failures
+		}
+		if record.Ban != nil {
+			b.bans[ip] = *record.Ban
+		}
+	}
+}
+
+// persist 将IP的失败记录和封禁写入状态存储，两者都为空时删除（调用方需持有b.mu）
+// 写入失败时只记录日志，内存中的记录继续生效
+func (b *BanList) persist(ip string) {
+	record := banRecord{Failures: b.failures[ip]}
+	if ban, ok := b.bans[ip]; ok {
+		record.Ban = &ban
+	}
+
+	var err error
+	if len(record.Failures) == 0 && record.Ban == nil {
+		if err = b.store.Delete(store.BucketBans, ip); errors.Is(err, store.ErrNotFound) {
+			err = nil
+		}
+	} else {
+		var value []byte
+		if value, err = json.Marshal(record); err == nil {
+			err = b.store.Put(store.BucketBans, ip, value)
+		}
+	}
+	if err != nil {
+		logger.Error("Failed to save ban state for %s: %v", ip, err)
+	}
+}
+
+// rejectBanned 拒绝已被封禁的客户端IP，返回true表示请求已被中止
+func rejectBanned(c *gin.Context, bans *BanList, clientIP string) bool {
+	ban, banned := bans.Banned(clientIP)
+	if !banned {
+		return false
+	}
+	retryAfter := ceilSeconds(ban.ExpiresAt.Sub(bans.now()))
+	logger.Debug("Rejected banned client %s", clientIP)
+	c.Set(ContextKeyAuthOutcome, AuthOutcomeBanned)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":             "access_denied",
+		"error_description": fmt.Sprintf("Too many failed authentication attempts, retry after %d seconds", retryAfter),
+	})
+	c.Abort()
+	return true
+}
+
+// recordAuthFailure 记录认证失败，达到阈值时记录封禁日志
+func recordAuthFailure(bans *BanList, clientIP string) {
+	if ban, banned := bans.RecordFailure(clientIP); banned {
+		logger.Warn("Banned %s until %s after %d failed authentication attempts",
+			clientIP, ban.ExpiresAt.Format(time.RFC3339), ban.Failures)
+	}
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBanList 创建使用可控时钟的封禁列表：60秒内3次失败封禁300秒
+func newTestBanList(now *time.Time) *BanList {
+	bans := NewBanList(config.BruteForceConfig{Enabled: true, MaxFailures: 3, Window: 60, BanDuration: 300}, store.NewMemory())
+	bans.now = func() time.Time { return *now }
+	return bans
+}
+
+func TestBanList(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bans := newTestBanList(&now)
+
+	// 滑动窗口外的失败不计数
+	_, banned := bans.RecordFailure("203.0.113.7")
+	assert.False(t, banned)
+	now = now.Add(61 * time.Second)
+	_, banned = bans.RecordFailure("203.0.113.7")
+	assert.False(t, banned)
+	_, banned = bans.RecordFailure("203.0.113.7")
+	assert.False(t, banned)
+	_, banned = bans.Banned("203.0.113.7")
+	assert.False(t, banned)
+
+	ban, banned := bans.RecordFailure("203.0.113.7")
+	require.True(t, banned)
+	assert.Equal(t, 3, ban.Failures)
+	assert.Equal(t, now.Add(300*time.Second), ban.ExpiresAt)
+
+	_, banned = bans.Banned("203.0.113.7")
+	assert.True(t, banned)
+	_, banned = bans.Banned("203.0.113.8")
+	assert.False(t, banned)
+	require.Len(t, bans.List(), 1)
+	assert.Equal(t, "203.0.113.7", bans.List()[0].IP)
+
+	// 封禁到期后自动解除
+	now = now.Add(300 * time.Second)
+	_, banned = bans.Banned("203.0.113.7")
+	assert.False(t, banned)
+	assert.Empty(t, bans.List())
+
+	// 手动解除封禁
+	for i := 0; i < 3; i++ {
+		bans.RecordFailure("198.51.100.1")
+		bans.RecordFailure("198.51.100.2")
+	}
+	assert.True(t, bans.Clear("198.51.100.1"))
+	assert.False(t, bans.Clear("198.51.100.1"))
+	assert.Equal(t, 1, bans.ClearAll())
+	assert.Empty(t, bans.List())
+
+	// nil BanList 不封禁任何地址
+	var disabled *BanList
+	_, banned = disabled.RecordFailure("203.0.113.7")
+	assert.False(t, banned)
+	assert.Empty(t, disabled.List())
+}
+
+func TestBanList_Persisted(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := config.BruteForceConfig{Enabled: true, MaxFailures: 2, Window: 60, BanDuration: 300}
+	st := store.NewMemory()
+	bans := NewBanList(cfg, st)
+	bans.now = func() time.Time { return now }
+	bans.RecordFailure("203.0.113.7")
+	bans.RecordFailure("203.0.113.7")
+	bans.RecordFailure("198.51.100.1")
+
+	// 重启后封禁和失败记录仍然有效
+	restarted := NewBanList(cfg, st)
+	restarted.now = func() time.Time { return now }
+	_, banned := restarted.Banned("203.0.113.7")
+	assert.True(t, banned)
+	_, banned = restarted.RecordFailure("198.51.100.1")
+	assert.True(t, banned)
+
+	// 解除后从状态存储中删除
+	assert.Equal(t, 2, restarted.ClearAll())
+	values, err := st.List(store.BucketBans)
+	require.NoError(t, err)
+	assert.Empty(t, values)
+}
+
+func TestValidateBruteForceConfig(t *testing.T) {
+	assert.NoError(t, ValidateBruteForceConfig(config.BruteForceConfig{}))
+	assert.NoError(t, ValidateBruteForceConfig(config.BruteForceConfig{Enabled: true, MaxFailures: 10, Window: 300, BanDuration: 900}))
+	assert.Error(t, ValidateBruteForceConfig(config.BruteForceConfig{Enabled: true, Window: 300, BanDuration: 900}))
+	assert.Error(t, ValidateBruteForceConfig(config.BruteForceConfig{Enabled: true, MaxFailures: 10, BanDuration: 900}))
+	assert.Error(t, ValidateBruteForceConfig(config.BruteForceConfig{Enabled: true, MaxFailures: 10, Window: 300}))
+}
+
+func TestUnifiedAuth_BruteForceBan(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bans := newTestBanList(&now)
+	router := newAuthRouter(AuthConfig{APIKey: "gop_secret", Bans: bans})
+
+	// 缺少API Key不计入失败次数
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, doAuthRequest(router, "POST", "/token", "", "203.0.113.7").Code)
+	}
+	assert.Empty(t, bans.List())
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, doAuthRequest(router, "POST", "/token", "wrong", "203.0.113.7").Code)
+	}
+
+	// 封禁期间即使提供正确的API Key也直接拒绝
+	w := doAuthRequest(router, "POST", "/token", "gop_secret", "203.0.113.7")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "300", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "Too many failed authentication attempts")
+
+	// 其他地址不受影响
+	assert.Equal(t, http.StatusOK, doAuthRequest(router, "POST", "/token", "gop_secret", "203.0.113.8").Code)
+
+	bans.Clear("203.0.113.7")
+	assert.Equal(t, http.StatusOK, doAuthRequest(router, "POST", "/token", "gop_secret", "203.0.113.7").Code)
+}
+
+func TestAdminAuth(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	bans := newTestBanList(&now)
+	hash, err := testHasher.Hash("gop_admin")
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(AdminAuth(hash, testHasher, bans))
+	router.GET("/admin/bans", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	doRequest := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/bans", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, doRequest("gop_admin").Code)
+	assert.Equal(t, http.StatusUnauthorized, doRequest("").Code)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, doRequest("gop_guess").Code)
+	}
+	assert.Equal(t, http.StatusForbidden, doRequest("gop_admin").Code)
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"gmail-oauth-proxy-server/internal/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// verifiedClientCert 返回通过CA校验的客户端证书，未使用TLS或未提供证书时返回nil
+// 只采信服务器在TLS握手中校验过的证书链，不读取反向代理转发的证书请求头
+func verifiedClientCert(c *gin.Context) *x509.Certificate {
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// checkClientCert 将客户端证书映射为客户端身份，并检查身份的来源地址和路径限制
+// 未提供证书或证书未映射到任何身份时返回false，由调用方继续校验API Key
+func checkClientCert(c *gin.Context, authConfig AuthConfig, clientIP string) (keyCheck, bool) {
+	cert := verifiedClientCert(c)
+	if cert == nil || len(authConfig.ClientCerts) == 0 {
+		return keyCheck{}, false
+	}
+
+	for _, entry := range authConfig.ClientCerts {
+		if !entry.Matches(cert) {
+			continue
+		}
+		switch {
+		case !entry.AllowsIP(clientIP):
+			logger.Warn("Client certificate %s is not allowed from %s", entry.Name, clientIP)
+			return keyCheck{errorCode: "AUTH_CLIENT_CERT_FORBIDDEN", errorMsg: "Client certificate is not allowed from this address"}, true
+		case !entry.AllowsRoute(c.Request.URL.Path):
+			logger.Warn("Client certificate %s is not allowed for %s", entry.Name, c.Request.URL.Path)
+			return keyCheck{errorCode: "AUTH_CLIENT_CERT_FORBIDDEN", errorMsg: "Client certificate is not allowed for this route"}, true
+		}
+		return keyCheck{identity: &KeyIdentity{Name: entry.Name, Owner: entry.Owner, ClientCert: true}}, true
+	}
+
+	logger.Debug("Client certificate %q from %s does not match any client identity", cert.Subject.String(), clientIP)
+	return keyCheck{}, false
+}
+
+// checkCredential 校验客户端凭据：优先使用映射到客户端身份的证书，否则校验API Key
+func checkCredential(c *gin.Context, authConfig AuthConfig, clientIP string) keyCheck {
+	if result, ok := checkClientCert(c, authConfig, clientIP); ok {
+		return result
+	}
+	if !authConfig.hasAPIKeys() {
+		return keyCheck{errorCode: "AUTH_CLIENT_CERT_MISSING", errorMsg: "Missing or unrecognized client certificate"}
+	}
+	return checkAPIKey(c, authConfig, clientIP)
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testClientCerts 测试使用的客户端证书身份
+var testClientCerts = []config.ClientCertConfig{
+	{Name: "mailer", Owner: "mail-team", SAN: "spiffe://cluster.local/ns/mail/sa/*"},
+	{Name: "vault", Subject: "vault-agent", Routes: []string{"/v1/accounts/*/access_token"}},
+	{Name: "office", Subject: "office", CIDRs: []string{"10.0.0.0/8"}},
+}
+
+// testCert 创建带CN和URI SAN的证书（只用于映射，不需要签名）
+func testCert(t *testing.T, commonName, uri string) *x509.Certificate {
+	t.Helper()
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		require.NoError(t, err)
+		cert.URIs = []*url.URL{u}
+	}
+	return cert
+}
+
+// doCertRequest 发送带客户端证书的测试请求，verified为false时模拟未经CA校验的证书
+func doCertRequest(router *gin.Engine, method, path, apiKey, remoteIP string, cert *x509.Certificate, verified bool) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteIP + ":12345"
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+		if verified {
+			req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+		}
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUnifiedAuth_ClientCert(t *testing.T) {
+	keys := hashKeys(t, StaticKeys{{Name: "ci", Hash: "gop_ci", Enabled: true}})
+	router := newAuthRouter(AuthConfig{Keys: keys, Hasher: testHasher, ClientCerts: testClientCerts})
+
+	mailer := testCert(t, "sender", "spiffe://cluster.local/ns/mail/sa/sender")
+	vault := testCert(t, "vault-agent", "")
+	office := testCert(t, "office", "")
+	unknown := testCert(t, "unknown", "spiffe://cluster.local/ns/other/sa/sender")
+
+	tests := []struct {
+		name     string
+		path     string
+		apiKey   string
+		remoteIP string
+		cert     *x509.Certificate
+		verified bool
+		status   int
+		body     string
+	}{
+		{"san match", "/token", "", "203.0.113.1", mailer, true, http.StatusOK, "mailer|mail-team"},
+		{"subject match", "/v1/accounts/a@example.com/access_token", "", "203.0.113.1", vault, true, http.StatusOK, "vault|"},
+		{"certificate preferred over key", "/token", "gop_ci", "203.0.113.1", mailer, true, http.StatusOK, "mailer|mail-team"},
+		{"route denied", "/token", "", "203.0.113.1", vault, true, http.StatusForbidden, ""},
+		{"route denied despite key", "/token", "gop_ci", "203.0.113.1", vault, true, http.StatusForbidden, ""},
+		{"cidr allowed", "/token", "", "10.1.2.3", office, true, http.StatusOK, "office|"},
+		{"cidr denied", "/token", "", "203.0.113.1", office, true, http.StatusForbidden, ""},
+		{"unmapped certificate falls back to key", "/token", "gop_ci", "203.0.113.1", unknown, true, http.StatusOK, "ci|"},
+		{"unmapped certificate without key", "/token", "", "203.0.113.1", unknown, true, http.StatusUnauthorized, ""},
+		{"unverified certificate ignored", "/token", "", "203.0.113.1", mailer, false, http.StatusUnauthorized, ""},
+		{"no certificate uses key", "/token", "gop_ci", "203.0.113.1", nil, false, http.StatusOK, "ci|"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodPost
+			if tt.path != "/token" {
+				method = http.MethodGet
+			}
+			w := doCertRequest(router, method, tt.path, tt.apiKey, tt.remoteIP, tt.cert, tt.verified)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnifiedAuth_ClientCertOnly(t *testing.T) {
+	router := newAuthRouter(AuthConfig{ClientCerts: testClientCerts})
+	mailer := testCert(t, "sender", "spiffe://cluster.local/ns/mail/sa/sender")
+
+	w := doCertRequest(router, "POST", "/token", "", "203.0.113.1", mailer, true)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 未配置API Key时，API Key请求头不能代替证书
+	w = doCertRequest(router, "POST", "/token", "gop_ci", "203.0.113.1", nil, false)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "client certificate")
+}
+
+func TestUnifiedAuth_ClientCertWithIPWhitelist(t *testing.T) {
+	router := newAuthRouter(AuthConfig{IPWhitelist: []string{"10.0.0.0/8"}, ClientCerts: testClientCerts})
+	mailer := testCert(t, "sender", "spiffe://cluster.local/ns/mail/sa/sender")
+
+	w := doCertRequest(router, "POST", "/token", "", "10.0.0.1", mailer, true)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doCertRequest(router, "POST", "/token", "", "203.0.113.1", mailer, true)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doCertRequest(router, "POST", "/token", "", "10.0.0.1", nil, false)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRateLimit_ClientCertIdentity(t *testing.T) {
+	limiter := NewRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		PerKey:  config.RateLimitRule{RequestsPerMinute: 60, Burst: 1},
+	}, store.NewMemory())
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(UnifiedAuth(AuthConfig{ClientCerts: testClientCerts}), limiter.Handler())
+	router.POST("/token", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	mailer := testCert(t, "sender", "spiffe://cluster.local/ns/mail/sa/sender")
+	assert.Equal(t, http.StatusOK, doCertRequest(router, "POST", "/token", "", "203.0.113.1", mailer, true).Code)
+	assert.Equal(t, http.StatusTooManyRequests, doCertRequest(router, "POST", "/token", "", "203.0.113.1", mailer, true).Code)
+
+	// 客户端证书身份与同名API Key分别计数
+	assert.Contains(t, limiter.buckets, "cert|*|mailer")
+	assert.NotContains(t, limiter.buckets, "key|*|mailer")
+}
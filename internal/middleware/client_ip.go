@@ -0,0 +1,180 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKeyClientIP 上下文中保存解析后的客户端IP的键
+const ContextKeyClientIP = "client_ip"
+
+// 受信任的代理用于传递客户端IP的转发头，只读取配置的一个
+const (
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderForwarded     = "Forwarded" // RFC 7239
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+// ParseForwardedHeader 解析 forwarded_header 配置（不区分大小写），未配置时使用 X-Forwarded-For
+func ParseForwardedHeader(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return HeaderXForwardedFor, nil
+	}
+	for _, header := range []string{HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP} {
+		if strings.EqualFold(name, header) {
+			return header, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported forwarded header %q (supported: %s, %s, %s)", name, HeaderXForwardedFor, HeaderForwarded, HeaderXRealIP)
+}
+
+// TrustedProxies 受信任的反向代理网段，只有来自这些地址的转发头才会被采信
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies 解析受信任的代理列表，支持CIDR格式和单个IP
+func ParseTrustedProxies(entries []string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+// Contains 判断IP是否属于受信任的代理
+func (t TrustedProxies) Contains(ip net.IP) bool {
+	for _, ipNet := range t {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 解析客户端真实IP并保存到上下文，鉴权、限流和日志统一使用该结果
+// header为受信任的代理设置的转发头（见 ParseForwardedHeader）
+func ClientIP(trusted TrustedProxies, header string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ContextKeyClientIP, trusted.Resolve(c.Request, header))
+		c.Next()
+	}
+}
+
+// TrustsPeer 判断请求的直连对端是否为受信任的代理，只有此时才能采信转发头
+func (t TrustedProxies) TrustsPeer(r *http.Request) bool {
+	peer := net.ParseIP(remoteHost(r))
+	return peer != nil && t.Contains(peer)
+}
+
+// Resolve 解析请求的客户端IP
+// 直连对端不是受信任的代理时忽略所有转发头；否则只读取header指定的一个转发头，
+// 其他转发头即使存在也会被忽略，防止客户端附加代理不会覆盖的请求头伪造地址。
+// X-Forwarded-For 和 Forwarded 从右向左跳过受信任的代理，第一个不受信任的地址即为客户端IP；
+// X-Real-IP 只有一个地址，由直连的代理设置
+func (t TrustedProxies) Resolve(r *http.Request, header string) string {
+	remote := remoteHost(r)
+	peer := net.ParseIP(remote)
+	if peer == nil || !t.Contains(peer) {
+		return remote
+	}
+
+	var hops []string
+	switch header {
+	case HeaderXRealIP:
+		if ip := net.ParseIP(forwardedNode(r.Header.Get(HeaderXRealIP))); ip != nil {
+			return ip.String()
+		}
+	case HeaderForwarded:
+		hops = forwardedFor(r.Header.Values(HeaderForwarded))
+	case HeaderXForwardedFor:
+		hops = xForwardedFor(r.Header.Values(HeaderXForwardedFor))
+	}
+
+	client := peer.String()
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			// 无法识别的地址（如 unknown 或混淆标识）不再向左追溯
+			break
+		}
+		client = ip.String()
+		if !t.Contains(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// remoteHost 返回直连对端的地址（不含端口）
+func remoteHost(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return remote
+}
+
+// forwardedFor 按从客户端到代理的顺序返回 Forwarded 头中各节点的for地址
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, element := range strings.Split(strings.Join(values, ","), ",") {
+		node := ""
+		for _, pair := range strings.Split(element, ";") {
+			key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if found && strings.EqualFold(key, "for") {
+				node = forwardedNode(value)
+			}
+		}
+		hops = append(hops, node)
+	}
+	return hops
+}
+
+// xForwardedFor 按从客户端到代理的顺序返回 X-Forwarded-For 头中的地址
+func xForwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range strings.Split(strings.Join(values, ","), ",") {
+		hops = append(hops, forwardedNode(value))
+	}
+	return hops
+}
+
+// forwardedNode 去除转发地址中的引号、方括号和端口，如 "[2001:db8::1]:4711" 返回 2001:db8::1
+func forwardedNode(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if strings.HasPrefix(value, "[") {
+		if end := strings.Index(value, "]"); end > 0 {
+			return value[1:end]
+		}
+		return value
+	}
+	if strings.Count(value, ":") == 1 {
+		host, _, _ := strings.Cut(value, ":")
+		return host
+	}
+	return value
+}
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedProxies_Resolve(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		header   string
+		remote   string
+		headers  map[string]string
+		expected string
+	}{
+		{"no headers", HeaderXForwardedFor, "203.0.113.7:1234", nil, "203.0.113.7"},
+		{"untrusted peer ignores XFF", HeaderXForwardedFor, "203.0.113.7:1234", map[string]string{"X-Forwarded-For": "10.1.1.1"}, "203.0.113.7"},
+		{"untrusted peer ignores Forwarded", HeaderForwarded, "203.0.113.7:1234", map[string]string{"Forwarded": "for=10.1.1.1"}, "203.0.113.7"},
+		{"untrusted peer ignores X-Real-IP", HeaderXRealIP, "203.0.113.7:1234", map[string]string{"X-Real-IP": "10.1.1.1"}, "203.0.113.7"},
+		{"trusted peer uses XFF", HeaderXForwardedFor, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"spoofed XFF entry skipped", HeaderXForwardedFor, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "127.0.0.1, 198.51.100.9, 10.2.2.2"}, "198.51.100.9"},
+		{"all hops trusted", HeaderXForwardedFor, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "192.168.1.5, 10.2.2.2"}, "192.168.1.5"},
+		{"unknown hop stops", HeaderXForwardedFor, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.9, unknown, 10.2.2.2"}, "10.2.2.2"},
+		{"Forwarded", HeaderForwarded, "10.0.0.1:1234", map[string]string{"Forwarded": `for=198.51.100.9;proto=https, for="10.2.2.2:8080"`}, "198.51.100.9"},
+		{"Forwarded IPv6", HeaderForwarded, "[2001:db8::1]:1234", map[string]string{"Forwarded": `For="[2001:db9::7]:4711"`}, "2001:db9::7"},
+		{"Forwarded obfuscated", HeaderForwarded, "10.0.0.1:1234", map[string]string{"Forwarded": "for=_hidden"}, "10.0.0.1"},
+		{"trusted peer uses X-Real-IP", HeaderXRealIP, "10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.9"}, "198.51.100.9"},
+		// 只读取配置的转发头，客户端附加的其他转发头不能覆盖代理设置的地址
+		{"XFF ignores spoofed Forwarded", HeaderXForwardedFor, "10.0.0.1:1234", map[string]string{"Forwarded": "for=192.168.1.10", "X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"XFF ignores spoofed X-Real-IP", HeaderXForwardedFor, "10.0.0.1:1234", map[string]string{"X-Real-IP": "192.168.1.10"}, "10.0.0.1"},
+		{"Forwarded ignores XFF", HeaderForwarded, "10.0.0.1:1234", map[string]string{"Forwarded": "for=198.51.100.9", "X-Forwarded-For": "192.168.1.10"}, "198.51.100.9"},
+		{"X-Real-IP ignores XFF", HeaderXRealIP, "10.0.0.1:1234", map[string]string{"X-Forwarded-For": "192.168.1.10"}, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			assert.Equal(t, tt.expected, proxies.Resolve(req, tt.header))
+		})
+	}
+
+	// 未配置受信任的代理时忽略所有转发头
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.9")
+	assert.Equal(t, "10.0.0.1", TrustedProxies(nil).Resolve(req, HeaderXForwardedFor))
+}
+
+func TestParseForwardedHeader(t *testing.T) {
+	header, err := ParseForwardedHeader("")
+	require.NoError(t, err)
+	assert.Equal(t, HeaderXForwardedFor, header)
+
+	header, err = ParseForwardedHeader("x-real-ip")
+	require.NoError(t, err)
+	assert.Equal(t, HeaderXRealIP, header)
+
+	header, err = ParseForwardedHeader("forwarded")
+	require.NoError(t, err)
+	assert.Equal(t, HeaderForwarded, header)
+
+	_, err = ParseForwardedHeader("True-Client-IP")
+	assert.Error(t, err)
+}
+
+func TestHTTPS_ForwardedProto(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(HTTPS(proxies))
+	router.GET("/userinfo", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	doRequest := func(remote, proto string, tls bool) int {
+		req := httptest.NewRequest(http.MethodGet, "https://proxy.example.com/userinfo", nil)
+		if !tls {
+			req.TLS = nil
+		}
+		req.RemoteAddr = remote + ":1234"
+		if proto != "" {
+			req.Header.Set("X-Forwarded-Proto", proto)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 受信任的代理终止TLS
+	assert.Equal(t, http.StatusOK, doRequest("10.0.0.1", "https", false))
+	assert.Equal(t, http.StatusBadRequest, doRequest("10.0.0.1", "http", false))
+	assert.Equal(t, http.StatusBadRequest, doRequest("10.0.0.1", "", false))
+
+	// 不受信任的对端无法通过伪造 X-Forwarded-Proto 绕过HTTPS要求
+	assert.Equal(t, http.StatusBadRequest, doRequest("203.0.113.7", "https", false))
+	assert.Equal(t, http.StatusOK, doRequest("203.0.113.7", "http", true))
+	assert.Equal(t, http.StatusOK, doRequest("203.0.113.7", "", true))
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{" 127.0.0.1 ", "", "::1"})
+	require.NoError(t, err)
+	assert.Len(t, proxies, 2)
+
+	_, err = ParseTrustedProxies([]string{"not-an-ip"})
+	assert.Error(t, err)
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
+
+func TestClientIP_IPWhitelist(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1"})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ClientIP(proxies, HeaderXForwardedFor))
+	router.Use(UnifiedAuth(AuthConfig{IPWhitelist: []string{"192.168.1.0/24"}}))
+	router.GET("/userinfo", func(c *gin.Context) {
+		c.String(http.StatusOK, getClientIP(c))
+	})
+
+	doRequest := func(remote, xff string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+		req.RemoteAddr = remote + ":1234"
+		req.Header.Set("X-Forwarded-For", xff)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 不受信任的对端无法通过伪造转发头绕过白名单
+	assert.Equal(t, http.StatusForbidden, doRequest("203.0.113.7", "192.168.1.10").Code)
+
+	w := doRequest("10.0.0.1", "192.168.1.10")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "192.168.1.10", w.Body.String())
+
+	assert.Equal(t, http.StatusForbidden, doRequest("10.0.0.1", "192.168.1.10, 203.0.113.7").Code)
+}
@@ -9,11 +9,15 @@ import (
 )
 
 // HTTPS 强制HTTPS中间件
-func HTTPS() gin.HandlerFunc {
+// 只有直连对端是受信任的代理时才采信 X-Forwarded-Proto，否则以连接本身是否使用TLS为准
+func HTTPS(trusted TrustedProxies) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 检查是否为HTTPS请求
-		if c.Request.Header.Get("X-Forwarded-Proto") == "http" ||
-			(c.Request.TLS == nil && c.Request.Header.Get("X-Forwarded-Proto") != "https") {
+		secure := c.Request.TLS != nil
+		if proto := c.Request.Header.Get("X-Forwarded-Proto"); proto != "" && trusted.TrustsPeer(c.Request) {
+			secure = strings.EqualFold(proto, "https")
+		}
+		if !secure {
 
 			// 在开发环境中可能不使用HTTPS，可以通过环境变量控制
 			host := c.Request.Host
@@ -23,7 +27,7 @@ func HTTPS() gin.HandlerFunc {
 				return
 			}
 
-			logger.Warn("HTTP request rejected from %s", c.ClientIP())
+			logger.Warn("HTTP request rejected from %s", getClientIP(c))
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": "HTTPS required",
 			})
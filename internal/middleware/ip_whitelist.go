@@ -35,28 +35,13 @@ func IPWhitelistAuth(whitelist []string) gin.HandlerFunc {
 	}
 }
 
-// getClientIP 获取客户端真实IP地址
+// getClientIP 获取客户端真实IP地址，优先使用 ClientIP 中间件解析的结果，
+// 未挂载该中间件时不信任任何转发头
 func getClientIP(c *gin.Context) string {
-	// 优先从X-Forwarded-For头获取
-	if xff := c.GetHeader("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For可能包含多个IP，取第一个
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			return strings.TrimSpace(ips[0])
-		}
-	}
-
-	// 从X-Real-IP头获取
-	if xri := c.GetHeader("X-Real-IP"); xri != "" {
-		return strings.TrimSpace(xri)
-	}
-
-	// 从RemoteAddr获取
-	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
-	if err != nil {
-		return c.Request.RemoteAddr
+	if ip := c.GetString(ContextKeyClientIP); ip != "" {
+		return ip
 	}
-	return ip
+	return remoteHost(c.Request)
 }
 
 // isIPAllowed 检查IP是否在白名单中
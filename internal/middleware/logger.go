@@ -22,6 +22,24 @@ func Logger() gin.HandlerFunc {
 			"client_ip":   param.ClientIP,
 			"user_agent":  param.Request.UserAgent(),
 		}
+		if clientIP, ok := param.Keys[ContextKeyClientIP].(string); ok {
+			logData["client_ip"] = clientIP
+		}
+		if traceID, ok := param.Keys[ContextKeyTraceID].(string); ok {
+			logData["trace_id"] = traceID
+		}
+		if identity, ok := param.Keys[ContextKeyIdentity].(*KeyIdentity); ok {
+			logData["key_name"] = identity.Name
+			if identity.Owner != "" {
+				logData["key_owner"] = identity.Owner
+			}
+			if identity.Deprecated {
+				logData["key_deprecated"] = true
+			}
+			if identity.ClientCert {
+				logData["client_cert"] = true
+			}
+		}
 
 		// 脱敏处理
 		sanitized := logger.SanitizeForLog(logData)
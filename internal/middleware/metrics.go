@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"gmail-oauth-proxy-server/internal/metrics"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKeyAuthOutcome 上下文中保存鉴权结果的键，用于请求指标
+const ContextKeyAuthOutcome = "auth_outcome"
+
+// 鉴权结果
+const (
+	AuthOutcomeSuccess = "success" // 鉴权通过
+	AuthOutcomeFailure = "failure" // 鉴权失败
+	AuthOutcomeBanned  = "banned"  // 客户端IP已被封禁
+	AuthOutcomeNone    = "none"    // 未经过鉴权（如健康检查或已禁用认证）
+)
+
+// Metrics 请求指标中间件，按路由模板、方法、状态码和鉴权结果计数
+// 路由使用模板（如 /v1/accounts/:email/access_token），避免账号等参数产生大量序列
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		outcome := c.GetString(ContextKeyAuthOutcome)
+		if outcome == "" {
+			outcome = AuthOutcomeNone
+		}
+		metrics.HTTPRequests.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status()), outcome).Inc()
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"gmail-oauth-proxy-server/internal/metrics"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_AuthOutcome(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Metrics())
+	router.Use(UnifiedAuth(AuthConfig{APIKey: "metrics-test-key"}))
+	router.GET("/metrics-test/:email", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	const route = "/metrics-test/:email"
+	success := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, http.MethodGet, "200", AuthOutcomeSuccess))
+	failure := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, http.MethodGet, "401", AuthOutcomeFailure))
+	unmatched := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("unmatched", http.MethodGet, "404", AuthOutcomeSuccess))
+
+	doRequest := func(path, key string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	doRequest("/metrics-test/alice@example.com", "metrics-test-key")
+	doRequest("/metrics-test/bob@example.com", "metrics-test-key")
+	doRequest("/metrics-test/alice@example.com", "wrong-key")
+	doRequest("/no-such-route", "metrics-test-key")
+
+	// 路由使用模板，不同账号计入同一序列
+	assert.Equal(t, success+2, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, http.MethodGet, "200", AuthOutcomeSuccess)))
+	assert.Equal(t, failure+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, http.MethodGet, "401", AuthOutcomeFailure)))
+	assert.Equal(t, unmatched+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("unmatched", http.MethodGet, "404", AuthOutcomeSuccess)))
+}
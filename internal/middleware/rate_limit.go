@@ -0,0 +1,296 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/store"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sweepInterval 清理空闲令牌桶的间隔
+const sweepInterval = time.Minute
+
+// rateLimitSnapshotKey 令牌桶快照在状态存储中的键
+const rateLimitSnapshotKey = "buckets"
+
+// RateLimiter 令牌桶限流器，按路由、API Key和客户端IP分别计数
+// 令牌桶在每次清理时写入状态存储的rate_limit命名空间，服务器重启后继续计数
+type RateLimiter struct {
+	config config.RateLimitConfig
+	now    func() time.Time
+	store  store.Store
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweptAt time.Time
+}
+
+// tokenBucket 单个计数对象的令牌桶
+type tokenBucket struct {
+	tokens   float64
+	capacity float64
+	rate     float64 // 每秒补充的令牌数
+	updated  time.Time
+}
+
+// bucketSnapshot 令牌桶在状态存储中的格式
+type bucketSnapshot struct {
+	Tokens   float64   `json:"tokens"`
+	Capacity float64   `json:"capacity"`
+	Rate     float64   `json:"rate"`
+	Updated  time.Time `json:"updated"`
+}
+
+// limitCheck 一次限流检查的对象和规则
+type limitCheck struct {
+	key  string
+	rule config.RateLimitRule
+}
+
+// limitResult 限流检查结果，用于生成 RateLimit-* 响应头
+type limitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration // 令牌桶恢复满额的时间
+	retryAfter time.Duration // 下一个令牌可用的时间
+}
+
+// NewRateLimiter 创建令牌桶限流器，从状态存储加载重启前的令牌桶
+func NewRateLimiter(cfg config.RateLimitConfig, st store.Store) *RateLimiter {
+	l := &RateLimiter{
+		config:  cfg,
+		now:     time.Now,
+		store:   st,
+		buckets: make(map[string]*tokenBucket),
+	}
+	l.load()
+	return l
+}
+
+// RateLimit 限流中间件，需要放在鉴权中间件之后以便按API Key计数
+func RateLimit(cfg config.RateLimitConfig, st store.Store) gin.HandlerFunc {
+	return NewRateLimiter(cfg, st).Handler()
+}
+
+// ValidateRateLimitConfig 验证限流配置
+func ValidateRateLimitConfig(cfg config.RateLimitConfig) error {
+	validateRule := func(name string, rule config.RateLimitRule) error {
+		if rule.RequestsPerMinute < 0 || rule.Burst < 0 {
+			return fmt.Errorf("%s: requests_per_minute and burst must not be negative", name)
+		}
+		return nil
+	}
+
+	if err := validateRule("per_key", cfg.PerKey); err != nil {
+		return err
+	}
+	if err := validateRule("per_ip", cfg.PerIP); err != nil {
+		return err
+	}
+	for _, route := range cfg.Routes {
+		if route.Path == "" || route.Path[0] != '/' {
+			return fmt.Errorf("invalid route %q: must be an absolute path", route.Path)
+		}
+		if _, err := path.Match(route.Path, "/"); err != nil {
+			return fmt.Errorf("invalid route pattern %q: %w", route.Path, err)
+		}
+		if err := validateRule(route.Path+" per_key", route.PerKey); err != nil {
+			return err
+		}
+		if err := validateRule(route.Path+" per_ip", route.PerIP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler 返回限流中间件
+func (l *RateLimiter) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checks := l.checksFor(c)
+		if len(checks) == 0 {
+			c.Next()
+			return
+		}
+
+		result := l.take(checks)
+		c.Header("RateLimit-Limit", strconv.Itoa(result.limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.reset)))
+
+		if !result.allowed {
+			retryAfter := ceilSeconds(result.retryAfter)
+			logger.Warn("Rate limit exceeded for %s on %s", getClientIP(c), c.Request.URL.Path)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":             "rate_limit_exceeded",
+				"error_description": fmt.Sprintf("Too many requests, retry after %d seconds", retryAfter),
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// checksFor 根据请求路由、API Key和客户端IP确定需要检查的令牌桶
+func (l *RateLimiter) checksFor(c *gin.Context) []limitCheck {
+	scope := "*"
+	perKey, perIP := l.config.PerKey, l.config.PerIP
+	for _, route := range l.config.Routes {
+		if matched, _ := path.Match(route.Path, c.Request.URL.Path); matched {
+			scope = route.Path
+			perKey, perIP = route.PerKey, route.PerIP
+			break
+		}
+	}
+
+	var checks []limitCheck
+	if identity, ok := KeyIdentityFrom(c); ok && perKey.RequestsPerMinute > 0 {
+		kind := "key|"
+		if identity.ClientCert {
+			kind = "cert|" // 客户端证书身份与同名API Key分别计数
+		}
+		checks = append(checks, limitCheck{key: kind + scope + "|" + identity.Name, rule: perKey})
+	}
+	if perIP.RequestsPerMinute > 0 {
+		checks = append(checks, limitCheck{key: "ip|" + scope + "|" + getClientIP(c), rule: perIP})
+	}
+	return checks
+}
+
+// take 在所有令牌桶都有余量时各消耗一个令牌，返回最严格的结果
+func (l *RateLimiter) take(checks []limitCheck) limitResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	buckets := make([]*tokenBucket, len(checks))
+	allowed := true
+	for i, check := range checks {
+		buckets[i] = l.bucket(check, now)
+		if buckets[i].tokens < 1 {
+			allowed = false
+		}
+	}
+
+	var result limitResult
+	for i, bucket := range buckets {
+		if allowed {
+			bucket.tokens--
+		}
+		current := limitResult{
+			allowed:    allowed,
+			limit:      int(bucket.capacity),
+			remaining:  int(math.Floor(bucket.tokens)),
+			reset:      bucket.until(bucket.capacity),
+			retryAfter: bucket.until(1),
+		}
+		// 放行时报告剩余最少的令牌桶，拒绝时报告等待最久的令牌桶
+		if i == 0 || (allowed && current.remaining < result.remaining) || (!allowed && current.retryAfter > result.retryAfter) {
+			result = current
+		}
+	}
+	return result
+}
+
+// bucket 返回补充令牌后的令牌桶，不存在时创建满额的令牌桶（调用方需持有l.mu）
+func (l *RateLimiter) bucket(check limitCheck, now time.Time) *tokenBucket {
+	capacity := check.rule.Burst
+	if capacity == 0 {
+		capacity = check.rule.RequestsPerMinute
+	}
+
+	bucket, ok := l.buckets[check.key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(capacity), updated: now}
+		l.buckets[check.key] = bucket
+	}
+	bucket.capacity = float64(capacity)
+	bucket.rate = float64(check.rule.RequestsPerMinute) / 60
+	bucket.tokens = math.Min(bucket.capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*bucket.rate)
+	bucket.updated = now
+	return bucket
+}
+
+// sweep 定期删除已恢复满额的空闲令牌桶（调用方需持有l.mu）
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < sweepInterval {
+		return
+	}
+	l.sweptAt = now
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*bucket.rate >= bucket.capacity {
+			delete(l.buckets, key)
+		}
+	}
+	l.save()
+}
+
+// load 从状态存储加载令牌桶快照
+func (l *RateLimiter) load() {
+	value, err := l.store.Get(store.BucketRateLimit, rateLimitSnapshotKey)
+	if errors.Is(err, store.ErrNotFound) {
+		return
+	}
+	var snapshot map[string]bucketSnapshot
+	if err == nil {
+		err = json.Unmarshal(value, &snapshot)
+	}
+	if err != nil {
+		logger.Error("Failed to load rate limit buckets from storage: %v", err)
+		return
+	}
+	for key, s := range snapshot {
+		l.buckets[key] = &tokenBucket{tokens: s.Tokens, capacity: s.Capacity, rate: s.Rate, updated: s.Updated}
+	}
+}
+
+// save 将令牌桶快照写入状态存储，没有令牌桶时删除快照（调用方需持有l.mu）
+// 写入失败时只记录日志，内存中的令牌桶继续生效
+func (l *RateLimiter) save() {
+	var err error
+	if len(l.buckets) == 0 {
+		if err = l.store.Delete(store.BucketRateLimit, rateLimitSnapshotKey); errors.Is(err, store.ErrNotFound) {
+			err = nil
+		}
+	} else {
+		snapshot := make(map[string]bucketSnapshot, len(l.buckets))
+		for key, bucket := range l.buckets {
+			snapshot[key] = bucketSnapshot{Tokens: bucket.tokens, Capacity: bucket.capacity, Rate: bucket.rate, Updated: bucket.updated}
+		}
+		var value []byte
+		if value, err = json.Marshal(snapshot); err == nil {
+			err = l.store.Put(store.BucketRateLimit, rateLimitSnapshotKey, value)
+		}
+	}
+	if err != nil {
+		logger.Error("Failed to save rate limit buckets: %v", err)
+	}
+}
+
+// until 令牌数恢复到target所需的时间
+func (b *tokenBucket) until(target float64) time.Duration {
+	if b.tokens >= target || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration((target - b.tokens) / b.rate * float64(time.Second))
+}
+
+// ceilSeconds 向上取整到秒
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRateLimitRouter 创建挂载限流中间件的测试路由，通过 X-Test-Key 模拟已鉴权的API Key
+func newRateLimitRouter(limiter *RateLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if name := c.GetHeader("X-Test-Key"); name != "" {
+			c.Set(ContextKeyIdentity, &KeyIdentity{Name: name})
+		}
+	})
+	router.Use(limiter.Handler())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/token", ok)
+	router.GET("/userinfo", ok)
+	return router
+}
+
+// doRateLimitRequest 发送限流测试请求
+func doRateLimitRequest(router *gin.Engine, path, keyName, remoteIP string) *httptest.ResponseRecorder {
+	method := http.MethodGet
+	if path == "/token" {
+		method = http.MethodPost
+	}
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteIP + ":12345"
+	if keyName != "" {
+		req.Header.Set("X-Test-Key", keyName)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_PerIP(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		PerIP:   config.RateLimitRule{RequestsPerMinute: 60, Burst: 2},
+	}, store.NewMemory())
+	limiter.now = func() time.Time { return now }
+	router := newRateLimitRouter(limiter)
+
+	w := doRateLimitRequest(router, "/token", "", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Reset"))
+
+	w = doRateLimitRequest(router, "/token", "", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = doRateLimitRequest(router, "/token", "", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "rate_limit_exceeded")
+
+	// 其他IP不受影响
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "", "10.0.0.2").Code)
+
+	// 令牌按速率补充
+	now = now.Add(time.Second)
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRateLimitRequest(router, "/token", "", "10.0.0.1").Code)
+}
+
+func TestRateLimit_Persisted(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cfg := config.RateLimitConfig{
+		Enabled: true,
+		PerIP:   config.RateLimitRule{RequestsPerMinute: 1, Burst: 2},
+	}
+	st := store.NewMemory()
+	limiter := NewRateLimiter(cfg, st)
+	limiter.now = func() time.Time { return now }
+	router := newRateLimitRouter(limiter)
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "", "10.0.0.1").Code)
+
+	// 清理时写入快照
+	now = now.Add(sweepInterval + time.Second)
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "", "10.0.0.1").Code)
+
+	// 重启后从快照继续计数，不会恢复满额
+	restarted := NewRateLimiter(cfg, st)
+	restarted.now = func() time.Time { return now }
+	router = newRateLimitRouter(restarted)
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRateLimitRequest(router, "/token", "", "10.0.0.1").Code)
+}
+
+func TestRateLimit_PerKeyAndRoute(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		PerKey:  config.RateLimitRule{RequestsPerMinute: 2},
+		Routes: []config.RouteRateLimit{
+			{Path: "/userinfo", PerKey: config.RateLimitRule{RequestsPerMinute: 1}},
+		},
+	}, store.NewMemory())
+	limiter.now = func() time.Time { return now }
+	router := newRateLimitRouter(limiter)
+
+	// 同一API Key从不同IP请求共享配额
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "ci", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "ci", "10.0.0.2").Code)
+	w := doRateLimitRequest(router, "/token", "ci", "10.0.0.3")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// 其他API Key和未鉴权请求不受影响
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "other", "10.0.0.1").Code)
+	w = doRateLimitRequest(router, "/token", "", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+
+	// 路由使用独立的配额
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/userinfo", "ci", "10.0.0.1").Code)
+	w = doRateLimitRequest(router, "/userinfo", "ci", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
+
+func TestRateLimit_MostRestrictive(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	limiter := NewRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		PerKey:  config.RateLimitRule{RequestsPerMinute: 10},
+		PerIP:   config.RateLimitRule{RequestsPerMinute: 60, Burst: 1},
+	}, store.NewMemory())
+	limiter.now = func() time.Time { return now }
+	router := newRateLimitRouter(limiter)
+
+	w := doRateLimitRequest(router, "/token", "ci", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	// IP限制拒绝时不消耗API Key的配额
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusTooManyRequests, doRateLimitRequest(router, "/token", "ci", "10.0.0.1").Code)
+	}
+	assert.Equal(t, 9.0, limiter.buckets["key|*|ci"].tokens)
+
+	assert.Equal(t, http.StatusOK, doRateLimitRequest(router, "/token", "ci", "10.0.0.2").Code)
+	assert.Equal(t, 8.0, limiter.buckets["key|*|ci"].tokens)
+}
+
+func TestValidateRateLimitConfig(t *testing.T) {
+	assert.NoError(t, ValidateRateLimitConfig(config.RateLimitConfig{
+		PerKey: config.RateLimitRule{RequestsPerMinute: 60},
+		Routes: []config.RouteRateLimit{{Path: "/v1/accounts/*/access_token"}},
+	}))
+	assert.Error(t, ValidateRateLimitConfig(config.RateLimitConfig{PerIP: config.RateLimitRule{RequestsPerMinute: -1}}))
+	assert.Error(t, ValidateRateLimitConfig(config.RateLimitConfig{Routes: []config.RouteRateLimit{{Path: "token"}}}))
+	assert.Error(t, ValidateRateLimitConfig(config.RateLimitConfig{Routes: []config.RouteRateLimit{{Path: "/[", PerKey: config.RateLimitRule{RequestsPerMinute: 1}}}}))
+}
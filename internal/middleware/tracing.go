@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"gmail-oauth-proxy-server/internal/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContextKeyTraceID 上下文中保存当前请求trace ID的键，用于日志关联
+const ContextKeyTraceID = "trace_id"
+
+// Tracing 为每个请求创建服务端span，调用方传入W3C traceparent时作为其子span
+// 需要在 ClientIP 之后注册；span名称使用路由模板，不记录查询参数和请求体
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		name := c.Request.Method
+		if route != "" {
+			name += " " + route
+		}
+		ctx, span := tracing.Tracer().Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				tracing.AttrMethod.String(c.Request.Method),
+				tracing.AttrRoute.String(route),
+				tracing.AttrClientIP.String(getClientIP(c)),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			c.Set(ContextKeyTraceID, sc.TraceID().String())
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(tracing.AttrStatusCode.Int(status))
+		if outcome := c.GetString(ContextKeyAuthOutcome); outcome != "" {
+			span.SetAttributes(tracing.AttrAuthOutcome.String(outcome))
+		}
+		if identity, ok := c.Get(ContextKeyIdentity); ok {
+			if identity, ok := identity.(*KeyIdentity); ok {
+				span.SetAttributes(tracing.AttrKeyName.String(identity.Name))
+			}
+		}
+		if status >= 500 {
+			span.SetStatus(codes.Error, "")
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/tracing"
+	"gmail-oauth-proxy-server/internal/tracing/tracingtest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracing_Traceparent(t *testing.T) {
+	collector := tracingtest.NewCollector(t)
+	shutdown, err := tracing.Setup(config.TracingConfig{Enabled: true, Endpoint: collector.Endpoint(), SampleRatio: 1}, "test")
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(ClientIP(nil, HeaderXForwardedFor))
+	router.Use(Tracing())
+	router.Use(UnifiedAuth(AuthConfig{APIKey: "tracing-test-key"}))
+	router.GET("/v1/accounts/:email/access_token", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(ContextKeyTraceID))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/accounts/alice@example.com/access_token?client_id=abc", nil)
+	req.RemoteAddr = "203.0.113.7:1234"
+	req.Header.Set("X-API-Key", "tracing-test-key")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Body.String())
+
+	// 没有traceparent时创建新的链路
+	req = httptest.NewRequest(http.MethodGet, "/v1/accounts/bob@example.com/access_token", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.NoError(t, shutdown(context.Background()))
+	spans := collector.Spans()
+	require.Len(t, spans, 2)
+
+	span := spans[0]
+	assert.Equal(t, "GET /v1/accounts/:email/access_token", span.Name)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", span.ParentSpanID)
+	assert.Equal(t, "/v1/accounts/:email/access_token", span.Attributes["http.route"])
+	assert.Equal(t, "200", span.Attributes["http.response.status_code"])
+	assert.Equal(t, "203.0.113.7", span.Attributes["client.address"])
+	assert.Equal(t, AuthOutcomeSuccess, span.Attributes["oauth_proxy.auth"])
+	for _, value := range span.Attributes {
+		assert.NotContains(t, value, "tracing-test-key")
+		assert.NotContains(t, value, "alice@example.com")
+	}
+
+	assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[1].TraceID)
+	assert.Empty(t, spans[1].ParentSpanID)
+	assert.Equal(t, "401", spans[1].Attributes["http.response.status_code"])
+	assert.Equal(t, AuthOutcomeFailure, spans[1].Attributes["oauth_proxy.auth"])
+}
@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/config"
 	"gmail-oauth-proxy-server/internal/logger"
 	"net/http"
 
@@ -9,22 +11,39 @@ import (
 
 // AuthConfig 鉴权配置
 type AuthConfig struct {
-	APIKey      string
+	APIKey      string // 明文API Key或其哈希
 	IPWhitelist []string
+	Keys        KeyProvider    // 命名API Key（可选）
+	Hasher      *apikey.Hasher // 校验API Key哈希（APIKey为哈希或使用命名API Key时必需）
+
+	// ClientCerts 客户端证书身份（可选），证书由服务器在TLS握手中校验，可以代替API Key
+	ClientCerts []config.ClientCertConfig
+
+	// Policy 同时配置API Key和IP白名单时的组合方式（all/any），可按路由覆盖
+	Policy config.AuthPolicyConfig
+
+	// Bans 多次提供错误API Key的客户端IP封禁列表（可选）
+	Bans *BanList
 }
 
 // UnifiedAuth 统一鉴权中间件
-// 支持API Key和IP白名单双重验证
+// 支持API Key（或客户端证书）和IP白名单双重验证，组合方式由 Policy 决定
 func UnifiedAuth(config AuthConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		clientIP := getClientIP(c)
 
+		// 已被封禁的地址直接拒绝，不再校验API Key
+		if rejectBanned(c, config.Bans, clientIP) {
+			return
+		}
+
 		// 检查是否配置了任何鉴权方式
-		hasAPIKey := config.APIKey != ""
+		hasAPIKey := config.hasAPIKeys() || len(config.ClientCerts) > 0
 		hasIPWhitelist := len(config.IPWhitelist) > 0
 
 		if !hasAPIKey && !hasIPWhitelist {
 			logger.Warn("No authentication method configured")
+			c.Set(ContextKeyAuthOutcome, AuthOutcomeFailure)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":             "server_error",
 				"error_description": "Authentication not configured",
@@ -37,17 +56,17 @@ func UnifiedAuth(config AuthConfig) gin.HandlerFunc {
 		// 验证结果
 		apiKeyValid := false
 		ipWhitelistValid := false
+		var keyResult keyCheck
 
-		// API Key验证
+		// API Key或客户端证书验证
 		if hasAPIKey {
-			requestAPIKey := c.GetHeader("X-API-Key")
-			if requestAPIKey == "" {
-				logger.Debug("Missing X-API-Key header from %s", clientIP)
-			} else if requestAPIKey != config.APIKey {
-				logger.Warn("Invalid API key from %s", clientIP)
-			} else {
+			keyResult = checkCredential(c, config, clientIP)
+			if keyResult.identity != nil {
 				apiKeyValid = true
-				logger.Debug("API key validation successful for %s", clientIP)
+				c.Set(ContextKeyIdentity, keyResult.identity)
+				logger.Debug("Credential validation successful for %s (%s)", clientIP, keyResult.identity)
+			} else if keyResult.errorCode == "AUTH_API_KEY_MISSING" {
+				logger.Debug("Missing X-API-Key header from %s", clientIP)
 			}
 		}
 
@@ -62,56 +81,20 @@ func UnifiedAuth(config AuthConfig) gin.HandlerFunc {
 		}
 
 		// 鉴权逻辑判断
-		authPassed := false
-		var errorMsg string
-		var errorCode string
-
-		if hasAPIKey && hasIPWhitelist {
-			// 两种方式都配置：都必须通过（AND逻辑）
-			if apiKeyValid && ipWhitelistValid {
-				authPassed = true
-			} else {
-				if !apiKeyValid && !ipWhitelistValid {
-					errorMsg = "Both API key and IP address validation failed"
-					errorCode = "AUTH_BOTH_FAILED"
-				} else if !apiKeyValid {
-					errorMsg = "API key validation failed"
-					errorCode = "AUTH_API_KEY_FAILED"
-				} else {
-					errorMsg = "IP address not allowed"
-					errorCode = "AUTH_IP_FAILED"
-				}
-			}
-		} else if hasAPIKey {
-			// 只配置API Key
-			if apiKeyValid {
-				authPassed = true
-			} else {
-				if c.GetHeader("X-API-Key") == "" {
-					errorMsg = "Missing X-API-Key header"
-					errorCode = "AUTH_API_KEY_MISSING"
-				} else {
-					errorMsg = "Invalid API key"
-					errorCode = "AUTH_API_KEY_INVALID"
-				}
-			}
-		} else if hasIPWhitelist {
-			// 只配置IP白名单
-			if ipWhitelistValid {
-				authPassed = true
-			} else {
-				errorMsg = "IP address not allowed"
-				errorCode = "AUTH_IP_NOT_ALLOWED"
-			}
-		}
+		mode := config.Policy.ModeFor(c.Request.URL.Path)
+		authPassed, errorCode, errorMsg := decideAuth(mode, hasAPIKey, hasIPWhitelist, apiKeyValid, ipWhitelistValid, keyResult)
 
 		if !authPassed {
 			logger.Warn("Authentication failed for %s: %s", clientIP, errorMsg)
+			c.Set(ContextKeyAuthOutcome, AuthOutcomeFailure)
+			if keyResult.errorCode == "AUTH_API_KEY_INVALID" {
+				recordAuthFailure(config.Bans, clientIP)
+			}
 			statusCode := http.StatusUnauthorized
 			errorType := "unauthorized_client"
 			errorURI := "https://tools.ietf.org/html/rfc6749#section-4.1.2.1"
 			
-			if errorCode == "AUTH_IP_NOT_ALLOWED" || errorCode == "AUTH_IP_FAILED" {
+			if errorCode == "AUTH_IP_NOT_ALLOWED" || errorCode == "AUTH_IP_FAILED" || errorCode == "AUTH_API_KEY_FORBIDDEN" || errorCode == "AUTH_CLIENT_CERT_FORBIDDEN" {
 				statusCode = http.StatusForbidden
 				errorType = "access_denied"
 				errorURI = "https://tools.ietf.org/html/rfc6749#section-4.1.2.1"
@@ -126,7 +109,50 @@ func UnifiedAuth(config AuthConfig) gin.HandlerFunc {
 			return
 		}
 
-		logger.Info("Authentication successful for %s", clientIP)
+		c.Set(ContextKeyAuthOutcome, AuthOutcomeSuccess)
+		if identity, ok := KeyIdentityFrom(c); ok {
+			logger.Info("Authentication successful for %s (%s)", clientIP, identity)
+		} else {
+			logger.Info("Authentication successful for %s", clientIP)
+		}
 		c.Next()
 	}
 }
+
+// decideAuth 根据鉴权组合方式合并API Key和IP白名单的验证结果，返回是否通过及错误码和错误信息
+func decideAuth(mode string, hasAPIKey, hasIPWhitelist, apiKeyValid, ipWhitelistValid bool, keyResult keyCheck) (bool, string, string) {
+	switch {
+	case hasAPIKey && hasIPWhitelist:
+		if apiKeyValid && ipWhitelistValid {
+			return true, "", ""
+		}
+		if !apiKeyValid && !ipWhitelistValid {
+			return false, "AUTH_BOTH_FAILED", "Both API key and IP address validation failed"
+		}
+		if mode == config.AuthModeAny {
+			// 任一方式通过即可（OR逻辑）
+			return true, "", ""
+		}
+		// 两种方式都必须通过（AND逻辑）
+		if !apiKeyValid {
+			if keyResult.forbidden() {
+				return false, keyResult.errorCode, keyResult.errorMsg
+			}
+			return false, "AUTH_API_KEY_FAILED", "API key validation failed"
+		}
+		return false, "AUTH_IP_FAILED", "IP address not allowed"
+	case hasAPIKey:
+		// 只配置API Key
+		if apiKeyValid {
+			return true, "", ""
+		}
+		return false, keyResult.errorCode, keyResult.errorMsg
+	case hasIPWhitelist:
+		// 只配置IP白名单
+		if ipWhitelistValid {
+			return true, "", ""
+		}
+		return false, "AUTH_IP_NOT_ALLOWED", "IP address not allowed"
+	}
+	return false, "", ""
+}
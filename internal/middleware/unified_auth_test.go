@@ -0,0 +1,312 @@
+package middleware
+
+import (
+	"gmail-oauth-proxy-server/internal/apikey"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"gmail-oauth-proxy-server/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	// 初始化logger用于测试
+	logger.Init("error")
+}
+
+// newAuthRouter 创建挂载鉴权中间件的测试路由，响应中返回通过鉴权的Key名称
+func newAuthRouter(authConfig AuthConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(UnifiedAuth(authConfig))
+	handler := func(c *gin.Context) {
+		name := ""
+		if identity, ok := KeyIdentityFrom(c); ok {
+			name = identity.Name + "|" + identity.Owner
+		}
+		c.String(http.StatusOK, name)
+	}
+	router.POST("/token", handler)
+	router.GET("/v1/accounts/:email/access_token", handler)
+	return router
+}
+
+// testHasher 测试使用的固定pepper
+var testHasher = apikey.NewHasher([]byte("test-pepper"))
+
+// hashKeys 将测试条目中以明文填写的Hash替换为哈希，与配置缓存中保存的形式一致
+func hashKeys(t *testing.T, keys StaticKeys) StaticKeys {
+	t.Helper()
+	for i := range keys {
+		hash, err := testHasher.Hash(keys[i].Hash)
+		require.NoError(t, err)
+		keys[i].Hash = hash
+	}
+	return keys
+}
+
+// doAuthRequest 发送带API Key的测试请求
+func doAuthRequest(router *gin.Engine, method, path, apiKey, remoteIP string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = remoteIP + ":12345"
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestUnifiedAuth_NamedKeys(t *testing.T) {
+	keys := hashKeys(t, StaticKeys{
+		{Name: "ci", Hash: "gop_ci", Owner: "ops@example.com", Enabled: true},
+		{Name: "old", Hash: "gop_old", Enabled: false},
+		{Name: "expired", Hash: "gop_expired", Enabled: true, ExpiresAt: time.Now().Add(-time.Hour)},
+		{Name: "office", Hash: "gop_office", Enabled: true, CIDRs: []string{"10.0.0.0/8"}},
+		{Name: "vault", Hash: "gop_vault", Enabled: true, Routes: []string{"/v1/accounts/*/access_token"}},
+	})
+	router := newAuthRouter(AuthConfig{APIKey: "default-key", Keys: keys, Hasher: testHasher})
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		apiKey   string
+		remoteIP string
+		status   int
+		body     string
+	}{
+		{"default key", "POST", "/token", "default-key", "203.0.113.1", http.StatusOK, DefaultKeyName + "|"},
+		{"named key", "POST", "/token", "gop_ci", "203.0.113.1", http.StatusOK, "ci|ops@example.com"},
+		{"missing key", "POST", "/token", "", "203.0.113.1", http.StatusUnauthorized, ""},
+		{"unknown key", "POST", "/token", "gop_unknown", "203.0.113.1", http.StatusUnauthorized, ""},
+		{"revoked key", "POST", "/token", "gop_old", "203.0.113.1", http.StatusUnauthorized, ""},
+		{"expired key", "POST", "/token", "gop_expired", "203.0.113.1", http.StatusUnauthorized, ""},
+		{"cidr allowed", "POST", "/token", "gop_office", "10.1.2.3", http.StatusOK, "office|"},
+		{"cidr denied", "POST", "/token", "gop_office", "203.0.113.1", http.StatusForbidden, ""},
+		{"route allowed", "GET", "/v1/accounts/alice@example.com/access_token", "gop_vault", "203.0.113.1", http.StatusOK, "vault|"},
+		{"route denied", "POST", "/token", "gop_vault", "203.0.113.1", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doAuthRequest(router, tt.method, tt.path, tt.apiKey, tt.remoteIP)
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUnifiedAuth_NamedKeysOnly(t *testing.T) {
+	router := newAuthRouter(AuthConfig{Keys: hashKeys(t, StaticKeys{{Name: "ci", Hash: "gop_ci", Enabled: true}}), Hasher: testHasher})
+
+	w := doAuthRequest(router, "POST", "/token", "gop_ci", "203.0.113.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 所有命名API Key被吊销后仍然要求API Key
+	router = newAuthRouter(AuthConfig{Keys: hashKeys(t, StaticKeys{{Name: "ci", Hash: "gop_ci", Enabled: false}}), Hasher: testHasher})
+	w = doAuthRequest(router, "POST", "/token", "gop_ci", "203.0.113.1")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 未配置任何鉴权方式
+	router = newAuthRouter(AuthConfig{Keys: StaticKeys{}})
+	w = doAuthRequest(router, "POST", "/token", "gop_ci", "203.0.113.1")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestUnifiedAuth_NamedKeyWithIPWhitelist(t *testing.T) {
+	keys := hashKeys(t, StaticKeys{{Name: "vault", Hash: "gop_vault", Enabled: true, Routes: []string{"/v1/accounts/*/access_token"}}})
+	router := newAuthRouter(AuthConfig{IPWhitelist: []string{"10.0.0.0/8"}, Keys: keys, Hasher: testHasher})
+
+	w := doAuthRequest(router, "GET", "/v1/accounts/a@example.com/access_token", "gop_vault", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doAuthRequest(router, "GET", "/v1/accounts/a@example.com/access_token", "gop_vault", "203.0.113.1")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = doAuthRequest(router, "POST", "/token", "gop_vault", "10.0.0.1")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "not allowed for this route")
+}
+
+func TestCachedKeyProvider(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cache, err := config.NewConfigCacheWithStore(&config.Config{}, store.NewMemory())
+	require.NoError(t, err)
+
+	provider := NewCachedKeyProvider(cache, false)
+	provider.interval = 0
+	assert.Empty(t, provider.APIKeys())
+
+	key, _, err := cache.CreateAPIKey(config.APIKeyEntry{Name: "ci"})
+	require.NoError(t, err)
+	keys := provider.APIKeys()
+	require.Len(t, keys, 1)
+	assert.True(t, keys[0].Enabled)
+	hasher, err := cache.Hasher()
+	require.NoError(t, err)
+	assert.True(t, hasher.Verify(key, keys[0].Hash))
+
+	// 吊销后重新加载
+	require.NoError(t, cache.RevokeAPIKey("ci"))
+	keys = provider.APIKeys()
+	require.Len(t, keys, 1)
+	assert.False(t, keys[0].Enabled)
+}
+
+func TestUnifiedAuth_HashedDefaultKey(t *testing.T) {
+	hash, err := testHasher.Hash("gop_0123456789abcdef")
+	require.NoError(t, err)
+
+	router := newAuthRouter(AuthConfig{APIKey: hash, Hasher: testHasher})
+	assert.Equal(t, http.StatusOK, doAuthRequest(router, "POST", "/token", "gop_0123456789abcdef", "203.0.113.1").Code)
+	assert.Equal(t, http.StatusUnauthorized, doAuthRequest(router, "POST", "/token", hash, "203.0.113.1").Code)
+
+	// 没有Hasher时无法校验哈希
+	router = newAuthRouter(AuthConfig{APIKey: hash})
+	assert.Equal(t, http.StatusUnauthorized, doAuthRequest(router, "POST", "/token", "gop_0123456789abcdef", "203.0.113.1").Code)
+}
+
+func TestUnifiedAuth_RotatedKey(t *testing.T) {
+	previous, err := testHasher.Hash("gop_old")
+	require.NoError(t, err)
+
+	keys := hashKeys(t, StaticKeys{
+		{Name: "ci", Hash: "gop_new", Enabled: true},
+		{Name: "retired", Hash: "gop_current", Enabled: true},
+	})
+	keys[0].PreviousHash = previous
+	keys[0].PreviousExpiresAt = time.Now().Add(time.Hour)
+	keys[1].PreviousHash = previous
+	keys[1].PreviousExpiresAt = time.Now().Add(-time.Minute)
+
+	var deprecated bool
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(UnifiedAuth(AuthConfig{Keys: keys, Hasher: testHasher}))
+	router.POST("/token", func(c *gin.Context) {
+		identity, _ := KeyIdentityFrom(c)
+		deprecated = identity.Deprecated
+		c.String(http.StatusOK, identity.Name)
+	})
+
+	w := doAuthRequest(router, "POST", "/token", "gop_new", "203.0.113.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, deprecated)
+
+	// 宽限期内旧密钥仍然有效，标记为已弃用
+	w = doAuthRequest(router, "POST", "/token", "gop_old", "203.0.113.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ci", w.Body.String())
+	assert.True(t, deprecated)
+
+	// 宽限期结束后旧密钥失效
+	keys[0].PreviousExpiresAt = time.Now().Add(-time.Second)
+	w = doAuthRequest(router, "POST", "/token", "gop_old", "203.0.113.1")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestCachedKeyProvider_DefaultKeyRotation(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cache, err := config.NewConfigCacheWithStore(&config.Config{}, store.NewMemory())
+	require.NoError(t, err)
+	hasher, err := cache.Hasher()
+	require.NoError(t, err)
+
+	oldKey, _, err := cache.GetOrGenerateAPIKey()
+	require.NoError(t, err)
+
+	provider := NewCachedKeyProvider(cache, true)
+	provider.interval = 0
+	router := newAuthRouter(AuthConfig{Keys: provider, Hasher: hasher})
+	assert.Equal(t, DefaultKeyName+"|", doAuthRequest(router, "POST", "/token", oldKey, "203.0.113.1").Body.String())
+
+	newKey, _, err := cache.RotateDefaultAPIKey(time.Hour)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, doAuthRequest(router, "POST", "/token", newKey, "203.0.113.1").Code)
+	assert.Equal(t, http.StatusOK, doAuthRequest(router, "POST", "/token", oldKey, "203.0.113.1").Code)
+
+	_, _, err = cache.RotateDefaultAPIKey(0)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, doAuthRequest(router, "POST", "/token", oldKey, "203.0.113.1").Code)
+	assert.Equal(t, http.StatusUnauthorized, doAuthRequest(router, "POST", "/token", newKey, "203.0.113.1").Code)
+}
+
+func TestDecideAuth(t *testing.T) {
+	forbidden := keyCheck{errorCode: "AUTH_API_KEY_FORBIDDEN", errorMsg: "API key not allowed for this route"}
+	invalid := keyCheck{errorCode: "AUTH_API_KEY_INVALID", errorMsg: "Invalid API key"}
+
+	tests := []struct {
+		name           string
+		mode           string
+		hasAPIKey      bool
+		hasIPWhitelist bool
+		apiKeyValid    bool
+		ipValid        bool
+		keyResult      keyCheck
+		passed         bool
+		errorCode      string
+	}{
+		{"all: both pass", config.AuthModeAll, true, true, true, true, keyCheck{}, true, ""},
+		{"all: key fails", config.AuthModeAll, true, true, false, true, invalid, false, "AUTH_API_KEY_FAILED"},
+		{"all: key forbidden", config.AuthModeAll, true, true, false, true, forbidden, false, "AUTH_API_KEY_FORBIDDEN"},
+		{"all: ip fails", config.AuthModeAll, true, true, true, false, keyCheck{}, false, "AUTH_IP_FAILED"},
+		{"all: both fail", config.AuthModeAll, true, true, false, false, invalid, false, "AUTH_BOTH_FAILED"},
+		{"any: both pass", config.AuthModeAny, true, true, true, true, keyCheck{}, true, ""},
+		{"any: key only", config.AuthModeAny, true, true, true, false, keyCheck{}, true, ""},
+		{"any: ip only", config.AuthModeAny, true, true, false, true, invalid, true, ""},
+		{"any: both fail", config.AuthModeAny, true, true, false, false, forbidden, false, "AUTH_BOTH_FAILED"},
+		{"key only configured", config.AuthModeAny, true, false, false, false, invalid, false, "AUTH_API_KEY_INVALID"},
+		{"key only configured passes", config.AuthModeAll, true, false, true, false, keyCheck{}, true, ""},
+		{"ip only configured", config.AuthModeAny, false, true, false, false, keyCheck{}, false, "AUTH_IP_NOT_ALLOWED"},
+		{"ip only configured passes", config.AuthModeAll, false, true, false, true, keyCheck{}, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			passed, errorCode, _ := decideAuth(tt.mode, tt.hasAPIKey, tt.hasIPWhitelist, tt.apiKeyValid, tt.ipValid, tt.keyResult)
+			assert.Equal(t, tt.passed, passed)
+			assert.Equal(t, tt.errorCode, errorCode)
+		})
+	}
+}
+
+func TestUnifiedAuth_AuthMode(t *testing.T) {
+	keys := hashKeys(t, StaticKeys{{Name: "ci", Hash: "gop_ci", Enabled: true}})
+	router := newAuthRouter(AuthConfig{
+		IPWhitelist: []string{"10.0.0.0/8"},
+		Keys:        keys,
+		Hasher:      testHasher,
+		Policy: config.AuthPolicyConfig{
+			Mode:   config.AuthModeAny,
+			Routes: []config.AuthRoute{{Path: "/v1/accounts/*/access_token", Mode: config.AuthModeAll}},
+		},
+	})
+
+	// 内网无需API Key，外部调用方需要API Key
+	w := doAuthRequest(router, "POST", "/token", "", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doAuthRequest(router, "POST", "/token", "gop_ci", "203.0.113.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ci|", w.Body.String())
+	w = doAuthRequest(router, "POST", "/token", "", "203.0.113.1")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Both API key and IP address validation failed")
+
+	// 路由覆盖为都必须通过
+	w = doAuthRequest(router, "GET", "/v1/accounts/a@example.com/access_token", "", "10.0.0.1")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = doAuthRequest(router, "GET", "/v1/accounts/a@example.com/access_token", "gop_ci", "203.0.113.1")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = doAuthRequest(router, "GET", "/v1/accounts/a@example.com/access_token", "gop_ci", "10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
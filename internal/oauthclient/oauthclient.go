@@ -0,0 +1,196 @@
+package oauthclient
+
+import (
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"net/url"
+	"regexp"
+	"sort"
+)
+
+// 策略校验错误
+var (
+	ErrUnknownClient         = errors.New("client is not registered")
+	ErrRedirectURINotAllowed = errors.New("redirect_uri not allowed")
+	ErrScopeNotAllowed       = errors.New("scope not allowed")
+)
+
+// Policy 回调地址和权限范围策略
+type Policy struct {
+	name             string
+	redirectURIs     map[string]bool
+	redirectPatterns []*regexp.Regexp
+	scopes           map[string]bool
+	forbiddenScopes  map[string]bool
+}
+
+// CheckRedirectURI 校验回调地址，完全匹配或匹配任一正则表达式即允许（均未配置时不限制）
+func (p *Policy) CheckRedirectURI(redirectURI string) error {
+	if len(p.redirectURIs) == 0 && len(p.redirectPatterns) == 0 {
+		return nil
+	}
+	if p.redirectURIs[redirectURI] {
+		return nil
+	}
+	for _, pattern := range p.redirectPatterns {
+		if pattern.MatchString(redirectURI) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not registered for client %s", ErrRedirectURINotAllowed, redirectURI, p.name)
+}
+
+// CheckScopes 校验权限范围：禁止列表优先，允许列表未配置时不限制
+func (p *Policy) CheckScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if p.forbiddenScopes[scope] {
+			return fmt.Errorf("%w: %s is forbidden for client %s", ErrScopeNotAllowed, scope, p.name)
+		}
+		if len(p.scopes) > 0 && !p.scopes[scope] {
+			return fmt.Errorf("%w: %s is not allowed for client %s", ErrScopeNotAllowed, scope, p.name)
+		}
+	}
+	return nil
+}
+
+// Client 服务端登记的OAuth客户端
+type Client struct {
+	Policy
+	Alias  string
+	ID     string
+	Secret string
+}
+
+// Name 返回用于日志展示的客户端名称，优先使用别名
+func (c *Client) Name() string {
+	if c.Alias != "" {
+		return c.Alias
+	}
+	return c.ID
+}
+
+// Registry 按client_id和别名索引的客户端登记表
+type Registry struct {
+	clients           map[string]*Client
+	byAlias           map[string]*Client
+	requireRegistered bool
+	forbiddenScopes   []string
+}
+
+// NewRegistry 根据配置创建客户端登记表
+func NewRegistry(cfgs []config.ClientConfig, policy config.ClientPolicyConfig) (*Registry, error) {
+	registry := &Registry{
+		clients:           make(map[string]*Client, len(cfgs)),
+		byAlias:           make(map[string]*Client, len(cfgs)),
+		requireRegistered: policy.RequireRegistered,
+		forbiddenScopes:   policy.ForbiddenScopes,
+	}
+
+	for i, cfg := range cfgs {
+		if cfg.ClientID == "" {
+			return nil, fmt.Errorf("client #%d has no client_id", i+1)
+		}
+		if cfg.ClientSecret == "" {
+			return nil, fmt.Errorf("client %q has no client_secret", cfg.ClientID)
+		}
+		if _, exists := registry.clients[cfg.ClientID]; exists {
+			return nil, fmt.Errorf("duplicate client_id %q", cfg.ClientID)
+		}
+
+		client := &Client{
+			Alias:  cfg.Alias,
+			ID:     cfg.ClientID,
+			Secret: cfg.ClientSecret,
+		}
+		client.Policy = registry.newPolicy(client.Name(), cfg.Scopes, cfg.ForbiddenScopes)
+		client.redirectURIs = make(map[string]bool, len(cfg.RedirectURIs))
+		for _, redirectURI := range cfg.RedirectURIs {
+			u, err := url.Parse(redirectURI)
+			if err != nil || u.Scheme == "" {
+				return nil, fmt.Errorf("client %q: invalid redirect_uri %q", client.Name(), redirectURI)
+			}
+			client.redirectURIs[redirectURI] = true
+		}
+		for _, pattern := range cfg.RedirectURIPatterns {
+			compiled, err := regexp.Compile(`^(?:` + pattern + `)$`)
+			if err != nil {
+				return nil, fmt.Errorf("client %q: invalid redirect_uri pattern: %w", client.Name(), err)
+			}
+			client.redirectPatterns = append(client.redirectPatterns, compiled)
+		}
+
+		registry.clients[cfg.ClientID] = client
+		if cfg.Alias != "" {
+			if _, exists := registry.byAlias[cfg.Alias]; exists {
+				return nil, fmt.Errorf("duplicate client alias %q", cfg.Alias)
+			}
+			registry.byAlias[cfg.Alias] = client
+		}
+	}
+
+	// 别名不能与其他客户端的client_id冲突，否则解析结果不确定
+	for alias, client := range registry.byAlias {
+		if other, exists := registry.clients[alias]; exists && other != client {
+			return nil, fmt.Errorf("client alias %q conflicts with another client_id", alias)
+		}
+	}
+
+	return registry, nil
+}
+
+// newPolicy 创建合并了全局禁止列表的策略
+func (r *Registry) newPolicy(name string, scopes, forbiddenScopes []string) Policy {
+	policy := Policy{
+		name:            name,
+		scopes:          make(map[string]bool, len(scopes)),
+		forbiddenScopes: make(map[string]bool, len(forbiddenScopes)+len(r.forbiddenScopes)),
+	}
+	for _, scope := range scopes {
+		policy.scopes[scope] = true
+	}
+	for _, scope := range r.forbiddenScopes {
+		policy.forbiddenScopes[scope] = true
+	}
+	for _, scope := range forbiddenScopes {
+		policy.forbiddenScopes[scope] = true
+	}
+	return policy
+}
+
+// Resolve 按client_id或别名查找已登记的客户端
+func (r *Registry) Resolve(idOrAlias string) (*Client, bool) {
+	if client, ok := r.clients[idOrAlias]; ok {
+		return client, true
+	}
+	client, ok := r.byAlias[idOrAlias]
+	return client, ok
+}
+
+// Lookup 查找客户端及其适用的策略
+// 未登记的客户端使用全局策略（仅包含全局禁止的权限范围），启用 require_registered 时返回 ErrUnknownClient
+func (r *Registry) Lookup(idOrAlias string) (*Client, *Policy, error) {
+	if client, ok := r.Resolve(idOrAlias); ok {
+		return client, &client.Policy, nil
+	}
+	if r.requireRegistered {
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownClient, idOrAlias)
+	}
+	policy := r.newPolicy(idOrAlias, nil, nil)
+	return nil, &policy, nil
+}
+
+// Len 返回已登记的客户端数量
+func (r *Registry) Len() int {
+	return len(r.clients)
+}
+
+// Names 返回所有客户端名称（已排序）
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.clients))
+	for _, client := range r.clients {
+		names = append(names, client.Name())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,130 @@
+package oauthclient
+
+import (
+	"errors"
+	"gmail-oauth-proxy-server/internal/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_Resolve(t *testing.T) {
+	registry, err := NewRegistry([]config.ClientConfig{
+		{
+			Alias:        "web",
+			ClientID:     "web.apps.googleusercontent.com",
+			ClientSecret: "web_secret",
+			RedirectURIs: []string{"https://app.example.com/callback"},
+			Scopes:       []string{"openid", "email"},
+		},
+		{
+			ClientID:     "cli.apps.googleusercontent.com",
+			ClientSecret: "cli_secret",
+		},
+	}, config.ClientPolicyConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, registry.Len())
+	assert.Equal(t, []string{"cli.apps.googleusercontent.com", "web"}, registry.Names())
+
+	byAlias, ok := registry.Resolve("web")
+	require.True(t, ok)
+	byID, ok := registry.Resolve("web.apps.googleusercontent.com")
+	require.True(t, ok)
+	assert.Same(t, byAlias, byID)
+	assert.Equal(t, "web_secret", byID.Secret)
+
+	_, ok = registry.Resolve("unknown")
+	assert.False(t, ok)
+
+	// 回调地址和权限范围校验
+	assert.NoError(t, byID.CheckRedirectURI("https://app.example.com/callback"))
+	assert.Error(t, byID.CheckRedirectURI("https://app.example.com/callback/other"))
+	assert.NoError(t, byID.CheckScopes([]string{"openid", "email"}))
+	assert.Error(t, byID.CheckScopes([]string{"openid", "https://mail.google.com/"}))
+
+	// 未配置允许列表时不限制
+	cli, ok := registry.Resolve("cli.apps.googleusercontent.com")
+	require.True(t, ok)
+	assert.NoError(t, cli.CheckRedirectURI("http://127.0.0.1:8085/"))
+	assert.NoError(t, cli.CheckScopes([]string{"https://mail.google.com/"}))
+}
+
+func TestPolicy(t *testing.T) {
+	registry, err := NewRegistry([]config.ClientConfig{
+		{
+			Alias:               "web",
+			ClientID:            "web.apps.googleusercontent.com",
+			ClientSecret:        "web_secret",
+			RedirectURIs:        []string{"https://app.example.com/callback"},
+			RedirectURIPatterns: []string{`https://[a-z0-9-]+\.preview\.example\.com/callback`, `http://127\.0\.0\.1:\d+/`},
+			ForbiddenScopes:     []string{"https://www.googleapis.com/auth/gmail.send"},
+		},
+	}, config.ClientPolicyConfig{ForbiddenScopes: []string{"https://mail.google.com/"}})
+	require.NoError(t, err)
+
+	client, policy, err := registry.Lookup("web")
+	require.NoError(t, err)
+	require.NotNil(t, client)
+
+	t.Run("redirect uri patterns", func(t *testing.T) {
+		assert.NoError(t, policy.CheckRedirectURI("https://app.example.com/callback"))
+		assert.NoError(t, policy.CheckRedirectURI("https://pr-42.preview.example.com/callback"))
+		assert.NoError(t, policy.CheckRedirectURI("http://127.0.0.1:53682/"))
+
+		// 正则需要完整匹配
+		err := policy.CheckRedirectURI("https://pr-42.preview.example.com/callback.evil.com")
+		assert.True(t, errors.Is(err, ErrRedirectURINotAllowed))
+		assert.Error(t, policy.CheckRedirectURI("https://evil.com/?https://pr-1.preview.example.com/callback"))
+	})
+
+	t.Run("forbidden scopes", func(t *testing.T) {
+		assert.NoError(t, policy.CheckScopes([]string{"openid", "https://www.googleapis.com/auth/gmail.readonly"}))
+
+		err := policy.CheckScopes([]string{"https://www.googleapis.com/auth/gmail.send"})
+		assert.True(t, errors.Is(err, ErrScopeNotAllowed))
+
+		// 全局禁止列表同样适用于已登记的客户端
+		err = policy.CheckScopes([]string{"openid", "https://mail.google.com/"})
+		assert.True(t, errors.Is(err, ErrScopeNotAllowed))
+	})
+
+	t.Run("unregistered client uses global policy", func(t *testing.T) {
+		client, policy, err := registry.Lookup("other.apps.googleusercontent.com")
+		require.NoError(t, err)
+		assert.Nil(t, client)
+		assert.NoError(t, policy.CheckRedirectURI("https://anything.example.com/"))
+		assert.NoError(t, policy.CheckScopes([]string{"https://www.googleapis.com/auth/gmail.send"}))
+		assert.Error(t, policy.CheckScopes([]string{"https://mail.google.com/"}))
+	})
+
+	t.Run("require registered", func(t *testing.T) {
+		strict, err := NewRegistry(nil, config.ClientPolicyConfig{RequireRegistered: true})
+		require.NoError(t, err)
+
+		_, _, err = strict.Lookup("other.apps.googleusercontent.com")
+		assert.True(t, errors.Is(err, ErrUnknownClient))
+	})
+}
+
+func TestNewRegistry_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfgs []config.ClientConfig
+	}{
+		{"missing client_id", []config.ClientConfig{{ClientSecret: "s"}}},
+		{"missing client_secret", []config.ClientConfig{{ClientID: "a"}}},
+		{"duplicate client_id", []config.ClientConfig{{ClientID: "a", ClientSecret: "s"}, {ClientID: "a", ClientSecret: "s"}}},
+		{"duplicate alias", []config.ClientConfig{{Alias: "x", ClientID: "a", ClientSecret: "s"}, {Alias: "x", ClientID: "b", ClientSecret: "s"}}},
+		{"alias conflicts with client_id", []config.ClientConfig{{ClientID: "a", ClientSecret: "s"}, {Alias: "a", ClientID: "b", ClientSecret: "s"}}},
+		{"invalid redirect_uri", []config.ClientConfig{{ClientID: "a", ClientSecret: "s", RedirectURIs: []string{"not a url"}}}},
+		{"invalid redirect_uri pattern", []config.ClientConfig{{ClientID: "a", ClientSecret: "s", RedirectURIPatterns: []string{"(unclosed"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(tt.cfgs, config.ClientPolicyConfig{})
+			assert.Error(t, err)
+		})
+	}
+}
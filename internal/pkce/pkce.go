@@ -0,0 +1,174 @@
+package pkce
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PKCE code_challenge_method（RFC 7636 第4.2节）
+const (
+	MethodS256  = "S256"
+	MethodPlain = "plain"
+)
+
+// code_verifier 长度限制（RFC 7636 第4.1节）
+const (
+	MinVerifierLength = 43
+	MaxVerifierLength = 128
+)
+
+// isUnreserved 判断字符是否属于 RFC 3986 unreserved 字符集 [A-Za-z0-9-._~]
+func isUnreserved(ch byte) bool {
+	return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+		ch == '-' || ch == '.' || ch == '_' || ch == '~'
+}
+
+// isBase64URL 判断字符是否属于无填充 base64url 字符集 [A-Za-z0-9-_]
+func isBase64URL(ch byte) bool {
+	return (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') ||
+		ch == '-' || ch == '_'
+}
+
+// ValidateVerifier 验证 code_verifier 格式：43-128个 unreserved 字符
+func ValidateVerifier(verifier string) error {
+	if len(verifier) < MinVerifierLength || len(verifier) > MaxVerifierLength {
+		return fmt.Errorf("invalid code_verifier: length must be between %d and %d characters", MinVerifierLength, MaxVerifierLength)
+	}
+	for i := 0; i < len(verifier); i++ {
+		if !isUnreserved(verifier[i]) {
+			return fmt.Errorf("invalid code_verifier: only [A-Za-z0-9-._~] characters are allowed")
+		}
+	}
+	return nil
+}
+
+// ValidateChallenge 验证 code_challenge 及 code_challenge_method
+// method 为空时按 RFC 7636 视为 plain
+func ValidateChallenge(challenge, method string) error {
+	if challenge == "" {
+		return fmt.Errorf("code_challenge is required when code_challenge_method is set")
+	}
+
+	switch method {
+	case MethodS256:
+		// SHA-256 摘要的无填充 base64url 编码固定为43个字符
+		if len(challenge) != MinVerifierLength {
+			return fmt.Errorf("invalid code_challenge: S256 challenge must be %d characters", MinVerifierLength)
+		}
+		for i := 0; i < len(challenge); i++ {
+			if !isBase64URL(challenge[i]) {
+				return fmt.Errorf("invalid code_challenge: S256 challenge must be base64url encoded without padding")
+			}
+		}
+		return nil
+	case MethodPlain, "":
+		if err := ValidateVerifier(challenge); err != nil {
+			return fmt.Errorf("invalid code_challenge: plain challenge must be a valid code_verifier")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported code_challenge_method: %s (supported: S256, plain)", method)
+	}
+}
+
+// GenerateVerifier 生成随机 code_verifier（32字节随机数的 base64url 编码，43个字符）
+func GenerateVerifier() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// ChallengeS256 计算 S256 code_challenge
+func ChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// sweepInterval 清理过期 code_verifier 的间隔
+const sweepInterval = time.Minute
+
+// verifierKey 代理生成的 code_verifier 按 client_id 和 state 索引
+type verifierKey struct {
+	clientID string
+	state    string
+}
+
+// verifierEntry 存储的 code_verifier
+type verifierEntry struct {
+	verifier  string
+	expiresAt time.Time
+}
+
+// VerifierStore 代理生成的 code_verifier 存储，按 client_id 和 state 索引，取出后即删除
+type VerifierStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[verifierKey]verifierEntry
+	sweptAt time.Time
+	now     func() time.Time
+}
+
+// NewVerifierStore 创建 code_verifier 存储
+func NewVerifierStore(ttl time.Duration) *VerifierStore {
+	return &VerifierStore{
+		ttl:     ttl,
+		entries: make(map[verifierKey]verifierEntry),
+		now:     time.Now,
+	}
+}
+
+// Save 保存 client_id 和 state 对应的 code_verifier，state 已被未完成的授权流程使用时返回错误
+func (s *VerifierStore) Save(clientID, state, verifier string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	key := verifierKey{clientID: clientID, state: state}
+	if entry, ok := s.entries[key]; ok && !now.After(entry.expiresAt) {
+		return fmt.Errorf("state is already in use by a pending authorization request")
+	}
+	s.entries[key] = verifierEntry{
+		verifier:  verifier,
+		expiresAt: now.Add(s.ttl),
+	}
+	return nil
+}
+
+// Take 取出并删除 client_id 和 state 对应的 code_verifier（授权码只能使用一次）
+func (s *VerifierStore) Take(clientID, state string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := verifierKey{clientID: clientID, state: state}
+	entry, ok := s.entries[key]
+	if !ok {
+		return "", false
+	}
+	delete(s.entries, key)
+
+	if s.now().After(entry.expiresAt) {
+		return "", false
+	}
+	return entry.verifier, true
+}
+
+// sweep 定期删除过期条目，避免未完成的授权流程无限堆积（调用方需持有s.mu）
+func (s *VerifierStore) sweep(now time.Time) {
+	if now.Sub(s.sweptAt) < sweepInterval {
+		return
+	}
+	s.sweptAt = now
+	for key, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
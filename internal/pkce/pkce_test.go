@@ -0,0 +1,105 @@
+package pkce
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateVerifier(t *testing.T) {
+	assert.NoError(t, ValidateVerifier(strings.Repeat("a", MinVerifierLength)))
+	assert.NoError(t, ValidateVerifier(strings.Repeat("Z9-._~", 22)[:MaxVerifierLength]))
+
+	assert.Error(t, ValidateVerifier(strings.Repeat("a", MinVerifierLength-1)))
+	assert.Error(t, ValidateVerifier(strings.Repeat("a", MaxVerifierLength+1)))
+	assert.Error(t, ValidateVerifier(strings.Repeat("a", 42)+"+"))
+	assert.Error(t, ValidateVerifier(strings.Repeat("a", 42)+"="))
+}
+
+func TestValidateChallenge(t *testing.T) {
+	// RFC 7636 附录B示例
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	assert.Equal(t, challenge, ChallengeS256(verifier))
+
+	assert.NoError(t, ValidateChallenge(challenge, MethodS256))
+	assert.NoError(t, ValidateChallenge(verifier, MethodPlain))
+	assert.NoError(t, ValidateChallenge(verifier, ""))
+
+	assert.Error(t, ValidateChallenge("", MethodS256))
+	assert.Error(t, ValidateChallenge(challenge+"=", MethodS256))
+	assert.Error(t, ValidateChallenge(strings.Replace(challenge, "-", "+", 1), MethodS256))
+	assert.Error(t, ValidateChallenge("short", MethodPlain))
+	assert.Error(t, ValidateChallenge(challenge, "S512"))
+}
+
+func TestGenerateVerifier(t *testing.T) {
+	verifier, err := GenerateVerifier()
+	require.NoError(t, err)
+	assert.NoError(t, ValidateVerifier(verifier))
+	assert.NoError(t, ValidateChallenge(ChallengeS256(verifier), MethodS256))
+
+	other, err := GenerateVerifier()
+	require.NoError(t, err)
+	assert.NotEqual(t, verifier, other)
+}
+
+func TestVerifierStore(t *testing.T) {
+	now := time.Now()
+	store := NewVerifierStore(time.Minute)
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Save("client-a", "state-1", "verifier-1"))
+	require.NoError(t, store.Save("client-a", "state-2", "verifier-2"))
+
+	// 未完成的授权流程不能重复使用state，其他客户端不受影响
+	assert.Error(t, store.Save("client-a", "state-1", "other"))
+	require.NoError(t, store.Save("client-b", "state-1", "verifier-b"))
+
+	// client_id不匹配时无法取出，也不会消耗原条目
+	_, ok := store.Take("client-c", "state-1")
+	assert.False(t, ok)
+
+	// 取出后即删除
+	verifier, ok := store.Take("client-a", "state-1")
+	assert.True(t, ok)
+	assert.Equal(t, "verifier-1", verifier)
+	_, ok = store.Take("client-a", "state-1")
+	assert.False(t, ok)
+	verifier, ok = store.Take("client-b", "state-1")
+	assert.True(t, ok)
+	assert.Equal(t, "verifier-b", verifier)
+
+	// 过期后无法取出，过期的state可以重新使用
+	now = now.Add(2 * time.Minute)
+	_, ok = store.Take("client-a", "state-2")
+	assert.False(t, ok)
+	require.NoError(t, store.Save("client-a", "state-3", "verifier-3"))
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, store.Save("client-a", "state-3", "verifier-3b"))
+	verifier, ok = store.Take("client-a", "state-3")
+	assert.True(t, ok)
+	assert.Equal(t, "verifier-3b", verifier)
+}
+
+func TestVerifierStore_Sweep(t *testing.T) {
+	now := time.Now()
+	store := NewVerifierStore(time.Minute)
+	store.now = func() time.Time { return now }
+
+	require.NoError(t, store.Save("client", "state-1", "verifier-1"))
+	require.NoError(t, store.Save("client", "state-2", "verifier-2"))
+
+	// 未到清理间隔时不清理
+	now = now.Add(sweepInterval / 2)
+	require.NoError(t, store.Save("client", "state-3", "verifier-3"))
+	assert.Len(t, store.entries, 3)
+
+	// 到达清理间隔后删除过期条目
+	now = now.Add(sweepInterval)
+	require.NoError(t, store.Save("client", "state-4", "verifier-4"))
+	assert.Len(t, store.entries, 2)
+}
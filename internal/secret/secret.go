@@ -0,0 +1,350 @@
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// sealedPrefix 信封加密数据的前缀，没有该前缀的数据视为明文（兼容启用加密前写入的数据）
+const sealedPrefix = "enc:v1:"
+
+// 口令派生主密钥使用的scrypt参数
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// 解密错误
+var (
+	ErrNoMasterKey = errors.New("data is encrypted but no master key is configured")
+	ErrWrongKey    = errors.New("data was encrypted with a different master key")
+)
+
+// Source 主密钥来源，三者只能配置一个
+type Source struct {
+	Key        string // base64编码的32字节密钥
+	KeyFile    string // 保存base64密钥（或32字节原始密钥）的文件路径
+	Passphrase string // 口令，使用scrypt派生密钥
+}
+
+// Keyring 主密钥（KEK），用于包装每条数据独立生成的数据密钥（DEK）
+// nil Keyring 表示未启用静态加密：Seal原样返回明文，Open遇到密文时返回 ErrNoMasterKey
+type Keyring struct {
+	key        []byte // 直接配置的主密钥
+	passphrase []byte // 口令（使用口令时key为nil）
+	salt       []byte // 本进程加密时使用的盐
+
+	mu      sync.Mutex
+	derived map[string][]byte // 按盐缓存派生出的主密钥
+}
+
+// envelope 信封加密数据
+type envelope struct {
+	KeyID string `json:"kid"`            // 主密钥指纹
+	Salt  string `json:"salt,omitempty"` // 口令派生时使用的盐
+	DEK   string `json:"dek"`            // 主密钥加密后的数据密钥 base64(nonce || ciphertext)
+	Data  string `json:"data"`           // 数据密钥加密后的数据 base64(nonce || ciphertext)
+}
+
+// ParseKey 解析base64编码的32字节主密钥
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key must be base64 encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// GenerateKey 生成base64编码的随机主密钥
+func GenerateKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate master key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// LoadKeyring 根据主密钥来源创建Keyring，未配置任何来源时返回nil
+func LoadKeyring(src Source) (*Keyring, error) {
+	configured := 0
+	for _, value := range []string{src.Key, src.KeyFile, src.Passphrase} {
+		if value != "" {
+			configured++
+		}
+	}
+	if configured == 0 {
+		return nil, nil
+	}
+	if configured > 1 {
+		return nil, fmt.Errorf("only one of master key, key file and passphrase can be configured")
+	}
+
+	switch {
+	case src.Key != "":
+		key, err := ParseKey(src.Key)
+		if err != nil {
+			return nil, err
+		}
+		return &Keyring{key: key}, nil
+	case src.KeyFile != "":
+		data, err := os.ReadFile(src.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key file: %w", err)
+		}
+		if len(data) == 32 {
+			return &Keyring{key: data}, nil
+		}
+		key, err := ParseKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key file %s: %w", src.KeyFile, err)
+		}
+		return &Keyring{key: key}, nil
+	default:
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		return &Keyring{passphrase: []byte(src.Passphrase), salt: salt, derived: make(map[string][]byte)}, nil
+	}
+}
+
+// Enabled 判断是否启用了静态加密
+func (k *Keyring) Enabled() bool {
+	return k != nil
+}
+
+// Kind 返回主密钥来源类型，用于展示
+func (k *Keyring) Kind() string {
+	switch {
+	case k == nil:
+		return "none"
+	case k.passphrase != nil:
+		return "passphrase"
+	default:
+		return "key"
+	}
+}
+
+// IsSealed 判断数据是否为信封加密格式
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(sealedPrefix))
+}
+
+// Owns 判断数据是否已由该主密钥保护（k为nil时判断是否为明文）
+func (k *Keyring) Owns(data []byte) bool {
+	if !IsSealed(data) {
+		return k == nil
+	}
+	if k == nil {
+		return false
+	}
+	_, _, err := k.unwrap(data)
+	return err == nil
+}
+
+// Seal 使用随机数据密钥加密数据，并用主密钥包装数据密钥
+func (k *Keyring) Seal(plaintext []byte) ([]byte, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	data, err := encrypt(dek, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return k.wrap(dek, data)
+}
+
+// Open 解密信封加密的数据，明文数据原样返回
+func (k *Keyring) Open(data []byte) ([]byte, error) {
+	if !IsSealed(data) {
+		return data, nil
+	}
+	if k == nil {
+		return nil, ErrNoMasterKey
+	}
+
+	env, dek, err := k.unwrap(data)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Data)
+	if err != nil {
+		return nil, fmt.Errorf("corrupted encrypted data")
+	}
+	return decrypt(dek, ciphertext)
+}
+
+// Rewrap 使用新的主密钥重新包装数据密钥，数据本身无需重新加密
+// 明文数据使用新主密钥加密；to为nil时解密为明文
+func (k *Keyring) Rewrap(data []byte, to *Keyring) ([]byte, error) {
+	if !IsSealed(data) || to == nil {
+		plaintext, err := k.Open(data)
+		if err != nil {
+			return nil, err
+		}
+		return to.Seal(plaintext)
+	}
+	if k == nil {
+		return nil, ErrNoMasterKey
+	}
+
+	env, dek, err := k.unwrap(data)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Data)
+	if err != nil {
+		return nil, fmt.Errorf("corrupted encrypted data")
+	}
+	return to.wrap(dek, ciphertext)
+}
+
+// wrap 使用主密钥包装数据密钥并编码为信封格式
+func (k *Keyring) wrap(dek, data []byte) ([]byte, error) {
+	kek, err := k.kek(k.salt)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := encrypt(kek, dek)
+	if err != nil {
+		return nil, err
+	}
+
+	env := envelope{
+		KeyID: fingerprint(kek),
+		DEK:   base64.StdEncoding.EncodeToString(wrapped),
+		Data:  base64.StdEncoding.EncodeToString(data),
+	}
+	if k.salt != nil {
+		env.Salt = base64.StdEncoding.EncodeToString(k.salt)
+	}
+	encoded, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sealedPrefix + base64.RawURLEncoding.EncodeToString(encoded)), nil
+}
+
+// unwrap 解析信封并解出数据密钥
+func (k *Keyring) unwrap(data []byte) (envelope, []byte, error) {
+	var env envelope
+	decoded, err := base64.RawURLEncoding.DecodeString(string(data[len(sealedPrefix):]))
+	if err != nil {
+		return env, nil, fmt.Errorf("corrupted encrypted data")
+	}
+	if err := json.Unmarshal(decoded, &env); err != nil {
+		return env, nil, fmt.Errorf("corrupted encrypted data: %w", err)
+	}
+
+	var salt []byte
+	if env.Salt != "" {
+		if salt, err = base64.StdEncoding.DecodeString(env.Salt); err != nil {
+			return env, nil, fmt.Errorf("corrupted encrypted data")
+		}
+	}
+	kek, err := k.kek(salt)
+	if err != nil {
+		return env, nil, err
+	}
+	if fingerprint(kek) != env.KeyID {
+		return env, nil, ErrWrongKey
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(env.DEK)
+	if err != nil {
+		return env, nil, fmt.Errorf("corrupted encrypted data")
+	}
+	dek, err := decrypt(kek, wrapped)
+	if err != nil {
+		return env, nil, err
+	}
+	return env, dek, nil
+}
+
+// kek 返回主密钥，使用口令时按盐派生并缓存
+func (k *Keyring) kek(salt []byte) ([]byte, error) {
+	if k.passphrase == nil {
+		return k.key, nil
+	}
+	if salt == nil {
+		return nil, ErrWrongKey
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if kek, ok := k.derived[string(salt)]; ok {
+		return kek, nil
+	}
+	kek, err := scrypt.Key(k.passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive master key: %w", err)
+	}
+	k.derived[string(salt)] = kek
+	return kek, nil
+}
+
+// fingerprint 主密钥指纹，用于识别加密数据时使用的主密钥
+func fingerprint(kek []byte) string {
+	sum := sha256.Sum256(kek)
+	return hex.EncodeToString(sum[:8])
+}
+
+// encrypt AES-256-GCM加密，返回 nonce || ciphertext
+func encrypt(key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// decrypt AES-256-GCM解密 nonce || ciphertext
+func decrypt(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("corrupted encrypted data")
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data (wrong master key?)")
+	}
+	return plaintext, nil
+}
+
+// newAEAD 创建AES-GCM实例
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,140 @@
+package secret
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadKeyring(t *testing.T) {
+	keyring, err := LoadKeyring(Source{})
+	require.NoError(t, err)
+	assert.Nil(t, keyring)
+	assert.False(t, keyring.Enabled())
+
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	keyring, err = LoadKeyring(Source{Key: key})
+	require.NoError(t, err)
+	assert.Equal(t, "key", keyring.Kind())
+
+	// 密钥文件支持base64文本和32字节原始密钥
+	dir := t.TempDir()
+	encodedFile := filepath.Join(dir, "master.key")
+	require.NoError(t, os.WriteFile(encodedFile, []byte(key+"\n"), 0600))
+	fromFile, err := LoadKeyring(Source{KeyFile: encodedFile})
+	require.NoError(t, err)
+
+	raw, _ := base64.StdEncoding.DecodeString(key)
+	rawFile := filepath.Join(dir, "master.bin")
+	require.NoError(t, os.WriteFile(rawFile, raw, 0600))
+	fromRawFile, err := LoadKeyring(Source{KeyFile: rawFile})
+	require.NoError(t, err)
+
+	sealed, err := keyring.Seal([]byte("hello"))
+	require.NoError(t, err)
+	for _, k := range []*Keyring{fromFile, fromRawFile} {
+		plaintext, err := k.Open(sealed)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(plaintext))
+	}
+
+	_, err = LoadKeyring(Source{Key: key, Passphrase: "secret"})
+	assert.Error(t, err)
+	_, err = LoadKeyring(Source{Key: "short"})
+	assert.Error(t, err)
+	_, err = LoadKeyring(Source{KeyFile: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+}
+
+func TestKeyring_SealOpen(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	keyring, err := LoadKeyring(Source{Key: key})
+	require.NoError(t, err)
+
+	sealed, err := keyring.Seal([]byte("gop_api_key"))
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealed))
+	assert.NotContains(t, string(sealed), "gop_api_key")
+	assert.True(t, keyring.Owns(sealed))
+
+	plaintext, err := keyring.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "gop_api_key", string(plaintext))
+
+	// 明文数据原样返回
+	plaintext, err = keyring.Open([]byte("legacy"))
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", string(plaintext))
+
+	// 未配置主密钥
+	var none *Keyring
+	_, err = none.Open(sealed)
+	assert.True(t, errors.Is(err, ErrNoMasterKey))
+	plaintext, err = none.Seal([]byte("plain"))
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(plaintext))
+
+	// 错误的主密钥
+	otherKey, _ := GenerateKey()
+	other, err := LoadKeyring(Source{Key: otherKey})
+	require.NoError(t, err)
+	_, err = other.Open(sealed)
+	assert.True(t, errors.Is(err, ErrWrongKey))
+	assert.False(t, other.Owns(sealed))
+}
+
+func TestKeyring_Passphrase(t *testing.T) {
+	keyring, err := LoadKeyring(Source{Passphrase: "correct horse battery staple"})
+	require.NoError(t, err)
+	assert.Equal(t, "passphrase", keyring.Kind())
+
+	sealed, err := keyring.Seal([]byte("refresh_token"))
+	require.NoError(t, err)
+
+	// 同一口令的新实例（不同的盐）可以解密
+	reloaded, err := LoadKeyring(Source{Passphrase: "correct horse battery staple"})
+	require.NoError(t, err)
+	plaintext, err := reloaded.Open(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "refresh_token", string(plaintext))
+
+	wrong, err := LoadKeyring(Source{Passphrase: "wrong"})
+	require.NoError(t, err)
+	_, err = wrong.Open(sealed)
+	assert.True(t, errors.Is(err, ErrWrongKey))
+}
+
+func TestKeyring_Rewrap(t *testing.T) {
+	oldKey, _ := GenerateKey()
+	from, err := LoadKeyring(Source{Key: oldKey})
+	require.NoError(t, err)
+	to, err := LoadKeyring(Source{Passphrase: "new passphrase"})
+	require.NoError(t, err)
+
+	sealed, err := from.Seal([]byte("data"))
+	require.NoError(t, err)
+
+	rewrapped, err := from.Rewrap(sealed, to)
+	require.NoError(t, err)
+	assert.False(t, from.Owns(rewrapped))
+	assert.True(t, to.Owns(rewrapped))
+	plaintext, err := to.Open(rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(plaintext))
+
+	// 明文数据加密，to为nil时解密
+	sealedLegacy, err := from.Rewrap([]byte("legacy"), to)
+	require.NoError(t, err)
+	assert.True(t, IsSealed(sealedLegacy))
+	plaintext, err = to.Rewrap(rewrapped, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(plaintext))
+}
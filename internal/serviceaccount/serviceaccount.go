@@ -0,0 +1,220 @@
+package serviceaccount
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GrantType JWT Bearer授权类型（RFC 7523）
+const GrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// assertionLifetime 签发的JWT断言有效期，Google允许的最大值为1小时
+const assertionLifetime = time.Hour
+
+// 授权校验错误
+var (
+	ErrScopeNotAllowed   = errors.New("scope not allowed")
+	ErrSubjectNotAllowed = errors.New("subject not allowed")
+)
+
+// Key Google服务账号JSON密钥
+type Key struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+
+	signer *rsa.PrivateKey
+}
+
+// ParseKey 解析Google服务账号JSON密钥
+func ParseKey(data []byte) (*Key, error) {
+	var key Key
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid service account key json: %w", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("invalid service account key: type must be service_account, got %q", key.Type)
+	}
+	if key.ClientEmail == "" {
+		return nil, fmt.Errorf("invalid service account key: client_email is missing")
+	}
+
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid service account key: private_key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		// 兼容旧版PKCS#1格式的私钥
+		rsaKey, pkcs1Err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if pkcs1Err != nil {
+			return nil, fmt.Errorf("invalid service account key: %w", err)
+		}
+		parsed = rsaKey
+	}
+	signer, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid service account key: private_key must be an RSA key")
+	}
+	key.signer = signer
+
+	if key.TokenURI == "" {
+		key.TokenURI = config.DefaultTokenURL
+	}
+	return &key, nil
+}
+
+// SignAssertion 签发JWT断言（RS256），subject非空时用于域范围委派
+func (k *Key) SignAssertion(scopes []string, subject string, now time.Time) (string, error) {
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	}
+	if k.PrivateKeyID != "" {
+		header["kid"] = k.PrivateKeyID
+	}
+
+	claims := map[string]interface{}{
+		"iss":   k.ClientEmail,
+		"scope": strings.Join(scopes, " "),
+		"aud":   k.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, k.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign assertion: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Account 已加载的服务账号及其使用限制
+type Account struct {
+	Name     string
+	Key      *Key
+	scopes   map[string]bool
+	subjects []string
+}
+
+// Authorize 校验申请的权限范围和委派用户是否在允许范围内
+func (a *Account) Authorize(scopes []string, subject string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: scope is required for service account %s", ErrScopeNotAllowed, a.Name)
+	}
+	if len(a.scopes) > 0 {
+		for _, scope := range scopes {
+			if !a.scopes[scope] {
+				return fmt.Errorf("%w: %s is not allowed for service account %s", ErrScopeNotAllowed, scope, a.Name)
+			}
+		}
+	}
+
+	if subject == "" {
+		return nil
+	}
+	subject = strings.ToLower(subject)
+	for _, pattern := range a.subjects {
+		if matched, _ := path.Match(pattern, subject); matched {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not allowed for service account %s", ErrSubjectNotAllowed, subject, a.Name)
+}
+
+// Registry 按名称索引的服务账号
+type Registry struct {
+	accounts map[string]*Account
+}
+
+// NewRegistry 加载配置中的所有服务账号密钥
+func NewRegistry(cfgs []config.ServiceAccountConfig) (*Registry, error) {
+	registry := &Registry{accounts: make(map[string]*Account, len(cfgs))}
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("service account #%d has no name", i+1)
+		}
+		if _, exists := registry.accounts[cfg.Name]; exists {
+			return nil, fmt.Errorf("duplicate service account name %q", cfg.Name)
+		}
+
+		data := []byte(cfg.KeyJSON)
+		if cfg.KeyJSON == "" {
+			if cfg.KeyFile == "" {
+				return nil, fmt.Errorf("service account %q: key_file or key_json is required", cfg.Name)
+			}
+			var err error
+			data, err = os.ReadFile(cfg.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("service account %q: failed to read key file: %w", cfg.Name, err)
+			}
+		}
+
+		key, err := ParseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("service account %q: %w", cfg.Name, err)
+		}
+
+		account := &Account{Name: cfg.Name, Key: key, scopes: make(map[string]bool, len(cfg.Scopes))}
+		for _, scope := range cfg.Scopes {
+			account.scopes[scope] = true
+		}
+		for _, subject := range cfg.Subjects {
+			pattern := strings.ToLower(subject)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("service account %q: invalid subject pattern %q", cfg.Name, subject)
+			}
+			account.subjects = append(account.subjects, pattern)
+		}
+		registry.accounts[cfg.Name] = account
+	}
+	return registry, nil
+}
+
+// Get 按名称查找服务账号
+func (r *Registry) Get(name string) (*Account, bool) {
+	account, ok := r.accounts[name]
+	return account, ok
+}
+
+// Names 返回所有服务账号名称（已排序）
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.accounts))
+	for name := range r.accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
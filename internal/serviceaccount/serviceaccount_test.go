@@ -0,0 +1,168 @@
+package serviceaccount
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"gmail-oauth-proxy-server/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKey 生成测试用的服务账号JSON密钥
+func newTestKey(t *testing.T) ([]byte, *rsa.PrivateKey) {
+	t.Helper()
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "test-project",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "mailer@test-project.iam.gserviceaccount.com",
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	require.NoError(t, err)
+	return data, privateKey
+}
+
+func TestParseKey(t *testing.T) {
+	data, _ := newTestKey(t)
+
+	key, err := ParseKey(data)
+	require.NoError(t, err)
+	assert.Equal(t, "mailer@test-project.iam.gserviceaccount.com", key.ClientEmail)
+	assert.Equal(t, "key-1", key.PrivateKeyID)
+
+	_, err = ParseKey([]byte(`{"type":"authorized_user"}`))
+	assert.Error(t, err)
+
+	_, err = ParseKey([]byte(`{"type":"service_account","client_email":"a@b","private_key":"not pem"}`))
+	assert.Error(t, err)
+}
+
+func TestKey_SignAssertion(t *testing.T) {
+	data, privateKey := newTestKey(t)
+	key, err := ParseKey(data)
+	require.NoError(t, err)
+
+	now := time.Unix(1700000000, 0)
+	assertion, err := key.SignAssertion([]string{"https://mail.google.com/"}, "user@example.com", now)
+	require.NoError(t, err)
+
+	parts := strings.Split(assertion, ".")
+	require.Len(t, parts, 3)
+
+	// 验证签名
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	assert.NoError(t, rsa.VerifyPKCS1v15(&privateKey.PublicKey, crypto.SHA256, digest[:], signature))
+
+	// 验证声明
+	var header map[string]string
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	require.NoError(t, json.Unmarshal(headerJSON, &header))
+	assert.Equal(t, "RS256", header["alg"])
+	assert.Equal(t, "key-1", header["kid"])
+
+	var claims map[string]interface{}
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, json.Unmarshal(claimsJSON, &claims))
+	assert.Equal(t, "mailer@test-project.iam.gserviceaccount.com", claims["iss"])
+	assert.Equal(t, "user@example.com", claims["sub"])
+	assert.Equal(t, "https://mail.google.com/", claims["scope"])
+	assert.Equal(t, "https://oauth2.googleapis.com/token", claims["aud"])
+	assert.Equal(t, float64(now.Unix()), claims["iat"])
+	assert.Equal(t, float64(now.Add(time.Hour).Unix()), claims["exp"])
+
+	// 未指定subject时不包含sub声明
+	assertion, err = key.SignAssertion([]string{"https://mail.google.com/"}, "", now)
+	require.NoError(t, err)
+	claimsJSON, _ = base64.RawURLEncoding.DecodeString(strings.Split(assertion, ".")[1])
+	claims = nil
+	require.NoError(t, json.Unmarshal(claimsJSON, &claims))
+	assert.NotContains(t, claims, "sub")
+}
+
+func TestRegistry(t *testing.T) {
+	data, _ := newTestKey(t)
+	keyFile := filepath.Join(t.TempDir(), "sa.json")
+	require.NoError(t, os.WriteFile(keyFile, data, 0600))
+
+	registry, err := NewRegistry([]config.ServiceAccountConfig{
+		{
+			Name:     "archiver",
+			KeyFile:  keyFile,
+			Scopes:   []string{"https://www.googleapis.com/auth/gmail.readonly"},
+			Subjects: []string{"*@Example.com"},
+		},
+		{
+			Name:    "inline",
+			KeyJSON: string(data),
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"archiver", "inline"}, registry.Names())
+
+	archiver, ok := registry.Get("archiver")
+	require.True(t, ok)
+
+	t.Run("allowed scope and subject", func(t *testing.T) {
+		assert.NoError(t, archiver.Authorize([]string{"https://www.googleapis.com/auth/gmail.readonly"}, "Alice@example.com"))
+		assert.NoError(t, archiver.Authorize([]string{"https://www.googleapis.com/auth/gmail.readonly"}, ""))
+	})
+
+	t.Run("scope not allowed", func(t *testing.T) {
+		err := archiver.Authorize([]string{"https://mail.google.com/"}, "")
+		assert.True(t, errors.Is(err, ErrScopeNotAllowed))
+
+		err = archiver.Authorize(nil, "")
+		assert.True(t, errors.Is(err, ErrScopeNotAllowed))
+	})
+
+	t.Run("subject not allowed", func(t *testing.T) {
+		err := archiver.Authorize([]string{"https://www.googleapis.com/auth/gmail.readonly"}, "alice@other.com")
+		assert.True(t, errors.Is(err, ErrSubjectNotAllowed))
+	})
+
+	t.Run("delegation disabled without subjects", func(t *testing.T) {
+		inline, ok := registry.Get("inline")
+		require.True(t, ok)
+		assert.NoError(t, inline.Authorize([]string{"https://mail.google.com/"}, ""))
+		assert.True(t, errors.Is(inline.Authorize([]string{"https://mail.google.com/"}, "alice@example.com"), ErrSubjectNotAllowed))
+	})
+
+	t.Run("invalid configs", func(t *testing.T) {
+		_, err := NewRegistry([]config.ServiceAccountConfig{{KeyJSON: string(data)}})
+		assert.Error(t, err)
+
+		_, err = NewRegistry([]config.ServiceAccountConfig{{Name: "a", KeyJSON: string(data)}, {Name: "a", KeyJSON: string(data)}})
+		assert.Error(t, err)
+
+		_, err = NewRegistry([]config.ServiceAccountConfig{{Name: "a"}})
+		assert.Error(t, err)
+
+		_, err = NewRegistry([]config.ServiceAccountConfig{{Name: "a", KeyFile: filepath.Join(t.TempDir(), "missing.json")}})
+		assert.Error(t, err)
+
+		_, err = NewRegistry([]config.ServiceAccountConfig{{Name: "a", KeyJSON: string(data), Subjects: []string{"[bad"}}})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,96 @@
+package store
+
+import "gmail-oauth-proxy-server/internal/secret"
+
+// Encrypted 对值进行信封加密的存储包装器，键名和命名空间保持明文
+// 读取时兼容启用加密前写入的明文值，这些值在下次写入或执行 config rekey 时加密
+type Encrypted struct {
+	Store
+	keyring *secret.Keyring
+}
+
+// NewEncrypted 使用主密钥包装存储
+func NewEncrypted(st Store, keyring *secret.Keyring) *Encrypted {
+	return &Encrypted{Store: st, keyring: keyring}
+}
+
+// Get 读取并解密值
+func (e *Encrypted) Get(bucket, key string) ([]byte, error) {
+	value, err := e.Store.Get(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return e.keyring.Open(value)
+}
+
+// Put 加密并写入值
+func (e *Encrypted) Put(bucket, key string, value []byte) error {
+	sealed, err := e.keyring.Seal(value)
+	if err != nil {
+		return err
+	}
+	return e.Store.Put(bucket, key, sealed)
+}
+
+// List 返回解密后的所有键值对
+func (e *Encrypted) List(bucket string) (map[string][]byte, error) {
+	values, err := e.Store.List(bucket)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		if values[key], err = e.keyring.Open(value); err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// Update 解密后执行回调，再加密写入
+func (e *Encrypted) Update(bucket, key string, fn UpdateFunc) error {
+	return e.Store.Update(bucket, key, func(value []byte, exists bool) ([]byte, error) {
+		if exists {
+			plaintext, err := e.keyring.Open(value)
+			if err != nil {
+				return nil, err
+			}
+			value = plaintext
+		}
+		updated, err := fn(value, exists)
+		if err != nil || updated == nil {
+			return updated, err
+		}
+		return e.keyring.Seal(updated)
+	})
+}
+
+// Rekey 使用新的主密钥重新包装存储中的所有值，from为当前主密钥，to为nil时解密为明文
+// 只重新包装数据密钥，数据本身不重新加密；已由新主密钥保护的值会被跳过，中断后可重新执行
+// 返回重新包装的条目数
+func Rekey(st Store, from, to *secret.Keyring) (int, error) {
+	buckets, err := st.Buckets()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, bucket := range buckets {
+		values, err := st.List(bucket)
+		if err != nil {
+			return count, err
+		}
+		for key := range values {
+			err := st.Update(bucket, key, func(value []byte, exists bool) ([]byte, error) {
+				if !exists || to.Owns(value) {
+					return value, nil
+				}
+				count++
+				return from.Rewrap(value, to)
+			})
+			if err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File 本地JSON文件存储
+// 数据缓存在内存中，每次写入后整体落盘（先写临时文件再重命名）。每次读写前检查文件是否被其他进程修改，
+// 因此运行中的服务器和 keys 等命令行工具可以共用同一文件；多个代理实例不应同时写入同一文件
+type File struct {
+	*Memory
+	path string
+
+	modTime time.Time // 最近一次加载或写入时文件的修改时间，零值表示文件尚不存在
+	size    int64
+}
+
+// OpenFile 打开文件存储，文件不存在时在首次写入时创建
+func OpenFile(path string) (*File, error) {
+	f := &File{Memory: NewMemory(), path: path}
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Path 返回存储文件路径
+func (f *File) Path() string {
+	return f.path
+}
+
+// Get 读取值
+func (f *File) Get(bucket, key string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	return f.get(bucket, key)
+}
+
+// Put 写入值并落盘
+func (f *File) Put(bucket, key string, value []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	f.set(bucket, key, value)
+	return f.save()
+}
+
+// Delete 删除键并落盘
+func (f *File) Delete(bucket, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	if err := f.delete(bucket, key); err != nil {
+		return err
+	}
+	return f.save()
+}
+
+// List 返回命名空间中的所有键值对
+func (f *File) List(bucket string) (map[string][]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	return f.list(bucket), nil
+}
+
+// Update 原子地读取并修改一个键，数据发生变化时落盘
+func (f *File) Update(bucket, key string, fn UpdateFunc) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return err
+	}
+	changed, err := f.apply(bucket, key, fn)
+	if err != nil || !changed {
+		return err
+	}
+	return f.save()
+}
+
+// Buckets 返回所有非空命名空间
+func (f *File) Buckets() ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.refresh(); err != nil {
+		return nil, err
+	}
+	return f.names(), nil
+}
+
+// refresh 文件被其他进程修改（或删除）后重新加载（调用方需持有f.mu）
+func (f *File) refresh() error {
+	info, err := os.Stat(f.path)
+	if os.IsNotExist(err) {
+		if !f.modTime.IsZero() {
+			f.buckets = make(map[string]map[string][]byte)
+			f.modTime, f.size = time.Time{}, 0
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read store file: %w", err)
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to read store file: %w", err)
+	}
+	buckets := make(map[string]map[string][]byte)
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return fmt.Errorf("failed to parse store file %s: %w", f.path, err)
+	}
+	if buckets == nil {
+		buckets = make(map[string]map[string][]byte)
+	}
+	f.buckets = buckets
+	f.modTime, f.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// save 将所有数据写入文件（调用方需持有f.mu）
+func (f *File) save() error {
+	data, err := json.MarshalIndent(f.buckets, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	// 先写临时文件再重命名，避免写入中断导致数据损坏
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	if info, err := os.Stat(f.path); err == nil {
+		f.modTime, f.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// Memory 内存存储
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemory 创建内存存储
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]map[string][]byte)}
+}
+
+// Get 读取值
+func (m *Memory) Get(bucket, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.get(bucket, key)
+}
+
+// Put 写入值
+func (m *Memory) Put(bucket, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.set(bucket, key, value)
+	return nil
+}
+
+// Delete 删除键
+func (m *Memory) Delete(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.delete(bucket, key)
+}
+
+// List 返回命名空间中的所有键值对
+func (m *Memory) List(bucket string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.list(bucket), nil
+}
+
+// Update 原子地读取并修改一个键
+func (m *Memory) Update(bucket, key string, fn UpdateFunc) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.apply(bucket, key, fn)
+	return err
+}
+
+// Buckets 返回所有非空命名空间
+func (m *Memory) Buckets() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.names(), nil
+}
+
+// Close 内存存储无需释放资源
+func (m *Memory) Close() error {
+	return nil
+}
+
+// get 读取值（调用方需持有m.mu）
+func (m *Memory) get(bucket, key string) ([]byte, error) {
+	value, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(value), nil
+}
+
+// delete 删除键（调用方需持有m.mu）
+func (m *Memory) delete(bucket, key string) error {
+	if _, ok := m.buckets[bucket][key]; !ok {
+		return ErrNotFound
+	}
+	delete(m.buckets[bucket], key)
+	return nil
+}
+
+// list 复制命名空间中的所有键值对（调用方需持有m.mu）
+func (m *Memory) list(bucket string) map[string][]byte {
+	values := make(map[string][]byte, len(m.buckets[bucket]))
+	for key, value := range m.buckets[bucket] {
+		values[key] = clone(value)
+	}
+	return values
+}
+
+// names 返回所有非空命名空间（调用方需持有m.mu）
+func (m *Memory) names() []string {
+	buckets := make([]string, 0, len(m.buckets))
+	for bucket, values := range m.buckets {
+		if len(values) > 0 {
+			buckets = append(buckets, bucket)
+		}
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+// set 写入值（调用方需持有m.mu）
+func (m *Memory) set(bucket, key string, value []byte) {
+	values, ok := m.buckets[bucket]
+	if !ok {
+		values = make(map[string][]byte)
+		m.buckets[bucket] = values
+	}
+	values[key] = clone(value)
+}
+
+// apply 执行读取-修改-写入回调，返回数据是否发生变化（调用方需持有m.mu）
+func (m *Memory) apply(bucket, key string, fn UpdateFunc) (bool, error) {
+	current, exists := m.buckets[bucket][key]
+	value, err := fn(clone(current), exists)
+	if err != nil {
+		return false, err
+	}
+	if value == nil {
+		if !exists {
+			return false, nil
+		}
+		delete(m.buckets[bucket], key)
+		return true, nil
+	}
+	m.set(bucket, key, value)
+	return true, nil
+}
+
+// clone 复制字节切片，避免调用方修改存储内部数据
+func clone(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	return append([]byte{}, value...)
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/secret"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotFound 存储中不存在对应的键
+var ErrNotFound = errors.New("key not found in store")
+
+// 存储后端类型
+const (
+	BackendFile   = "file"   // 本地JSON文件，适合单实例部署
+	BackendMemory = "memory" // 仅保存在内存中，进程退出后丢失（用于测试）
+)
+
+// 代理状态使用的命名空间
+const (
+	BucketKeys      = "keys"       // API Key元数据和加盐哈希（包括自动生成的默认API Key）
+	BucketGrants    = "grants"     // 刷新令牌保险库中的授权凭据
+	BucketBans      = "bans"       // 认证失败记录和封禁
+	BucketRateLimit = "rate_limit" // 限流令牌桶快照
+	BucketAudit     = "audit"      // 审计记录
+)
+
+// UpdateFunc 读取-修改-写入回调，exists为false时value为nil
+// 返回nil值表示删除该键，返回错误时放弃本次修改
+type UpdateFunc func(value []byte, exists bool) ([]byte, error)
+
+// Store 代理状态存储接口，按命名空间（bucket）组织键值对，所有实现均需并发安全
+type Store interface {
+	// Get 读取值，不存在时返回 ErrNotFound
+	Get(bucket, key string) ([]byte, error)
+	// Put 写入值，已存在时覆盖
+	Put(bucket, key string, value []byte) error
+	// Delete 删除键，不存在时返回 ErrNotFound
+	Delete(bucket, key string) error
+	// List 返回命名空间中的所有键值对
+	List(bucket string) (map[string][]byte, error)
+	// Update 原子地读取并修改一个键，适用于计数器等需要避免并发覆盖的场景
+	Update(bucket, key string, fn UpdateFunc) error
+	// Buckets 返回所有非空命名空间（已排序）
+	Buckets() ([]string, error)
+	// Close 释放存储资源
+	Close() error
+}
+
+// DefaultPath 返回默认的状态文件路径
+func DefaultPath() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".gmail-oauth-proxy", "state.json"), nil
+}
+
+// Open 打开存储：backend为空时使用文件存储（与配置默认值一致），path为空时使用默认路径
+// keyring不为nil时存储的值使用信封加密
+func Open(backend, path string, keyring *secret.Keyring) (Store, error) {
+	st, err := OpenRaw(backend, path)
+	if err != nil || !keyring.Enabled() {
+		return st, err
+	}
+	return NewEncrypted(st, keyring), nil
+}
+
+// OpenRaw 打开存储，不进行加解密（用于 config rekey）
+func OpenRaw(backend, path string) (Store, error) {
+	switch backend {
+	case BackendFile, "":
+		if path == "" {
+			var err error
+			if path, err = DefaultPath(); err != nil {
+				return nil, err
+			}
+		}
+		f, err := OpenFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	case BackendMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s (supported: %s, %s)", backend, BackendFile, BackendMemory)
+	}
+}
+
+// IsEncrypted 判断存储是否对值进行信封加密
+func IsEncrypted(st Store) bool {
+	_, ok := st.(*Encrypted)
+	return ok
+}
+
+// FilePath 返回文件存储的路径，非文件存储返回false
+func FilePath(st Store) (string, bool) {
+	if e, ok := st.(*Encrypted); ok {
+		st = e.Store
+	}
+	if f, ok := st.(*File); ok {
+		return f.Path(), true
+	}
+	return "", false
+}
+
+// ValidateBackend 验证存储后端类型
+func ValidateBackend(backend string) error {
+	switch backend {
+	case BackendFile, BackendMemory, "":
+		return nil
+	default:
+		return fmt.Errorf("unsupported storage backend: %s (supported: %s, %s)", backend, BackendFile, BackendMemory)
+	}
+}
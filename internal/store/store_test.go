@@ -0,0 +1,247 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/secret"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 测试使用的命名空间
+const (
+	testBucket    = "test"
+	otherBucket   = "other"
+	counterBucket = "counter"
+)
+
+// testStore 对Store实现执行通用的行为测试
+func testStore(t *testing.T, st Store) {
+	t.Run("get put delete", func(t *testing.T) {
+		_, err := st.Get(testBucket, "missing")
+		assert.True(t, errors.Is(err, ErrNotFound))
+
+		require.NoError(t, st.Put(testBucket, "a", []byte("value-a")))
+		value, err := st.Get(testBucket, "a")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value-a"), value)
+
+		// 修改返回的切片不影响存储内容
+		value[0] = 'X'
+		value, err = st.Get(testBucket, "a")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value-a"), value)
+
+		// 命名空间相互隔离
+		_, err = st.Get(otherBucket, "a")
+		assert.True(t, errors.Is(err, ErrNotFound))
+
+		require.NoError(t, st.Delete(testBucket, "a"))
+		assert.True(t, errors.Is(st.Delete(testBucket, "a"), ErrNotFound))
+	})
+
+	t.Run("list", func(t *testing.T) {
+		require.NoError(t, st.Put(BucketGrants, "x", []byte("1")))
+		require.NoError(t, st.Put(BucketGrants, "y", []byte("2")))
+
+		values, err := st.List(BucketGrants)
+		require.NoError(t, err)
+		assert.Equal(t, map[string][]byte{"x": []byte("1"), "y": []byte("2")}, values)
+
+		values, err = st.List("empty")
+		require.NoError(t, err)
+		assert.Empty(t, values)
+	})
+
+	t.Run("concurrent update", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := st.Update(counterBucket, "counter", func(value []byte, exists bool) ([]byte, error) {
+					n := 0
+					if exists {
+						n, _ = strconv.Atoi(string(value))
+					}
+					return []byte(strconv.Itoa(n + 1)), nil
+				})
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		value, err := st.Get(counterBucket, "counter")
+		require.NoError(t, err)
+		assert.Equal(t, "50", string(value))
+	})
+
+	t.Run("update delete and abort", func(t *testing.T) {
+		require.NoError(t, st.Put(counterBucket, "tmp", []byte("1")))
+
+		err := st.Update(counterBucket, "tmp", func(value []byte, exists bool) ([]byte, error) {
+			return nil, fmt.Errorf("abort")
+		})
+		assert.Error(t, err)
+		_, err = st.Get(counterBucket, "tmp")
+		assert.NoError(t, err)
+
+		require.NoError(t, st.Update(counterBucket, "tmp", func(value []byte, exists bool) ([]byte, error) {
+			return nil, nil
+		}))
+		_, err = st.Get(counterBucket, "tmp")
+		assert.True(t, errors.Is(err, ErrNotFound))
+	})
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestEncrypted(t *testing.T) {
+	keyring := newTestKeyring(t)
+	raw := NewMemory()
+	testStore(t, NewEncrypted(raw, keyring))
+
+	// 底层存储只保存密文
+	value, err := raw.Get(BucketGrants, "x")
+	require.NoError(t, err)
+	assert.True(t, secret.IsSealed(value))
+
+	// 兼容启用加密前写入的明文
+	require.NoError(t, raw.Put(testBucket, "legacy", []byte("plain")))
+	value, err = NewEncrypted(raw, keyring).Get(testBucket, "legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(value))
+
+	// 错误的主密钥无法读取
+	_, err = NewEncrypted(raw, newTestKeyring(t)).Get(BucketGrants, "x")
+	assert.True(t, errors.Is(err, secret.ErrWrongKey))
+}
+
+func TestRekey(t *testing.T) {
+	oldKey, newKey := newTestKeyring(t), newTestKeyring(t)
+	raw := NewMemory()
+	require.NoError(t, NewEncrypted(raw, oldKey).Put(BucketGrants, "sealed", []byte("secret-1")))
+	require.NoError(t, raw.Put(testBucket, "legacy", []byte("secret-2")))
+
+	count, err := Rekey(raw, oldKey, newKey)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	for bucket, key := range map[string]string{BucketGrants: "sealed", testBucket: "legacy"} {
+		_, err := NewEncrypted(raw, oldKey).Get(bucket, key)
+		assert.Error(t, err)
+		value, err := NewEncrypted(raw, newKey).Get(bucket, key)
+		require.NoError(t, err)
+		assert.Contains(t, string(value), "secret-")
+	}
+
+	// 重复执行时跳过已由新主密钥保护的值
+	count, err = Rekey(raw, oldKey, newKey)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// 解密为明文
+	_, err = Rekey(raw, newKey, nil)
+	require.NoError(t, err)
+	value, err := raw.Get(BucketGrants, "sealed")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-1", string(value))
+}
+
+// newTestKeyring 生成测试用的随机主密钥
+func newTestKeyring(t *testing.T) *secret.Keyring {
+	t.Helper()
+	key, err := secret.GenerateKey()
+	require.NoError(t, err)
+	keyring, err := secret.LoadKeyring(secret.Source{Key: key})
+	require.NoError(t, err)
+	return keyring
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+	st, err := OpenFile(path)
+	require.NoError(t, err)
+	testStore(t, st)
+
+	// 文件权限为600，重新打开后数据仍在
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	reopened, err := OpenFile(path)
+	require.NoError(t, err)
+	value, err := reopened.Get(counterBucket, "counter")
+	require.NoError(t, err)
+	assert.Equal(t, "50", string(value))
+	values, err := reopened.List(BucketGrants)
+	require.NoError(t, err)
+	assert.Len(t, values, 2)
+
+	// 损坏的文件返回错误
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0600))
+	_, err = OpenFile(path)
+	assert.Error(t, err)
+}
+
+func TestFile_SharedBetweenProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	server, err := OpenFile(path)
+	require.NoError(t, err)
+	require.NoError(t, server.Put(BucketGrants, "a", []byte("1")))
+
+	// 另一个进程（如 keys 命令）写入后，已打开的存储重新加载
+	cli, err := OpenFile(path)
+	require.NoError(t, err)
+	require.NoError(t, cli.Put(testBucket, "key", []byte("created")))
+	value, err := server.Get(testBucket, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "created", string(value))
+
+	// 写入前先重新加载，不会覆盖其他进程的修改
+	require.NoError(t, server.Put(BucketGrants, "b", []byte("2")))
+	values, err := cli.List(testBucket)
+	require.NoError(t, err)
+	assert.Len(t, values, 1)
+	values, err = cli.List(BucketGrants)
+	require.NoError(t, err)
+	assert.Len(t, values, 2)
+
+	// 文件被删除后视为空存储
+	require.NoError(t, os.Remove(path))
+	buckets, err := server.Buckets()
+	require.NoError(t, err)
+	assert.Empty(t, buckets)
+}
+
+func TestOpen(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	st, err := Open("", "", nil)
+	require.NoError(t, err)
+	assert.IsType(t, &File{}, st)
+	st.Close()
+
+	st, err = Open(BackendMemory, "", nil)
+	require.NoError(t, err)
+	assert.IsType(t, &Memory{}, st)
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err = Open(BackendFile, path, nil)
+	require.NoError(t, err)
+	assert.IsType(t, &File{}, st)
+	got, ok := FilePath(st)
+	assert.True(t, ok)
+	assert.Equal(t, path, got)
+
+	_, err = Open("redis", "", nil)
+	assert.Error(t, err)
+	assert.Error(t, ValidateBackend("redis"))
+}
@@ -0,0 +1,316 @@
+package tlsreload
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay 文件变化后等待的时间，合并证书和私钥先后写入产生的多个事件
+const reloadDelay = 200 * time.Millisecond
+
+// Reloader 持有当前的服务端证书，证书文件变化、收到SIGHUP或调用Reload时重新加载
+// 重新加载失败时继续使用之前的证书，不影响正在提供的服务
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+
+	watcher *fsnotify.Watcher
+	signals chan os.Signal
+	done    chan struct{}
+}
+
+// NewReloader 加载证书和私钥，文件无效时返回错误
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: filepath.Clean(certFile), keyFile: filepath.Clean(keyFile)}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新加载证书和私钥
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load TLS certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("parse TLS certificate: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
+
+// Certificate 返回当前证书
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate 用于 tls.Config.GetCertificate，每次握手使用最新加载的证书
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// Watch 在后台监听SIGHUP和证书、私钥所在目录，收到信号或文件变化时自动重新加载
+// 监听目录而不是文件本身，以支持原子替换（rename）和Kubernetes Secret的符号链接切换；
+// 无法监听目录时只记录警告，仍然可以通过SIGHUP重新加载
+func (r *Reloader) Watch() {
+	if r.done != nil {
+		return
+	}
+	r.done = make(chan struct{})
+	r.signals = make(chan os.Signal, 1)
+	signal.Notify(r.signals, syscall.SIGHUP)
+
+	watcher, err := r.newWatcher()
+	if err != nil {
+		logger.Warn("TLS certificate file watching disabled, send SIGHUP to reload: %v", err)
+	}
+	r.watcher = watcher
+	go r.watch()
+}
+
+// Close 停止监听
+func (r *Reloader) Close() error {
+	if r.done == nil {
+		return nil
+	}
+	signal.Stop(r.signals)
+	close(r.done)
+	if r.watcher != nil {
+		return r.watcher.Close()
+	}
+	return nil
+}
+
+// newWatcher 创建监听证书和私钥所在目录的watcher
+func (r *Reloader) newWatcher() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range uniqueDirs(r.certFile, r.keyFile) {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("watch %s: %w", dir, err)
+		}
+	}
+	return watcher, nil
+}
+
+// watch 处理信号和文件变化事件，未能创建watcher时只处理信号
+func (r *Reloader) watch() {
+	var events chan fsnotify.Event
+	var errors chan error
+	if r.watcher != nil {
+		events, errors = r.watcher.Events, r.watcher.Errors
+	}
+
+	var timer *time.Timer
+	for {
+		select {
+		case <-r.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-r.signals:
+			logger.Info("Received SIGHUP, reloading TLS certificate")
+			r.reloadAndLog()
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if !r.relevant(event) {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(reloadDelay, r.reloadAndLog)
+			} else {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-errors:
+			if !ok {
+				errors = nil
+				continue
+			}
+			logger.Warn("TLS certificate watcher error: %v", err)
+		}
+	}
+}
+
+// relevant 判断事件是否可能改变证书或私钥（包括Kubernetes挂载目录中的 ..data 切换）
+func (r *Reloader) relevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(event.Name)
+	return name == r.certFile || name == r.keyFile || strings.HasPrefix(filepath.Base(name), "..")
+}
+
+// reloadAndLog 重新加载证书并记录结果
+func (r *Reloader) reloadAndLog() {
+	if err := r.Reload(); err != nil {
+		logger.Error("Failed to reload TLS certificate, keeping the previous one: %v", err)
+		return
+	}
+	leaf := r.Certificate().Leaf
+	logger.Info("Reloaded TLS certificate: subject=%s, expires=%s", leaf.Subject, leaf.NotAfter.Format(time.RFC3339))
+}
+
+// uniqueDirs 返回文件所在的目录（去重）
+func uniqueDirs(files ...string) []string {
+	var dirs []string
+	seen := map[string]bool{}
+	for _, file := range files {
+		dir := filepath.Dir(file)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// ParseVersion 解析最低TLS版本（1.2 或 1.3），为空时返回 TLS 1.2
+func ParseVersion(version string) (uint16, error) {
+	switch strings.TrimSpace(version) {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q: must be 1.2 or 1.3", version)
+}
+
+// ParseCipherSuites 按Go名称解析TLS 1.2密码套件（如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256）
+// 只允许 crypto/tls 认为安全的套件；TLS 1.3的套件不可配置
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	available := map[string]*tls.CipherSuite{}
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		suite, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite %q", name)
+		}
+		if !supportsTLS12(suite) {
+			return nil, fmt.Errorf("cipher suite %q is TLS 1.3 only and cannot be configured", name)
+		}
+		ids = append(ids, suite.ID)
+	}
+	return ids, nil
+}
+
+// supportsTLS12 判断密码套件是否可用于TLS 1.2
+func supportsTLS12(suite *tls.CipherSuite) bool {
+	for _, version := range suite.SupportedVersions {
+		if version == tls.VersionTLS12 {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateConfig 验证TLS配置（不加载证书文件）
+func ValidateConfig(cfg config.TLSConfig) error {
+	if !cfg.Enabled() {
+		if cfg.ClientCAFile != "" || len(cfg.ClientCerts) > 0 {
+			return fmt.Errorf("client certificate authentication requires cert_file and key_file")
+		}
+		return nil
+	}
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return fmt.Errorf("cert_file and key_file must both be set")
+	}
+	if _, err := ParseVersion(cfg.MinVersion); err != nil {
+		return err
+	}
+	if _, err := ParseCipherSuites(cfg.CipherSuites); err != nil {
+		return err
+	}
+	if len(cfg.ClientCerts) > 0 && cfg.ClientCAFile == "" {
+		return fmt.Errorf("client_certs requires client_ca_file")
+	}
+	names := map[string]bool{}
+	for _, clientCert := range cfg.ClientCerts {
+		if err := clientCert.Validate(); err != nil {
+			return err
+		}
+		if names[clientCert.Name] {
+			return fmt.Errorf("duplicate client cert name %q", clientCert.Name)
+		}
+		names[clientCert.Name] = true
+	}
+	return nil
+}
+
+// LoadClientCAs 加载校验客户端证书的CA
+func LoadClientCAs(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in client CA %s", caFile)
+	}
+	return pool, nil
+}
+
+// ServerConfig 根据配置创建服务端 tls.Config，证书由reloader提供
+// 配置 client_ca_file 时校验客户端提供的证书；未提供证书的客户端仍可以使用其他鉴权方式
+func ServerConfig(cfg config.TLSConfig, reloader *Reloader) (*tls.Config, error) {
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, err
+	}
+	minVersion, _ := ParseVersion(cfg.MinVersion)
+	cipherSuites, _ := ParseCipherSuites(cfg.CipherSuites)
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.ClientCAFile != "" {
+		pool, err := LoadClientCAs(cfg.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
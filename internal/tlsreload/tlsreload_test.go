@@ -0,0 +1,325 @@
+package tlsreload
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/logger"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	logger.Init("error")
+}
+
+// writeCert 生成自签名证书并写入 dir/cert.pem 和 dir/key.pem
+func writeCert(t *testing.T, dir, commonName string) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func commonName(r *Reloader) string {
+	return r.Certificate().Leaf.Subject.CommonName
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+
+	reloader, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(reloader))
+
+	writeCert(t, dir, "second")
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, "second", commonName(reloader))
+
+	cert, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Same(t, reloader.Certificate(), cert)
+
+	// 写入无效证书时保留之前的证书
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0600))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "second", commonName(reloader))
+}
+
+func TestNewReloader_InvalidFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewReloader(filepath.Join(dir, "missing.pem"), filepath.Join(dir, "missing-key.pem"))
+	assert.Error(t, err)
+}
+
+func TestReloader_WatchFileChange(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "first")
+
+	reloader, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+	reloader.Watch()
+	defer reloader.Close()
+
+	writeCert(t, dir, "rotated")
+	require.Eventually(t, func() bool {
+		return commonName(reloader) == "rotated"
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{"", tls.VersionTLS12, false},
+		{"1.2", tls.VersionTLS12, false},
+		{"1.3", tls.VersionTLS13, false},
+		{"1.1", 0, true},
+		{"tls13", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.version)
+		if tt.wantErr {
+			assert.Error(t, err, tt.version)
+			continue
+		}
+		require.NoError(t, err, tt.version)
+		assert.Equal(t, tt.want, got, tt.version)
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites(nil)
+	require.NoError(t, err)
+	assert.Nil(t, ids)
+
+	ids, err = ParseCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 "})
+	require.NoError(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}, ids)
+
+	_, err = ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+	assert.Error(t, err, "insecure suites are rejected")
+	_, err = ParseCipherSuites([]string{"TLS_AES_128_GCM_SHA256"})
+	assert.Error(t, err, "TLS 1.3 suites are not configurable")
+	_, err = ParseCipherSuites([]string{"NOT_A_SUITE"})
+	assert.Error(t, err)
+}
+
+func TestValidateConfig(t *testing.T) {
+	assert.NoError(t, ValidateConfig(config.TLSConfig{}))
+	assert.NoError(t, ValidateConfig(config.TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.3"}))
+	assert.Error(t, ValidateConfig(config.TLSConfig{CertFile: "cert.pem"}))
+	assert.Error(t, ValidateConfig(config.TLSConfig{KeyFile: "key.pem"}))
+	assert.Error(t, ValidateConfig(config.TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.0"}))
+	assert.Error(t, ValidateConfig(config.TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", CipherSuites: []string{"bogus"}}))
+}
+
+func TestServerConfig_Handshake(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "localhost")
+	reloader, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+
+	tlsConfig, err := ServerConfig(config.TLSConfig{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"}, reloader)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	dial := func(maxVersion uint16) (*tls.Conn, error) {
+		dialer := &net.Dialer{Timeout: 5 * time.Second}
+		return tls.DialWithDialer(dialer, "tcp", listener.Addr().String(), &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         maxVersion,
+		})
+	}
+
+	conn, err := dial(tls.VersionTLS13)
+	require.NoError(t, err)
+	state := conn.ConnectionState()
+	conn.Close()
+	assert.Equal(t, uint16(tls.VersionTLS13), state.Version)
+	assert.Equal(t, "localhost", state.PeerCertificates[0].Subject.CommonName)
+
+	// 低于最低版本的客户端握手失败
+	_, err = dial(tls.VersionTLS12)
+	assert.Error(t, err)
+}
+
+// newCA 生成测试CA并写入 dir/ca.pem
+func newCA(t *testing.T, dir, commonName string) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(dir, commonName+".pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	return ca, key, caFile
+}
+
+// issueClientCert 使用CA签发客户端证书
+func issueClientCert(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, commonName string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestValidateConfig_ClientCerts(t *testing.T) {
+	clientCerts := []config.ClientCertConfig{{Name: "mailer", Subject: "mailer"}}
+	base := config.TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "ca.pem"}
+
+	valid := base
+	valid.ClientCerts = clientCerts
+	assert.NoError(t, ValidateConfig(valid))
+
+	assert.Error(t, ValidateConfig(config.TLSConfig{ClientCAFile: "ca.pem"}), "mTLS requires native TLS")
+	assert.Error(t, ValidateConfig(config.TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientCerts: clientCerts}), "client_certs requires client_ca_file")
+
+	duplicate := base
+	duplicate.ClientCerts = append(clientCerts, config.ClientCertConfig{Name: "mailer", SAN: "mailer.mail.svc"})
+	assert.Error(t, ValidateConfig(duplicate))
+
+	invalid := base
+	invalid.ClientCerts = []config.ClientCertConfig{{Name: "mailer"}}
+	assert.Error(t, ValidateConfig(invalid))
+}
+
+func TestServerConfig_ClientCA(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "localhost")
+	reloader, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+	ca, caKey, caFile := newCA(t, dir, "mesh-ca")
+	otherCA, otherKey, _ := newCA(t, dir, "other-ca")
+
+	_, err = ServerConfig(config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile + ".missing"}, reloader)
+	assert.Error(t, err)
+
+	tlsConfig, err := ServerConfig(config.TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile}, reloader)
+	require.NoError(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) == 0 {
+			w.Write([]byte("none"))
+			return
+		}
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// 客户端总是提供给定的证书，不按服务端声明的CA筛选
+	get := func(certificate *tls.Certificate) (string, error) {
+		client := &http.Client{Timeout: 5 * time.Second, Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				InsecureSkipVerify: true,
+				GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+					if certificate == nil {
+						return &tls.Certificate{}, nil
+					}
+					return certificate, nil
+				},
+			},
+		}}
+		defer client.CloseIdleConnections()
+		resp, err := client.Get("https://" + listener.Addr().String() + "/")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	trusted := issueClientCert(t, ca, caKey, "sender")
+	body, err := get(&trusted)
+	require.NoError(t, err)
+	assert.Equal(t, "sender", body)
+
+	// 未提供证书的客户端仍可以连接，由其他鉴权方式决定
+	body, err = get(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "none", body)
+
+	// 其他CA签发的证书在握手时被拒绝
+	untrusted := issueClientCert(t, otherCA, otherKey, "sender")
+	_, err = get(&untrusted)
+	assert.Error(t, err)
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/config"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName 代理创建span使用的Tracer名称
+const TracerName = "gmail-oauth-proxy-server"
+
+// 代理记录的span属性，只记录标识信息，不记录密钥、授权码、令牌和API Key
+const (
+	AttrClientID    = attribute.Key("oauth.client_id")
+	AttrGrantType   = attribute.Key("oauth.grant_type")
+	AttrUpstream    = attribute.Key("oauth.upstream")
+	AttrAuthOutcome = attribute.Key("oauth_proxy.auth")
+	AttrKeyName     = attribute.Key("oauth_proxy.key_name")
+	AttrMethod      = attribute.Key("http.request.method")
+	AttrRoute       = attribute.Key("http.route")
+	AttrStatusCode  = attribute.Key("http.response.status_code")
+	AttrClientIP    = attribute.Key("client.address")
+	AttrServerHost  = attribute.Key("server.address")
+	AttrURL         = attribute.Key("url.full") // 不含查询参数，避免记录 tokeninfo?access_token= 等令牌
+	AttrErrorType   = attribute.Key("error.type")
+	AttrServiceName = attribute.Key("service.name")
+	AttrServiceVer  = attribute.Key("service.version")
+)
+
+// ValidateConfig 验证追踪配置
+func ValidateConfig(cfg config.TracingConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("invalid endpoint %q: must be an http(s) URL such as http://localhost:4318/v1/traces", cfg.Endpoint)
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return fmt.Errorf("sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
+// Setup 初始化全局TracerProvider和W3C Trace Context传播器，span以OTLP/HTTP导出到cfg.Endpoint，返回刷新并关闭导出器的函数
+// 未启用追踪时不做任何设置，span均为空操作
+func Setup(cfg config.TracingConfig, version string) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(cfg.Endpoint),
+		otlptracehttp.WithHeaders(cfg.Headers),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+
+	res := resource.NewSchemaless(AttrServiceName.String(cfg.ServiceName), AttrServiceVer.String(version))
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Tracer 返回代理使用的Tracer（每次从全局TracerProvider获取，便于测试替换）
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
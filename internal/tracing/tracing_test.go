@@ -0,0 +1,82 @@
+package tracing_test
+
+import (
+	"context"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/tracing"
+	"gmail-oauth-proxy-server/internal/tracing/tracingtest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestValidateConfig(t *testing.T) {
+	assert.NoError(t, tracing.ValidateConfig(config.TracingConfig{Endpoint: "not a url"}))
+
+	cfg := config.TracingConfig{Enabled: true, Endpoint: "http://localhost:4318/v1/traces", SampleRatio: 1}
+	assert.NoError(t, tracing.ValidateConfig(cfg))
+
+	cfg.Endpoint = "localhost:4318"
+	assert.Error(t, tracing.ValidateConfig(cfg))
+
+	cfg.Endpoint = "https://otel.example.com/v1/traces"
+	cfg.SampleRatio = 1.5
+	assert.Error(t, tracing.ValidateConfig(cfg))
+}
+
+func TestSetup_ExportsToCollector(t *testing.T) {
+	collector := tracingtest.NewCollector(t)
+	shutdown, err := tracing.Setup(config.TracingConfig{
+		Enabled:     true,
+		Endpoint:    collector.Endpoint(),
+		ServiceName: "proxy-test",
+		SampleRatio: 1,
+	}, "1.2.3")
+	require.NoError(t, err)
+
+	ctx, parent := tracing.Tracer().Start(context.Background(), "parent", trace.WithSpanKind(trace.SpanKindServer))
+	_, child := tracing.Tracer().Start(ctx, "child", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			tracing.AttrStatusCode.Int(400),
+			attribute.Bool("retry", false),
+			attribute.StringSlice("scopes", []string{"openid", "email"}),
+		))
+	child.SetStatus(codes.Error, "bad request")
+	child.End()
+	parent.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	spans := collector.Spans()
+	require.Len(t, spans, 2)
+
+	childSpan, ok := collector.Find("child")
+	require.True(t, ok)
+	parentSpan, ok := collector.Find("parent")
+	require.True(t, ok)
+
+	assert.Equal(t, parentSpan.TraceID, childSpan.TraceID)
+	assert.Equal(t, parentSpan.SpanID, childSpan.ParentSpanID)
+	assert.Empty(t, parentSpan.ParentSpanID)
+	assert.Len(t, childSpan.TraceID, 32)
+	assert.Equal(t, int(trace.SpanKindServer), parentSpan.Kind)
+	assert.Equal(t, int(trace.SpanKindClient), childSpan.Kind)
+	assert.Equal(t, 2, childSpan.StatusCode)
+	assert.Equal(t, "400", childSpan.Attributes["http.response.status_code"])
+	assert.Equal(t, "false", childSpan.Attributes["retry"])
+	assert.Equal(t, "[openid email]", childSpan.Attributes["scopes"])
+	assert.Equal(t, "proxy-test", childSpan.Resource["service.name"])
+	assert.Equal(t, "1.2.3", childSpan.Resource["service.version"])
+}
+
+func TestSetup_Disabled(t *testing.T) {
+	shutdown, err := tracing.Setup(config.TracingConfig{Endpoint: "invalid"}, "1.0.0")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Setup(config.TracingConfig{Enabled: true, Endpoint: "invalid"}, "1.0.0")
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+// Package tracingtest 提供接收OTLP/HTTP（protobuf编码）的本地收集器，用于在测试中校验导出的span
+package tracingtest
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Span 收集器收到的span，属性值统一为文本形式
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         int
+	StatusCode   int // 0=UNSET 1=OK 2=ERROR
+	Attributes   map[string]string
+	Resource     map[string]string
+}
+
+// Collector 本地OTLP/HTTP收集器
+type Collector struct {
+	server *httptest.Server
+
+	mu    sync.Mutex
+	spans []Span
+}
+
+// NewCollector 启动本地收集器，测试结束时自动关闭
+func NewCollector(t testing.TB) *Collector {
+	t.Helper()
+
+	collector := &Collector{}
+	collector.server = httptest.NewServer(http.HandlerFunc(collector.handle))
+	t.Cleanup(collector.server.Close)
+	return collector
+}
+
+// Endpoint 返回收集器的traces地址
+func (c *Collector) Endpoint() string {
+	return c.server.URL + "/v1/traces"
+}
+
+// Spans 返回已收到的span
+func (c *Collector) Spans() []Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Span(nil), c.spans...)
+}
+
+// Find 返回第一个名称匹配的span
+func (c *Collector) Find(name string) (Span, bool) {
+	for _, span := range c.Spans() {
+		if span.Name == name {
+			return span, true
+		}
+	}
+	return Span{}, false
+}
+
+// handle 接收 POST /v1/traces
+func (c *Collector) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/x-protobuf" {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var request coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, resourceSpans := range request.GetResourceSpans() {
+		resource := attributes(resourceSpans.GetResource().GetAttributes())
+		for _, scopeSpans := range resourceSpans.GetScopeSpans() {
+			for _, span := range scopeSpans.GetSpans() {
+				c.spans = append(c.spans, Span{
+					TraceID:      hex.EncodeToString(span.GetTraceId()),
+					SpanID:       hex.EncodeToString(span.GetSpanId()),
+					ParentSpanID: hex.EncodeToString(span.GetParentSpanId()),
+					Name:         span.GetName(),
+					Kind:         int(span.GetKind()),
+					StatusCode:   int(span.GetStatus().GetCode()),
+					Attributes:   attributes(span.GetAttributes()),
+					Resource:     resource,
+				})
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	response, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(response)
+}
+
+// attributes 将属性列表转换为map
+func attributes(keyValues []*commonpb.KeyValue) map[string]string {
+	result := make(map[string]string, len(keyValues))
+	for _, kv := range keyValues {
+		result[kv.GetKey()] = valueString(kv.GetValue())
+	}
+	return result
+}
+
+// valueString 返回属性值的文本形式
+func valueString(value *commonpb.AnyValue) string {
+	switch v := value.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]string, 0, len(v.ArrayValue.GetValues()))
+		for _, item := range v.ArrayValue.GetValues() {
+			values = append(values, valueString(item))
+		}
+		return fmt.Sprint(values)
+	}
+	return ""
+}
@@ -0,0 +1,224 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gmail-oauth-proxy-server/internal/audit"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/store"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound 保险库中不存在对应的凭据
+var ErrNotFound = errors.New("credential not found in vault")
+
+// Credential 需要加密保存的凭据
+type Credential struct {
+	RefreshToken string `json:"refresh_token"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// Entry 保险库条目（不含凭据）
+// 条目归属于保存它的客户端身份（API Key或客户端证书），只有同一身份可以读取
+type Entry struct {
+	Owner     string    `json:"owner,omitempty"` // 保存凭据的客户端身份，未启用鉴权时为空
+	Email     string    `json:"email"`
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// record 保存到存储中的条目及凭据
+type record struct {
+	Entry
+	Credential Credential `json:"credential"`
+}
+
+// AccessToken 缓存的访问令牌（仅保存在内存中）
+type AccessToken struct {
+	Token     string
+	Scope     string
+	ExpiresAt time.Time
+}
+
+// Vault 刷新令牌保险库，条目保存在 store.BucketGrants 中
+// 凭据由状态存储使用静态加密主密钥进行信封加密，因此轮换主密钥（config rekey）时一并重新加密
+type Vault struct {
+	store store.Store
+	skew  time.Duration
+	audit *audit.Log
+
+	mu     sync.Mutex
+	tokens map[string]AccessToken
+	locks  map[string]*entryLock
+}
+
+// entryLock 单个条目的刷新锁，refs为持有或等待该锁的请求数，归零时从locks中移除
+type entryLock struct {
+	sync.Mutex
+	refs int
+}
+
+// New 根据配置创建保险库，st必须启用静态加密（encryption.master_key / key_file / passphrase）
+func New(cfg config.VaultConfig, st store.Store) (*Vault, error) {
+	if !store.IsEncrypted(st) {
+		return nil, fmt.Errorf("vault requires encryption at rest: configure encryption.master_key, key_file or passphrase")
+	}
+
+	return &Vault{
+		store:  st,
+		skew:   time.Duration(cfg.RefreshSkew) * time.Second,
+		audit:  audit.New(st),
+		tokens: make(map[string]AccessToken),
+		locks:  make(map[string]*entryLock),
+	}, nil
+}
+
+// Put 保存owner的凭据，已存在时覆盖并清除缓存的访问令牌
+func (v *Vault) Put(owner, email, clientID, scope string, cred Credential) error {
+	id := entryKey(owner, email, clientID)
+	err := v.store.Update(store.BucketGrants, id, func(value []byte, exists bool) ([]byte, error) {
+		now := time.Now()
+		rec := record{Entry: Entry{Owner: owner, Email: strings.ToLower(email), ClientID: clientID, CreatedAt: now}}
+		if exists {
+			if err := json.Unmarshal(value, &rec); err != nil {
+				return nil, fmt.Errorf("corrupted vault entry: %w", err)
+			}
+		}
+		rec.Scope = scope
+		rec.Credential = cred
+		rec.UpdatedAt = now
+		return json.Marshal(rec)
+	})
+	if err != nil {
+		return err
+	}
+	v.audit.Record(audit.ActionGrantStore, owner, strings.ToLower(email), "client_id="+clientID)
+
+	v.mu.Lock()
+	delete(v.tokens, id)
+	v.mu.Unlock()
+	return nil
+}
+
+// Get 读取owner保存的凭据
+func (v *Vault) Get(owner, email, clientID string) (Entry, Credential, error) {
+	value, err := v.store.Get(store.BucketGrants, entryKey(owner, email, clientID))
+	if errors.Is(err, store.ErrNotFound) {
+		return Entry{}, Credential{}, ErrNotFound
+	}
+	if err != nil {
+		return Entry{}, Credential{}, err
+	}
+
+	var rec record
+	if err := json.Unmarshal(value, &rec); err != nil {
+		return Entry{}, Credential{}, fmt.Errorf("corrupted vault entry: %w", err)
+	}
+	return rec.Entry, rec.Credential, nil
+}
+
+// Delete 删除凭据及缓存的访问令牌
+func (v *Vault) Delete(owner, email, clientID string) error {
+	id := entryKey(owner, email, clientID)
+	err := v.store.Delete(store.BucketGrants, id)
+	if errors.Is(err, store.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	v.audit.Record(audit.ActionGrantDelete, owner, strings.ToLower(email), "client_id="+clientID)
+
+	v.mu.Lock()
+	delete(v.tokens, id)
+	v.mu.Unlock()
+	return nil
+}
+
+// ClientsFor 返回owner为指定账号保存凭据的client_id（已排序）
+func (v *Vault) ClientsFor(owner, email string) []string {
+	email = strings.ToLower(email)
+	var clientIDs []string
+	for _, entry := range v.Entries() {
+		if entry.Owner == owner && entry.Email == email {
+			clientIDs = append(clientIDs, entry.ClientID)
+		}
+	}
+	return clientIDs
+}
+
+// Entries 返回所有条目（不含解密后的凭据），按身份、账号和client_id排序
+func (v *Vault) Entries() []Entry {
+	values, err := v.store.List(store.BucketGrants)
+	if err != nil {
+		return nil
+	}
+
+	entries := make([]Entry, 0, len(values))
+	for _, value := range values {
+		var rec record
+		if err := json.Unmarshal(value, &rec); err != nil {
+			continue
+		}
+		entries = append(entries, rec.Entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entryKey(entries[i].Owner, entries[i].Email, entries[i].ClientID) < entryKey(entries[j].Owner, entries[j].Email, entries[j].ClientID)
+	})
+	return entries
+}
+
+// CachedToken 返回距离过期仍超过 refresh_skew 的缓存访问令牌
+func (v *Vault) CachedToken(owner, email, clientID string) (AccessToken, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	token, ok := v.tokens[entryKey(owner, email, clientID)]
+	if !ok || time.Now().Add(v.skew).After(token.ExpiresAt) {
+		return AccessToken{}, false
+	}
+	return token, true
+}
+
+// CacheToken 缓存刷新得到的访问令牌
+func (v *Vault) CacheToken(owner, email, clientID string, token AccessToken) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tokens[entryKey(owner, email, clientID)] = token
+}
+
+// Lock 获取单个条目的刷新锁，避免并发请求重复刷新同一个令牌
+// 返回的函数释放锁，最后一个使用者释放后锁从locks中移除
+func (v *Vault) Lock(owner, email, clientID string) func() {
+	v.mu.Lock()
+	id := entryKey(owner, email, clientID)
+	lock, ok := v.locks[id]
+	if !ok {
+		lock = &entryLock{}
+		v.locks[id] = lock
+	}
+	lock.refs++
+	v.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if lock.refs--; lock.refs == 0 {
+			delete(v.locks, id)
+		}
+	}
+}
+
+// entryKey 条目索引：客户端身份 + 账号邮箱（不区分大小写）+ client_id
+func entryKey(owner, email, clientID string) string {
+	return owner + "|" + strings.ToLower(email) + "|" + clientID
+}
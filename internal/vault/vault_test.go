@@ -0,0 +1,186 @@
+package vault
+
+import (
+	"errors"
+	"gmail-oauth-proxy-server/internal/config"
+	"gmail-oauth-proxy-server/internal/secret"
+	"gmail-oauth-proxy-server/internal/store"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKeyring 生成测试用的随机主密钥
+func newTestKeyring(t *testing.T) *secret.Keyring {
+	t.Helper()
+	key, err := secret.GenerateKey()
+	require.NoError(t, err)
+	keyring, err := secret.LoadKeyring(secret.Source{Key: key})
+	require.NoError(t, err)
+	return keyring
+}
+
+// newTestVault 创建使用加密内存存储的保险库
+func newTestVault(t *testing.T, refreshSkew int) *Vault {
+	t.Helper()
+	v, err := New(config.VaultConfig{RefreshSkew: refreshSkew}, store.NewEncrypted(store.NewMemory(), newTestKeyring(t)))
+	require.NoError(t, err)
+	return v
+}
+
+func TestNew_RequiresEncryption(t *testing.T) {
+	_, err := New(config.VaultConfig{}, store.NewMemory())
+	assert.Error(t, err)
+}
+
+func TestVault_PutGet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := store.OpenFile(path)
+	require.NoError(t, err)
+	keyring := newTestKeyring(t)
+	cfg := config.VaultConfig{RefreshSkew: 60}
+
+	v, err := New(cfg, store.NewEncrypted(st, keyring))
+	require.NoError(t, err)
+
+	cred := Credential{RefreshToken: "1//refresh_token_value", ClientSecret: "client_secret_value"}
+	require.NoError(t, v.Put("key=ci", "Alice@Example.com", "client-a", "openid email", cred))
+	require.NoError(t, v.Put("key=ci", "alice@example.com", "client-b", "openid", cred))
+
+	entry, got, err := v.Get("key=ci", "alice@example.com", "client-a")
+	require.NoError(t, err)
+	assert.Equal(t, cred, got)
+	assert.Equal(t, "alice@example.com", entry.Email)
+	assert.Equal(t, "openid email", entry.Scope)
+	assert.Equal(t, "key=ci", entry.Owner)
+	assert.Equal(t, []string{"client-a", "client-b"}, v.ClientsFor("key=ci", "ALICE@example.com"))
+
+	// 文件中不包含明文凭据，权限为600
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "refresh_token_value")
+	assert.NotContains(t, string(data), "client_secret_value")
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// 重新打开后仍可读取
+	reopenedStore, err := store.OpenFile(path)
+	require.NoError(t, err)
+	reopened, err := New(cfg, store.NewEncrypted(reopenedStore, keyring))
+	require.NoError(t, err)
+	_, got, err = reopened.Get("key=ci", "alice@example.com", "client-a")
+	require.NoError(t, err)
+	assert.Equal(t, cred, got)
+	assert.Len(t, reopened.Entries(), 2)
+
+	// 错误的主密钥无法解密
+	wrongKey, err := New(cfg, store.NewEncrypted(reopenedStore, newTestKeyring(t)))
+	require.NoError(t, err)
+	_, _, err = wrongKey.Get("key=ci", "alice@example.com", "client-a")
+	assert.True(t, errors.Is(err, secret.ErrWrongKey))
+
+	// 删除
+	require.NoError(t, v.Delete("key=ci", "alice@example.com", "client-a"))
+	_, _, err = v.Get("key=ci", "alice@example.com", "client-a")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.True(t, errors.Is(v.Delete("key=ci", "alice@example.com", "client-a"), ErrNotFound))
+	assert.Equal(t, []string{"client-b"}, v.ClientsFor("key=ci", "alice@example.com"))
+}
+
+func TestVault_Rekey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	st, err := store.OpenFile(path)
+	require.NoError(t, err)
+	oldKeyring, newKeyring := newTestKeyring(t), newTestKeyring(t)
+
+	v, err := New(config.VaultConfig{}, store.NewEncrypted(st, oldKeyring))
+	require.NoError(t, err)
+	cred := Credential{RefreshToken: "1//refresh_token_value", ClientSecret: "client_secret_value"}
+	require.NoError(t, v.Put("key=ci", "alice@example.com", "client-a", "", cred))
+
+	// config rekey 重新包装状态存储中的保险库条目和审计记录
+	count, err := store.Rekey(st, oldKeyring, newKeyring)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	rekeyed, err := New(config.VaultConfig{}, store.NewEncrypted(st, newKeyring))
+	require.NoError(t, err)
+	_, got, err := rekeyed.Get("key=ci", "alice@example.com", "client-a")
+	require.NoError(t, err)
+	assert.Equal(t, cred, got)
+
+	_, _, err = v.Get("key=ci", "alice@example.com", "client-a")
+	assert.True(t, errors.Is(err, secret.ErrWrongKey))
+}
+
+func TestVault_CachedToken(t *testing.T) {
+	v := newTestVault(t, 60)
+	require.NoError(t, v.Put("key=ci", "alice@example.com", "client-a", "", Credential{RefreshToken: "r"}))
+
+	_, ok := v.CachedToken("key=ci", "alice@example.com", "client-a")
+	assert.False(t, ok)
+
+	v.CacheToken("key=ci", "alice@example.com", "client-a", AccessToken{Token: "ya29.valid", ExpiresAt: time.Now().Add(time.Hour)})
+	token, ok := v.CachedToken("key=ci", "Alice@example.com", "client-a")
+	assert.True(t, ok)
+	assert.Equal(t, "ya29.valid", token.Token)
+
+	// 即将过期（小于refresh_skew）的令牌视为无效
+	v.CacheToken("key=ci", "alice@example.com", "client-a", AccessToken{Token: "ya29.expiring", ExpiresAt: time.Now().Add(30 * time.Second)})
+	_, ok = v.CachedToken("key=ci", "alice@example.com", "client-a")
+	assert.False(t, ok)
+
+	// 更新凭据时清除缓存
+	v.CacheToken("key=ci", "alice@example.com", "client-a", AccessToken{Token: "ya29.valid", ExpiresAt: time.Now().Add(time.Hour)})
+	require.NoError(t, v.Put("key=ci", "alice@example.com", "client-a", "", Credential{RefreshToken: "r2"}))
+	_, ok = v.CachedToken("key=ci", "alice@example.com", "client-a")
+	assert.False(t, ok)
+}
+
+func TestVault_OwnerIsolation(t *testing.T) {
+	v := newTestVault(t, 60)
+	require.NoError(t, v.Put("key=ci", "alice@example.com", "client-a", "", Credential{RefreshToken: "r-ci"}))
+	require.NoError(t, v.Put("key=mailer", "alice@example.com", "client-a", "", Credential{RefreshToken: "r-mailer"}))
+	v.CacheToken("key=ci", "alice@example.com", "client-a", AccessToken{Token: "ya29.ci", ExpiresAt: time.Now().Add(time.Hour)})
+
+	// 其他身份保存的凭据和缓存的访问令牌不可见
+	_, cred, err := v.Get("key=mailer", "alice@example.com", "client-a")
+	require.NoError(t, err)
+	assert.Equal(t, "r-mailer", cred.RefreshToken)
+	_, ok := v.CachedToken("key=mailer", "alice@example.com", "client-a")
+	assert.False(t, ok)
+	_, _, err = v.Get("key=other", "alice@example.com", "client-a")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Empty(t, v.ClientsFor("key=other", "alice@example.com"))
+	assert.True(t, errors.Is(v.Delete("key=other", "alice@example.com", "client-a"), ErrNotFound))
+	assert.Len(t, v.Entries(), 2)
+}
+
+func TestVault_LockReleased(t *testing.T) {
+	v := newTestVault(t, 0)
+
+	unlock := v.Lock("key=ci", "alice@example.com", "client-a")
+	done := make(chan struct{})
+	go func() {
+		v.Lock("key=ci", "alice@example.com", "client-a")()
+		close(done)
+	}()
+
+	// 等待第二个请求开始等待锁
+	require.Eventually(t, func() bool {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return v.locks[entryKey("key=ci", "alice@example.com", "client-a")].refs == 2
+	}, time.Second, time.Millisecond)
+	unlock()
+	<-done
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	assert.Empty(t, v.locks)
+}